@@ -0,0 +1,104 @@
+package blocklist
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+)
+
+// Entry is a donor identifier a streamer doesn't take donations from.
+type Entry struct {
+	ID         int    `db:"id"`
+	StreamerID int    `db:"streamer_id"`
+	Kind       string `db:"kind"`
+	// Value is the identifier as returned by NewKey.
+	Value string `db:"value"`
+	Note  string `db:"note"`
+	// DonationID is the donation the entry was blocked from, its donor's
+	// email and payment details are not shown to the streamer.
+	DonationID sql.NullInt64 `db:"donation_id"`
+	CreatedAt  time.Time     `db:"created_at"`
+}
+
+const (
+	// KindName matches the donor's name however it's written.
+	KindName  = "NAME"
+	KindEmail = "EMAIL"
+	KindIP    = "IP"
+	// KindCustomer is the donor's customer at the payment provider.
+	KindCustomer = "CUSTOMER"
+	// KindCard is the fingerprint of the donor's card at the payment provider.
+	KindCard = "CARD"
+)
+
+type BlocklistRepo interface {
+	// Create blocks e. It reports false if the key was already blocked.
+	Create(e *Entry) (bool, error)
+	// GetEntries returns the streamer's blocklist, newest first.
+	GetEntries(streamerID int) ([]Entry, error)
+	// Delete unblocks the streamer's entry. It reports false if there is no such entry.
+	Delete(streamerID int, id int) (bool, error)
+	// Match returns the streamer's entries blocking any of keys.
+	Match(streamerID int, keys []Key) ([]Entry, error)
+}
+
+type Repo struct {
+	database.Repo
+}
+
+func (r Repo) Create(e *Entry) (bool, error) {
+	rows, err := r.DB.Query(`
+		INSERT INTO blocked_donors (streamer_id, kind, value, note, donation_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (streamer_id, kind, value) DO NOTHING
+		RETURNING id, created_at`, e.StreamerID, e.Kind, e.Value, e.Note, e.DonationID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	return true, rows.Scan(&e.ID, &e.CreatedAt)
+}
+
+func (r Repo) GetEntries(streamerID int) ([]Entry, error) {
+	res := []Entry{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM blocked_donors
+		WHERE streamer_id = $1
+		ORDER BY created_at DESC, id DESC`, streamerID)
+	return res, err
+}
+
+func (r Repo) Delete(streamerID int, id int) (bool, error) {
+	result, err := r.DB.Exec("DELETE FROM blocked_donors WHERE id = $1 AND streamer_id = $2", id, streamerID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r Repo) Match(streamerID int, keys []Key) ([]Entry, error) {
+	res := []Entry{}
+	if len(keys) == 0 {
+		return res, nil
+	}
+
+	args := []any{streamerID}
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("($%d, $%d)", len(args)+1, len(args)+2))
+		args = append(args, k.Kind, k.Value)
+	}
+	err := r.DB.Select(&res, `
+		SELECT * FROM blocked_donors
+		WHERE streamer_id = $1 AND (kind, value) IN (`+strings.Join(pairs, ", ")+`)
+		ORDER BY id`, args...)
+	return res, err
+}
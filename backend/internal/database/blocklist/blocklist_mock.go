@@ -0,0 +1,54 @@
+package blocklist
+
+import "time"
+
+type BlocklistMock struct {
+	Entries []Entry
+	nextID  int
+}
+
+func (repo *BlocklistMock) Create(e *Entry) (bool, error) {
+	for _, existing := range repo.Entries {
+		if existing.StreamerID == e.StreamerID && existing.Kind == e.Kind && existing.Value == e.Value {
+			return false, nil
+		}
+	}
+	repo.nextID++
+	e.ID = repo.nextID
+	e.CreatedAt = time.Now()
+	repo.Entries = append(repo.Entries, *e)
+	return true, nil
+}
+
+func (repo *BlocklistMock) GetEntries(streamerID int) ([]Entry, error) {
+	res := []Entry{}
+	for i := len(repo.Entries) - 1; i >= 0; i-- {
+		if repo.Entries[i].StreamerID == streamerID {
+			res = append(res, repo.Entries[i])
+		}
+	}
+	return res, nil
+}
+
+func (repo *BlocklistMock) Delete(streamerID int, id int) (bool, error) {
+	for i, e := range repo.Entries {
+		if e.ID == id && e.StreamerID == streamerID {
+			repo.Entries = append(repo.Entries[:i], repo.Entries[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (repo *BlocklistMock) Match(streamerID int, keys []Key) ([]Entry, error) {
+	res := []Entry{}
+	for _, e := range repo.Entries {
+		for _, k := range keys {
+			if e.StreamerID == streamerID && e.Kind == k.Kind && e.Value == k.Value {
+				res = append(res, e)
+				break
+			}
+		}
+	}
+	return res, nil
+}
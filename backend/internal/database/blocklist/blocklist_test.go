@@ -0,0 +1,91 @@
+//go:build integration
+// +build integration
+
+package blocklist
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestBlocklistRepoIntegration(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("BACKEND__CONNECTION_STRING"))
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer db.Close()
+	repo := Repo{Repo: database.Repo{DB: db}}
+	repo.Migrate()
+	db.Exec("DELETE FROM blocked_donors")
+
+	streamers := streamer.Repo{Repo: repo.Repo}
+	st := streamer.Streamer{TwitchId: "blocklistTwitchId", TwitchName: "blocklistTwitchName", SecretCode: "blocklistSecret"}
+	if err := streamers.CreateStreamer(&st); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test Create blocks a key once
+	e := Entry{StreamerID: st.ID, Kind: KindEmail, Value: "troll@example.com", Note: "spam"}
+	for i, expected := range []bool{true, false} {
+		created, err := repo.Create(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != expected {
+			t.Errorf("Expected created %v on attempt %d, got %v", expected, i+1, created)
+		}
+	}
+	ip := Entry{StreamerID: st.ID, Kind: KindIP, Value: "10.0.0.1"}
+	if _, err := repo.Create(&ip); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test Match
+	matches, err := repo.Match(st.ID, []Key{{KindName, "troll"}, {KindEmail, "troll@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].ID != e.ID {
+		t.Errorf("Expected the email entry, got %+v", matches)
+	}
+	matches, err = repo.Match(st.ID+1, []Key{{KindIP, "10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches for another streamer, got %+v", matches)
+	}
+
+	// Test GetEntries
+	entries, err := repo.GetEntries(st.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != ip.ID || entries[1].Note != "spam" {
+		t.Errorf("Expected both entries newest first, got %+v", entries)
+	}
+
+	// Test Delete
+	deleted, err := repo.Delete(st.ID+1, e.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted {
+		t.Error("Expected another streamer's entry to be kept")
+	}
+	deleted, err = repo.Delete(st.ID, e.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Error("Expected the entry to be deleted")
+	}
+
+	db.Exec("DELETE FROM blocked_donors")
+	db.Exec("DELETE FROM streamers WHERE id = $1", st.ID)
+}
@@ -0,0 +1,90 @@
+package blocklist
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/filter"
+)
+
+const maxValueLength = 255
+
+var ErrInvalidKey = errors.New("invalid blocklist key")
+
+// Key is a normalized donor identifier.
+type Key struct {
+	Kind  string
+	Value string
+}
+
+// NewKey normalizes value so every spelling of the identifier has the same key.
+// It returns ErrInvalidKey if value is not an identifier of kind.
+func NewKey(kind string, value string) (Key, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case KindName:
+		value = filter.Canonical(value)
+	case KindEmail:
+		value = strings.ToLower(value)
+		if !strings.Contains(value, "@") {
+			return Key{}, fmt.Errorf("%w: invalid email %q", ErrInvalidKey, value)
+		}
+	case KindIP:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return Key{}, fmt.Errorf("%w: invalid IP %q", ErrInvalidKey, value)
+		}
+		value = ip.String()
+	case KindCustomer, KindCard:
+	default:
+		return Key{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidKey, kind)
+	}
+	if value == "" || len(value) > maxValueLength {
+		return Key{}, fmt.Errorf("%w: invalid %s %q", ErrInvalidKey, strings.ToLower(kind), value)
+	}
+	return Key{Kind: kind, Value: value}, nil
+}
+
+// DonorKeys returns the keys of everything known about the donation's donor.
+func DonorKeys(d donation.Donation) []Key {
+	// donations created before the donor's name was kept only have the filtered name,
+	// what the filter left of a masked one could be anyone's
+	name := d.DonorName
+	if name == "" && !maskedName(d) {
+		name = d.Name
+	}
+	values := []Key{
+		{KindName, name},
+		{KindEmail, d.DonorEmail},
+		{KindIP, d.DonorIP},
+		{KindCustomer, d.CustomerID},
+		{KindCard, d.CardFingerprint},
+	}
+	keys := make([]Key, 0, len(values))
+	for _, v := range values {
+		if v.Value == "" {
+			continue
+		}
+		if k, err := NewKey(v.Kind, v.Value); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// maskedName reports whether the filter masked part of the donation's name.
+func maskedName(d donation.Donation) bool {
+	decisions, err := filter.ParseDecisions(d.FilterDecisions.String)
+	if err != nil {
+		return true
+	}
+	for _, decision := range decisions {
+		if decision.Field == filter.FieldName && decision.Action == filter.ActionMask {
+			return true
+		}
+	}
+	return false
+}
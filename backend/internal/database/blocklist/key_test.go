@@ -0,0 +1,66 @@
+//go:build unit
+// +build unit
+
+package blocklist
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+)
+
+func TestNewKey(t *testing.T) {
+	cases := []struct {
+		kind     string
+		value    string
+		expected string
+		err      error
+	}{
+		{KindName, "  Tr0ll_King ", "troll king", nil},
+		{KindName, "TROLL king", "troll king", nil},
+		{KindName, "!!!", "", ErrInvalidKey},
+		{KindEmail, " Troll@Example.com", "troll@example.com", nil},
+		{KindEmail, "troll", "", ErrInvalidKey},
+		{KindIP, "::ffff:10.0.0.1", "10.0.0.1", nil},
+		{KindIP, "10.0.0", "", ErrInvalidKey},
+		{KindCard, "fp_123", "fp_123", nil},
+		{KindCustomer, "", "", ErrInvalidKey},
+		{"PHONE", "123", "", ErrInvalidKey},
+	}
+
+	for _, tc := range cases {
+		k, err := NewKey(tc.kind, tc.value)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("NewKey(%s, %q): expected error %v, got %v", tc.kind, tc.value, tc.err, err)
+			continue
+		}
+		if k.Value != tc.expected {
+			t.Errorf("NewKey(%s, %q): expected %q, got %q", tc.kind, tc.value, tc.expected, k.Value)
+		}
+	}
+}
+
+func TestDonorKeys(t *testing.T) {
+	masked := sql.NullString{String: `[{"field":"name","kind":"WORD","value":"troll","action":"MASK","match":"Troll"}]`, Valid: true}
+	cases := []struct {
+		name     string
+		d        donation.Donation
+		expected []Key
+	}{
+		{"the name the donor typed", donation.Donation{DonorName: "troll head", Name: "***** Head", FilterDecisions: masked, DonorEmail: "troll@example.com"},
+			[]Key{{KindName, "troll head"}, {KindEmail, "troll@example.com"}}},
+		{"an old donation", donation.Donation{Name: "Troll Head", CardFingerprint: "fp_1"},
+			[]Key{{KindName, "troll head"}, {KindCard, "fp_1"}}},
+		{"an old masked donation", donation.Donation{Name: "***** Head", FilterDecisions: masked, DonorIP: "10.0.0.1"},
+			[]Key{{KindIP, "10.0.0.1"}}},
+	}
+
+	for _, tc := range cases {
+		if keys := DonorKeys(tc.d); !reflect.DeepEqual(keys, tc.expected) {
+			t.Errorf("%s: expected keys %v, got %v", tc.name, tc.expected, keys)
+		}
+	}
+}
@@ -1,19 +1,94 @@
 package donation
 
 import (
+	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
 )
 
 type Donation struct {
-	PaymentID  string `db:"payment_id"`
-	Message    string `db:"message"`
-	Name       string `db:"name"`
-	Status     string `db:"status"`
+	PaymentID string `db:"payment_id"`
+	Message   string `db:"message"`
+	Name      string `db:"name"`
+	Status    string `db:"status"`
+	// Provider is the payment provider the donation is payed with.
+	Provider   string `db:"provider"`
 	ID         int
 	StreamerID int `db:"streamer_id"`
-	Amount     int `db:"amount"`
+	// Amount is what the donor paid, in the minor unit of Currency.
+	Amount   int64  `db:"amount"`
+	Currency string `db:"currency"`
+	// Fee is the provider's processing fee and NetAmount is Amount less Fee,
+	// what the streamer receives.
+	Fee       int64 `db:"fee"`
+	NetAmount int64 `db:"net_amount"`
+	// FeesCovered is set when the donor added the fee on top of their donation.
+	FeesCovered bool `db:"fees_covered"`
+	// SubscriptionID is set for the monthly payments of a subscription,
+	// Month counts them from 1. It is assigned when the donation is created.
+	SubscriptionID sql.NullInt64 `db:"subscription_id"`
+	Month          int           `db:"month"`
+	// AlertSeq orders the streamer's alerts. It is assigned when the donation is payed,
+	// or when it's approved if it was held for review.
+	AlertSeq sql.NullInt64 `db:"alert_seq"`
+	// AlertAckedAt is set once the streamer's overlay has shown the alert.
+	AlertAckedAt sql.NullTime `db:"alert_acked_at"`
+	// RefundID is the payment provider's refund, set when the streamer refunds the donation.
+	RefundID     sql.NullString `db:"refund_id"`
+	RefundReason sql.NullString `db:"refund_reason"`
+	// HomeAmount and HomeNetAmount are Amount and NetAmount converted
+	// to the streamer's HomeCurrency at ExchangeRate when the donation was payed.
+	HomeCurrency  sql.NullString  `db:"home_currency"`
+	HomeAmount    sql.NullInt64   `db:"home_amount"`
+	HomeNetAmount sql.NullInt64   `db:"home_net_amount"`
+	ExchangeRate  sql.NullFloat64 `db:"exchange_rate"`
+	// SessionID identifies the donation page the donation was started on.
+	SessionID string `db:"session_id"`
+	// ModerationStatus is PENDING while the donation is held for the streamer's review,
+	// it's approved automatically at ReviewDeadline if that is set.
+	ModerationStatus string       `db:"moderation_status"`
+	ReviewDeadline   sql.NullTime `db:"review_deadline"`
+	// FilterAction is the strictest action of the message filter's decisions,
+	// FilterDecisions records them as JSON. They are set when the donation is created.
+	FilterAction    string         `db:"filter_action"`
+	FilterDecisions sql.NullString `db:"filter_decisions"`
+	// DonorName, DonorEmail and DonorIP are given when the donation is created, CustomerID
+	// and CardFingerprint identify the payer at the provider once it's payed. DonorName is
+	// the canonical name the donor typed, Name is what the filter left of it.
+	DonorName       string    `db:"donor_name"`
+	DonorEmail      string    `db:"donor_email"`
+	DonorIP         string    `db:"donor_ip"`
+	CustomerID      string    `db:"customer_id"`
+	CardFingerprint string    `db:"card_fingerprint"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+}
+
+// Money returns the donated amount.
+func (d Donation) Money() money.Money {
+	return money.New(d.Amount, d.Currency)
+}
+
+// Recurring reports whether the donation is a monthly payment of a subscription.
+func (d Donation) Recurring() bool {
+	return d.SubscriptionID.Valid
+}
+
+// Net returns the amount the streamer receives.
+func (d Donation) Net() money.Money {
+	return money.New(d.NetAmount, d.Currency)
+}
+
+// Total is the sum of a streamer's donations in Currency. Gross is what
+// donors paid and Net is what the streamer received.
+type Total struct {
+	Currency string `db:"currency"`
+	Gross    int64  `db:"gross"`
+	Net      int64  `db:"net"`
 }
 
 const (
@@ -21,13 +96,72 @@ const (
 	DonationStatusProcessing = "PROCESSING"
 	DonationStatusPayed      = "PAYED"
 	DonationStatusFailed     = "FAILED"
+	DonationStatusCanceled   = "CANCELED"
+	// DonationStatusExpired is set when the donor abandoned the payment
+	// and it was canceled by the server.
+	DonationStatusExpired  = "EXPIRED"
+	DonationStatusRefunded = "REFUNDED"
+	// DonationStatusDisputed is set while a chargeback is open, the donation
+	// goes back to PAYED if the dispute is won.
+	DonationStatusDisputed    = "DISPUTED"
+	DonationStatusDisputeLost = "DISPUTE_LOST"
+)
+
+const (
+	// ModerationStatusNone is set for donations that weren't held for review.
+	ModerationStatusNone     = "NONE"
+	ModerationStatusPending  = "PENDING"
+	ModerationStatusApproved = "APPROVED"
+	ModerationStatusRejected = "REJECTED"
 )
 
 type DonationRepo interface {
 	Create(d *Donation) error
+	// CreateForSubscription creates d unless the subscription already has a
+	// donation with its PaymentID. It reports whether d was created.
+	CreateForSubscription(d *Donation) (bool, error)
 	GetDonations(d *Donation) ([]Donation, error)
 	GetDonation(id int) (Donation, error)
-	Update(d Donation) error
+	// GetUnsettled returns up to limit donations that are CREATED, PROCESSING or FAILED,
+	// were created between createdAfter and createdBefore and have an ID greater than afterID,
+	// ordered by ID.
+	GetUnsettled(createdAfter time.Time, createdBefore time.Time, afterID int, limit int) ([]Donation, error)
+	// GetAbandoned returns up to limit CREATED or FAILED donations created before
+	// createdBefore with an ID greater than afterID, ordered by ID.
+	GetAbandoned(createdBefore time.Time, afterID int, limit int) ([]Donation, error)
+	// GetPending returns the CREATED donations of the session to the streamer
+	// created after createdAfter, newest first.
+	GetPending(streamerID int, sessionID string, createdAfter time.Time) ([]Donation, error)
+	// GetAlerts returns the streamer's payed donations with AlertSeq greater than afterSeq,
+	// ordered by AlertSeq.
+	GetAlerts(streamerID int, afterSeq int64, limit int) ([]Donation, error)
+	// GetPendingAlerts returns the streamer's payed donations whose alerts
+	// were not acknowledged yet, ordered by AlertSeq.
+	GetPendingAlerts(streamerID int, limit int) ([]Donation, error)
+	AckAlert(streamerID int, seq int64) error
+	// GetTotals returns the sums of the streamer's payed donations by currency,
+	// in the home currency they were converted to when payed. Refunded and
+	// disputed donations are not counted.
+	GetTotals(streamerID int) ([]Total, error)
+	// GetRecentAlerts returns the streamer's last limit payed donations, ordered by AlertSeq.
+	GetRecentAlerts(streamerID int, limit int) ([]Donation, error)
+	// GetHeld returns up to limit of the streamer's payed donations held for review,
+	// ordered by ID.
+	GetHeld(streamerID int, limit int) ([]Donation, error)
+	// GetOverdueReviews returns up to limit payed donations held for review
+	// with a ReviewDeadline before now, ordered by ID.
+	GetOverdueReviews(now time.Time, limit int) ([]Donation, error)
+	// Update saves d. Any outbox messages are written in the same transaction.
+	// ModerationStatus is only saved for donations that weren't held yet,
+	// Review changes it afterwards.
+	Update(d Donation, messages ...outbox.Message) error
+	// UpdateFrom saves d like Update if its stored status is still from.
+	// It reports false if the status changed in the meantime.
+	UpdateFrom(d Donation, from string, messages ...outbox.Message) (bool, error)
+	// Review saves the ModerationStatus and Message of a payed donation of d.StreamerID
+	// held for review, an approved donation is assigned its AlertSeq. It reports false
+	// if there is no such donation. Any outbox messages are written in the same transaction.
+	Review(d Donation, messages ...outbox.Message) (bool, error)
 }
 
 type Repo struct {
@@ -35,19 +169,51 @@ type Repo struct {
 }
 
 func (r Repo) Create(d *Donation) error {
-	var id int
-	err := r.DB.Get(&id, `
+	_, err := r.create(d, "")
+	return err
+}
+
+func (r Repo) CreateForSubscription(d *Donation) (bool, error) {
+	return r.create(d, "ON CONFLICT (subscription_id, payment_id) WHERE subscription_id IS NOT NULL DO NOTHING")
+}
+
+// create inserts d, onConflict is added to the insert.
+func (r Repo) create(d *Donation, onConflict string) (bool, error) {
+	err := r.DB.QueryRowx(`
 	INSERT INTO donations (
 		payment_id, 
 		streamer_id, 
 		amount, 
 		message, 
 		name, 
-		status
-	) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`, d.PaymentID, d.StreamerID, d.Amount, d.Message, d.Name, d.Status)
-
-	d.ID = id
-	return err
+		status,
+		provider,
+		currency,
+		fee,
+		net_amount,
+		fees_covered,
+		subscription_id,
+		month,
+		session_id,
+		filter_action,
+		filter_decisions,
+		donor_name,
+		donor_email,
+		donor_ip
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+		CASE WHEN $12::INT IS NULL THEN 0
+			ELSE (SELECT COUNT(*) + 1 FROM donations WHERE subscription_id = $12)
+		END, $13, $14, $15, $16, $17, $18)
+	`+onConflict+`
+	RETURNING id, month, moderation_status, created_at, updated_at`,
+		d.PaymentID, d.StreamerID, d.Amount, d.Message, d.Name, d.Status, d.Provider, d.Currency,
+		d.Fee, d.NetAmount, d.FeesCovered, d.SubscriptionID, d.SessionID,
+		d.FilterAction, d.FilterDecisions, d.DonorName, d.DonorEmail, d.DonorIP,
+	).Scan(&d.ID, &d.Month, &d.ModerationStatus, &d.CreatedAt, &d.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 func (r Repo) GetDonations(d *Donation) ([]Donation, error) {
@@ -86,11 +252,195 @@ func (r Repo) GetDonation(id int) (Donation, error) {
 	return d, err
 }
 
-func (r Repo) Update(d Donation) error {
+func (r Repo) GetUnsettled(createdAfter time.Time, createdBefore time.Time, afterID int, limit int) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM donations
+		WHERE status IN ($1, $2, $3) AND created_at > $4 AND created_at < $5 AND id > $6
+		ORDER BY id
+		LIMIT $7`, DonationStatusCreated, DonationStatusProcessing, DonationStatusFailed,
+		createdAfter, createdBefore, afterID, limit)
+	return res, err
+}
+
+func (r Repo) GetAbandoned(createdBefore time.Time, afterID int, limit int) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM donations
+		WHERE status IN ($1, $2) AND created_at < $3 AND id > $4
+		ORDER BY id
+		LIMIT $5`, DonationStatusCreated, DonationStatusFailed, createdBefore, afterID, limit)
+	return res, err
+}
+
+func (r Repo) GetPending(streamerID int, sessionID string, createdAfter time.Time) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM donations
+		WHERE session_id = $1 AND session_id <> '' AND status = $2 AND streamer_id = $3 AND created_at > $4
+		ORDER BY id DESC`, sessionID, DonationStatusCreated, streamerID, createdAfter)
+	return res, err
+}
+
+func (r Repo) GetHeld(streamerID int, limit int) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM donations
+		WHERE streamer_id = $1 AND status = $2 AND moderation_status = $3
+		ORDER BY id
+		LIMIT $4`, streamerID, DonationStatusPayed, ModerationStatusPending, limit)
+	return res, err
+}
+
+func (r Repo) GetOverdueReviews(now time.Time, limit int) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM donations
+		WHERE status = $1 AND moderation_status = $2 AND review_deadline < $3
+		ORDER BY id
+		LIMIT $4`, DonationStatusPayed, ModerationStatusPending, now, limit)
+	return res, err
+}
+
+func (r Repo) GetAlerts(streamerID int, afterSeq int64, limit int) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM donations
+		WHERE streamer_id = $1 AND status = $2 AND alert_seq > $3
+		ORDER BY alert_seq
+		LIMIT $4`, streamerID, DonationStatusPayed, afterSeq, limit)
+	return res, err
+}
+
+func (r Repo) GetPendingAlerts(streamerID int, limit int) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM donations
+		WHERE streamer_id = $1 AND status = $2 AND alert_seq IS NOT NULL AND alert_acked_at IS NULL
+		ORDER BY alert_seq
+		LIMIT $3`, streamerID, DonationStatusPayed, limit)
+	return res, err
+}
+
+func (r Repo) GetRecentAlerts(streamerID int, limit int) ([]Donation, error) {
+	res := []Donation{}
+	err := r.DB.Select(&res, `
+		SELECT * FROM (
+			SELECT * FROM donations
+			WHERE streamer_id = $1 AND status = $2 AND alert_seq IS NOT NULL
+			ORDER BY alert_seq DESC
+			LIMIT $3
+		) recent ORDER BY alert_seq`, streamerID, DonationStatusPayed, limit)
+	return res, err
+}
+
+func (r Repo) AckAlert(streamerID int, seq int64) error {
 	_, err := r.DB.Exec(`
-		UPDATE donations
-		SET payment_id = $1, streamer_id = $2, amount = $3, message = $4, name = $5, status = $6
-		WHERE id = $7`,
-		d.PaymentID, d.StreamerID, d.Amount, d.Message, d.Name, d.Status, d.ID)
+		UPDATE donations SET alert_acked_at = NOW()
+		WHERE streamer_id = $1 AND alert_seq = $2 AND alert_acked_at IS NULL`, streamerID, seq)
 	return err
 }
+
+func (r Repo) GetTotals(streamerID int) ([]Total, error) {
+	res := []Total{}
+	err := r.DB.Select(&res, `
+		SELECT COALESCE(home_currency, currency) AS currency,
+			SUM(COALESCE(home_amount, amount)) AS gross,
+			SUM(COALESCE(home_net_amount, net_amount)) AS net
+		FROM donations
+		WHERE streamer_id = $1 AND status = $2
+		GROUP BY 1
+		ORDER BY 1`, streamerID, DonationStatusPayed)
+	return res, err
+}
+
+func (r Repo) Update(d Donation, messages ...outbox.Message) error {
+	_, err := r.update(d, "", messages...)
+	return err
+}
+
+func (r Repo) UpdateFrom(d Donation, from string, messages ...outbox.Message) (bool, error) {
+	return r.update(d, from, messages...)
+}
+
+// update saves d if its stored status is from, or whatever it is if from is empty.
+func (r Repo) update(d Donation, from string, messages ...outbox.Message) (bool, error) {
+	if d.ModerationStatus == "" {
+		d.ModerationStatus = ModerationStatusNone
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// held donations are assigned their alert sequence number when approved
+	res, err := tx.Exec(`
+		UPDATE donations
+		SET payment_id = $1, streamer_id = $2, amount = $3, message = $4, name = $5, status = $6,
+			alert_seq = CASE
+				WHEN $6 = $8 AND alert_seq IS NULL AND moderation_status = $19 AND $18 = $19
+					THEN nextval('donation_alert_seq')
+				ELSE alert_seq
+			END,
+			refund_id = $9, refund_reason = $10,
+			home_currency = $11, home_amount = $12, exchange_rate = $13,
+			fee = $14, net_amount = $15, fees_covered = $16, home_net_amount = $17,
+			moderation_status = CASE WHEN moderation_status = $19 THEN $18 ELSE moderation_status END,
+			review_deadline = CASE WHEN moderation_status = $19 THEN $20 ELSE review_deadline END,
+			customer_id = $21, card_fingerprint = $22,
+			filter_action = $24, filter_decisions = $25, donor_email = $26, donor_ip = $27,
+			donor_name = $28,
+			updated_at = NOW()
+		WHERE id = $7 AND ($23 = '' OR status = $23)`,
+		d.PaymentID, d.StreamerID, d.Amount, d.Message, d.Name, d.Status, d.ID, DonationStatusPayed,
+		d.RefundID, d.RefundReason, d.HomeCurrency, d.HomeAmount, d.ExchangeRate,
+		d.Fee, d.NetAmount, d.FeesCovered, d.HomeNetAmount,
+		d.ModerationStatus, ModerationStatusNone, d.ReviewDeadline,
+		d.CustomerID, d.CardFingerprint, from,
+		d.FilterAction, d.FilterDecisions, d.DonorEmail, d.DonorIP, d.DonorName)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := outbox.Insert(tx, messages...); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (r Repo) Review(d Donation, messages ...outbox.Message) (bool, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE donations
+		SET moderation_status = $1, message = $2,
+			alert_seq = CASE WHEN $1 = $3 THEN nextval('donation_alert_seq') ELSE alert_seq END,
+			updated_at = NOW()
+		WHERE id = $4 AND streamer_id = $5 AND status = $6 AND moderation_status = $7`,
+		d.ModerationStatus, d.Message, ModerationStatusApproved,
+		d.ID, d.StreamerID, DonationStatusPayed, ModerationStatusPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := outbox.Insert(tx, messages...); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
@@ -1,26 +1,61 @@
 package donation
 
-import "errors"
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
+)
 
 type DonationMock struct {
+	Outbox    outbox.OutboxMock
 	donations map[int]Donation
 	nextID    int
+	nextSeq   int64
 }
 
 func NewDonationMock() *DonationMock {
 	return &DonationMock{
 		donations: make(map[int]Donation),
 		nextID:    1,
+		nextSeq:   1,
 	}
 }
 
 func (repo *DonationMock) Create(d *Donation) error {
 	d.ID = repo.nextID
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+	d.UpdatedAt = d.CreatedAt
+	if d.ModerationStatus == "" {
+		d.ModerationStatus = ModerationStatusNone
+	}
+	d.Month = 0
+	if d.SubscriptionID.Valid {
+		d.Month = 1
+		for _, donation := range repo.donations {
+			if donation.SubscriptionID == d.SubscriptionID {
+				d.Month++
+			}
+		}
+	}
 	repo.donations[d.ID] = *d
 	repo.nextID++
 	return nil
 }
 
+func (repo *DonationMock) CreateForSubscription(d *Donation) (bool, error) {
+	for _, donation := range repo.donations {
+		if donation.SubscriptionID == d.SubscriptionID && donation.PaymentID == d.PaymentID {
+			return false, nil
+		}
+	}
+	return true, repo.Create(d)
+}
+
 func (repo *DonationMock) GetDonations(d *Donation) ([]Donation, error) {
 	var result []Donation
 	for _, donation := range repo.donations {
@@ -41,11 +76,199 @@ func (repo *DonationMock) GetDonation(id int) (Donation, error) {
 	return donation, nil
 }
 
-func (repo *DonationMock) Update(d Donation) error {
-	_, ok := repo.donations[d.ID]
+func (repo *DonationMock) GetUnsettled(createdAfter time.Time, createdBefore time.Time, afterID int, limit int) ([]Donation, error) {
+	result := []Donation{}
+	for _, donation := range repo.donations {
+		unsettled := donation.Status == DonationStatusCreated || donation.Status == DonationStatusProcessing ||
+			donation.Status == DonationStatusFailed
+		if unsettled && donation.CreatedAt.After(createdAfter) && donation.CreatedAt.Before(createdBefore) && donation.ID > afterID {
+			result = append(result, donation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (repo *DonationMock) GetAbandoned(createdBefore time.Time, afterID int, limit int) ([]Donation, error) {
+	result := []Donation{}
+	for _, donation := range repo.donations {
+		abandoned := donation.Status == DonationStatusCreated || donation.Status == DonationStatusFailed
+		if abandoned && donation.CreatedAt.Before(createdBefore) && donation.ID > afterID {
+			result = append(result, donation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (repo *DonationMock) GetPending(streamerID int, sessionID string, createdAfter time.Time) ([]Donation, error) {
+	result := []Donation{}
+	for _, donation := range repo.donations {
+		if sessionID != "" && donation.SessionID == sessionID && donation.Status == DonationStatusCreated &&
+			donation.StreamerID == streamerID && donation.CreatedAt.After(createdAfter) {
+			result = append(result, donation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	return result, nil
+}
+
+func (repo *DonationMock) GetHeld(streamerID int, limit int) ([]Donation, error) {
+	result := []Donation{}
+	for _, donation := range repo.donations {
+		if donation.StreamerID == streamerID && donation.Status == DonationStatusPayed &&
+			donation.ModerationStatus == ModerationStatusPending {
+			result = append(result, donation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (repo *DonationMock) GetOverdueReviews(now time.Time, limit int) ([]Donation, error) {
+	result := []Donation{}
+	for _, donation := range repo.donations {
+		if donation.Status == DonationStatusPayed && donation.ModerationStatus == ModerationStatusPending &&
+			donation.ReviewDeadline.Valid && donation.ReviewDeadline.Time.Before(now) {
+			result = append(result, donation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (repo *DonationMock) GetAlerts(streamerID int, afterSeq int64, limit int) ([]Donation, error) {
+	result := []Donation{}
+	for _, donation := range repo.donations {
+		if donation.StreamerID == streamerID && donation.Status == DonationStatusPayed &&
+			donation.AlertSeq.Valid && donation.AlertSeq.Int64 > afterSeq {
+			result = append(result, donation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].AlertSeq.Int64 < result[j].AlertSeq.Int64 })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (repo *DonationMock) GetPendingAlerts(streamerID int, limit int) ([]Donation, error) {
+	alerts, _ := repo.GetAlerts(streamerID, 0, len(repo.donations))
+	result := []Donation{}
+	for _, donation := range alerts {
+		if !donation.AlertAckedAt.Valid && len(result) < limit {
+			result = append(result, donation)
+		}
+	}
+	return result, nil
+}
+
+func (repo *DonationMock) GetRecentAlerts(streamerID int, limit int) ([]Donation, error) {
+	alerts, _ := repo.GetAlerts(streamerID, 0, len(repo.donations))
+	if len(alerts) > limit {
+		alerts = alerts[len(alerts)-limit:]
+	}
+	return alerts, nil
+}
+
+func (repo *DonationMock) AckAlert(streamerID int, seq int64) error {
+	for id, donation := range repo.donations {
+		if donation.StreamerID == streamerID && donation.AlertSeq.Valid && donation.AlertSeq.Int64 == seq {
+			donation.AlertAckedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			repo.donations[id] = donation
+		}
+	}
+	return nil
+}
+
+func (repo *DonationMock) GetTotals(streamerID int) ([]Total, error) {
+	totals := map[string]Total{}
+	for _, donation := range repo.donations {
+		if donation.StreamerID != streamerID || donation.Status != DonationStatusPayed {
+			continue
+		}
+		currency, gross, net := donation.Currency, donation.Amount, donation.NetAmount
+		if donation.HomeCurrency.Valid {
+			currency, gross, net = donation.HomeCurrency.String, donation.HomeAmount.Int64, donation.HomeNetAmount.Int64
+		}
+		t := totals[currency]
+		t.Currency = currency
+		t.Gross += gross
+		t.Net += net
+		totals[currency] = t
+	}
+
+	res := []Total{}
+	for _, t := range totals {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Currency < res[j].Currency })
+	return res, nil
+}
+
+func (repo *DonationMock) UpdateFrom(d Donation, from string, messages ...outbox.Message) (bool, error) {
+	existing, ok := repo.donations[d.ID]
+	if !ok || existing.Status != from {
+		return false, nil
+	}
+	return true, repo.Update(d, messages...)
+}
+
+func (repo *DonationMock) Update(d Donation, messages ...outbox.Message) error {
+	existing, ok := repo.donations[d.ID]
 	if !ok {
 		return errors.New("Donation not found")
 	}
+	d.AlertSeq = existing.AlertSeq
+	d.AlertAckedAt = existing.AlertAckedAt
+	d.CreatedAt = existing.CreatedAt
+	d.UpdatedAt = time.Now()
+	if d.ModerationStatus == "" {
+		d.ModerationStatus = ModerationStatusNone
+	}
+	if existing.ModerationStatus != ModerationStatusNone {
+		d.ModerationStatus = existing.ModerationStatus
+		d.ReviewDeadline = existing.ReviewDeadline
+	}
+	if d.Status == DonationStatusPayed && !d.AlertSeq.Valid && d.ModerationStatus == ModerationStatusNone {
+		d.AlertSeq = sql.NullInt64{Int64: repo.nextSeq, Valid: true}
+		repo.nextSeq++
+	}
 	repo.donations[d.ID] = d
+	for _, m := range messages {
+		repo.Outbox.Add(m)
+	}
 	return nil
 }
+
+func (repo *DonationMock) Review(d Donation, messages ...outbox.Message) (bool, error) {
+	existing, ok := repo.donations[d.ID]
+	if !ok || existing.StreamerID != d.StreamerID || existing.Status != DonationStatusPayed ||
+		existing.ModerationStatus != ModerationStatusPending {
+		return false, nil
+	}
+	existing.ModerationStatus = d.ModerationStatus
+	existing.Message = d.Message
+	existing.UpdatedAt = time.Now()
+	if d.ModerationStatus == ModerationStatusApproved {
+		existing.AlertSeq = sql.NullInt64{Int64: repo.nextSeq, Valid: true}
+		repo.nextSeq++
+	}
+	repo.donations[d.ID] = existing
+	for _, m := range messages {
+		repo.Outbox.Add(m)
+	}
+	return true, nil
+}
@@ -5,6 +5,8 @@ package donation
 
 import (
 	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
 )
 
 func TestCreateDonation(t *testing.T) {
@@ -125,3 +127,28 @@ func TestGetDonations(t *testing.T) {
 		t.Errorf("GetDonations with filter should return 1 donations, got %d", len(filteredDonations))
 	}
 }
+
+func TestUpdateDonationWithOutbox(t *testing.T) {
+	mockRepo := NewDonationMock()
+
+	donation := Donation{
+		StreamerID: 1,
+		Status:     DonationStatusCreated,
+		PaymentID:  "12345",
+	}
+	mockRepo.Create(&donation)
+
+	donation.Status = DonationStatusPayed
+	message, _ := outbox.NewMessage("DonationPayed", donation)
+	if err := mockRepo.Update(donation, message); err != nil {
+		t.Errorf("Update failed: %v", err)
+	}
+
+	if len(mockRepo.Outbox.Messages) != 1 {
+		t.Fatalf("Update should write 1 outbox message, got %d", len(mockRepo.Outbox.Messages))
+	}
+
+	if mockRepo.Outbox.Messages[0].EventName != "DonationPayed" {
+		t.Errorf("Update wrote wrong event name: %s", mockRepo.Outbox.Messages[0].EventName)
+	}
+}
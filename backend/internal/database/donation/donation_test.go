@@ -4,9 +4,11 @@
 package donation
 
 import (
+	"database/sql"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/blindlobstar/donation-alarm/backend/internal/database"
 	"github.com/jmoiron/sqlx"
@@ -41,9 +43,12 @@ func TestDonationRepoIntegration(t *testing.T) {
 		PaymentID:  "test_payment_id",
 		StreamerID: 1,
 		Amount:     100,
+		Fee:        6,
+		NetAmount:  94,
 		Message:    "Test donation",
 		Name:       "Test User",
 		Status:     DonationStatusCreated,
+		SessionID:  "test_session_id",
 	}
 
 	err = repo.Create(donation)
@@ -101,6 +106,53 @@ func TestDonationRepoIntegration(t *testing.T) {
 		}
 	}
 
+	// Test GetUnsettled finds the created donation, but not after its ID.
+	unsettled, err := repo.GetUnsettled(time.Now().Add(-time.Hour), time.Now().Add(time.Minute), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unsettled) == 0 || unsettled[0].ID != donation.ID {
+		t.Errorf("Expected donation %d to be unsettled, got %+v", donation.ID, unsettled)
+	}
+	if unsettled, err = repo.GetUnsettled(time.Now().Add(-time.Hour), time.Now().Add(time.Minute), donation.ID, 100); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range unsettled {
+		if d.ID <= donation.ID {
+			t.Errorf("Expected donations after %d, got %d", donation.ID, d.ID)
+		}
+	}
+
+	// Test GetAbandoned finds the created donation once it's old enough.
+	abandoned, err := repo.GetAbandoned(time.Now().Add(time.Minute), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(abandoned) == 0 || abandoned[0].ID != donation.ID {
+		t.Errorf("Expected donation %d to be abandoned, got %+v", donation.ID, abandoned)
+	}
+	if abandoned, err = repo.GetAbandoned(time.Now().Add(-time.Hour), 0, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(abandoned) != 0 {
+		t.Errorf("Expected no abandoned donations, got %+v", abandoned)
+	}
+
+	// Test GetPending finds only the session's donation.
+	pending, err := repo.GetPending(1, "test_session_id", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != donation.ID {
+		t.Errorf("Expected donation %d to be pending, got %+v", donation.ID, pending)
+	}
+	if pending, err = repo.GetPending(1, "", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending donations without a session, got %+v", pending)
+	}
+
 	// Test GetDonation by ID.
 	retrievedDonation, err := repo.GetDonation(donation.ID)
 	if err != nil {
@@ -110,8 +162,11 @@ func TestDonationRepoIntegration(t *testing.T) {
 		t.Errorf("Expected donation with ID %d, but got ID %d", donation.ID, retrievedDonation.ID)
 	}
 
-	// Update the status of the donation.
+	// Update the status of the donation and what the donor sent.
 	donation.Status = DonationStatusProcessing
+	donation.FilterAction = "MASK"
+	donation.DonorName = "troll king"
+	donation.DonorEmail = "donor@example.com"
 	err = repo.Update(*donation)
 	if err != nil {
 		t.Fatal(err)
@@ -125,4 +180,155 @@ func TestDonationRepoIntegration(t *testing.T) {
 	if retrievedDonation.Status != DonationStatusProcessing {
 		t.Errorf("Expected status %s, but got %s", DonationStatusProcessing, retrievedDonation.Status)
 	}
+	if retrievedDonation.FilterAction != "MASK" || retrievedDonation.DonorName != "troll king" || retrievedDonation.DonorEmail != "donor@example.com" {
+		t.Errorf("Expected the filter action and donor to be updated, got %+v", retrievedDonation)
+	}
+
+	// Payed donations get an alert sequence number.
+	donation.Status = DonationStatusPayed
+	if err = repo.Update(*donation); err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := repo.GetAlerts(donation.StreamerID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || !alerts[0].AlertSeq.Valid {
+		t.Fatalf("Expected 1 alert with a sequence number, got %+v", alerts)
+	}
+
+	alerts, err = repo.GetAlerts(donation.StreamerID, alerts[0].AlertSeq.Int64, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Expected no alerts after the last seen one, got %d", len(alerts))
+	}
+
+	// Totals are in the home currency the donation was converted to.
+	donation.HomeCurrency = sql.NullString{String: "EUR", Valid: true}
+	donation.HomeAmount = sql.NullInt64{Int64: 50, Valid: true}
+	donation.HomeNetAmount = sql.NullInt64{Int64: 47, Valid: true}
+	donation.ExchangeRate = sql.NullFloat64{Float64: 0.5, Valid: true}
+	if err = repo.Update(*donation); err != nil {
+		t.Fatal(err)
+	}
+	totals, err := repo.GetTotals(donation.StreamerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 1 || totals[0].Currency != "EUR" || totals[0].Gross != 50 || totals[0].Net != 47 {
+		t.Errorf("Expected a total of 50 EUR, 47 EUR net, got %+v", totals)
+	}
+
+	// Refunded donations are not counted in the streamer's totals.
+	// UpdateFrom only refunds the donation while it's still payed.
+	donation.Status = DonationStatusRefunded
+	for i, expected := range []bool{true, false} {
+		updated, err := repo.UpdateFrom(*donation, DonationStatusPayed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != expected {
+			t.Errorf("Expected updated %v on attempt %d, got %v", expected, i+1, updated)
+		}
+	}
+	if totals, err = repo.GetTotals(donation.StreamerID); err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 0 {
+		t.Errorf("Expected no totals after refund, got %+v", totals)
+	}
+
+	// Held donations get an alert sequence number once approved.
+	held := &Donation{
+		PaymentID:       "held_payment_id",
+		StreamerID:      3,
+		Amount:          100,
+		Status:          DonationStatusCreated,
+		FilterAction:    "MODERATE",
+		FilterDecisions: sql.NullString{String: `[{"field":"message","kind":"WORD","action":"MODERATE","match":"bad"}]`, Valid: true},
+	}
+	if err = repo.Create(held); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := repo.GetDonation(held.ID); err != nil || stored.FilterAction != "MODERATE" || !stored.FilterDecisions.Valid {
+		t.Errorf("Expected the filter decisions to be stored, got %+v, %v", stored, err)
+	}
+	if held.ModerationStatus != ModerationStatusNone {
+		t.Errorf("Expected moderation status %s, got %s", ModerationStatusNone, held.ModerationStatus)
+	}
+	held.Status = DonationStatusPayed
+	held.ModerationStatus = ModerationStatusPending
+	held.ReviewDeadline = sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+	if err = repo.Update(*held); err != nil {
+		t.Fatal(err)
+	}
+	if alerts, err = repo.GetAlerts(held.StreamerID, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Expected no alerts for a held donation, got %+v", alerts)
+	}
+	heldDonations, err := repo.GetHeld(held.StreamerID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heldDonations) != 1 || heldDonations[0].ID != held.ID {
+		t.Fatalf("Expected donation %d to be held, got %+v", held.ID, heldDonations)
+	}
+	overdue, err := repo.GetOverdueReviews(time.Now().Add(2*time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overdue) != 1 || overdue[0].ID != held.ID {
+		t.Errorf("Expected donation %d to be overdue, got %+v", held.ID, overdue)
+	}
+
+	held.ModerationStatus = ModerationStatusApproved
+	held.Message = "Edited"
+	if ok, err := repo.Review(*held); err != nil || !ok {
+		t.Fatalf("Expected the donation to be approved, got %v, %v", ok, err)
+	}
+	if ok, err := repo.Review(*held); err != nil || ok {
+		t.Errorf("Expected an approved donation not to be reviewed again, got %v, %v", ok, err)
+	}
+	if alerts, err = repo.GetAlerts(held.StreamerID, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Message != "Edited" {
+		t.Errorf("Expected an alert for the approved donation, got %+v", alerts)
+	}
+
+	// Test CreateForSubscription creates one donation per invoice payment.
+	var subscriptionID int64
+	if err := db.Get(&subscriptionID, `
+		INSERT INTO subscriptions (subscription_id, streamer_id, name, message, amount, currency, net_amount, status)
+		VALUES ('sub_1', 1, 'supporter', '', 500, 'USD', 500, 'ACTIVE') RETURNING id`); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bool{true, false} {
+		d := Donation{
+			PaymentID:      "pi_invoice",
+			StreamerID:     1,
+			Amount:         500,
+			NetAmount:      500,
+			Status:         DonationStatusCreated,
+			SubscriptionID: sql.NullInt64{Int64: subscriptionID, Valid: true},
+		}
+		created, err := repo.CreateForSubscription(&d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != expected {
+			t.Errorf("Attempt %d: expected created to be %v, got %v", i+1, expected, created)
+		}
+	}
+	invoiceDonations, err := repo.GetDonations(&Donation{PaymentID: "pi_invoice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoiceDonations) != 1 || invoiceDonations[0].Month != 1 {
+		t.Errorf("Expected one donation of month 1, got %+v", invoiceDonations)
+	}
 }
@@ -0,0 +1,46 @@
+package donation
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidTransition = errors.New("invalid donation status transition")
+
+// transitions lists the statuses a donation may move to from each status.
+// A failed payment can be retried with another payment method,
+// a payed donation can only be refunded or disputed. Abandoned donations expire.
+var transitions = map[string][]string{
+	DonationStatusCreated:     {DonationStatusProcessing, DonationStatusPayed, DonationStatusFailed, DonationStatusCanceled, DonationStatusExpired},
+	DonationStatusProcessing:  {DonationStatusPayed, DonationStatusFailed, DonationStatusCanceled},
+	DonationStatusFailed:      {DonationStatusProcessing, DonationStatusPayed, DonationStatusCanceled, DonationStatusExpired},
+	DonationStatusPayed:       {DonationStatusRefunded, DonationStatusDisputed},
+	DonationStatusDisputed:    {DonationStatusPayed, DonationStatusDisputeLost, DonationStatusRefunded},
+	DonationStatusCanceled:    {},
+	DonationStatusExpired:     {},
+	DonationStatusRefunded:    {},
+	DonationStatusDisputeLost: {},
+}
+
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves d to status. It reports false without an error
+// if d already has the status, e.g. when a webhook is delivered twice.
+func (d *Donation) Transition(status string) (bool, error) {
+	if d.Status == status {
+		return false, nil
+	}
+	if !CanTransition(d.Status, status) {
+		return false, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, d.Status, status)
+	}
+
+	d.Status = status
+	return true, nil
+}
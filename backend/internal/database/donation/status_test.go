@@ -0,0 +1,49 @@
+//go:build unit
+// +build unit
+
+package donation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransition(t *testing.T) {
+	cases := []struct {
+		from    string
+		to      string
+		changed bool
+		err     error
+	}{
+		{DonationStatusCreated, DonationStatusProcessing, true, nil},
+		{DonationStatusCreated, DonationStatusPayed, true, nil},
+		{DonationStatusProcessing, DonationStatusFailed, true, nil},
+		{DonationStatusFailed, DonationStatusPayed, true, nil},
+		{DonationStatusPayed, DonationStatusPayed, false, nil},
+		{DonationStatusPayed, DonationStatusProcessing, false, ErrInvalidTransition},
+		{DonationStatusPayed, DonationStatusFailed, false, ErrInvalidTransition},
+		{DonationStatusCanceled, DonationStatusPayed, false, ErrInvalidTransition},
+		{DonationStatusCreated, DonationStatusExpired, true, nil},
+		{DonationStatusFailed, DonationStatusExpired, true, nil},
+		{DonationStatusProcessing, DonationStatusExpired, false, ErrInvalidTransition},
+		{DonationStatusExpired, DonationStatusCanceled, false, ErrInvalidTransition},
+		{DonationStatusPayed, DonationStatusRefunded, true, nil},
+		{DonationStatusPayed, DonationStatusDisputed, true, nil},
+		{DonationStatusDisputed, DonationStatusPayed, true, nil},
+		{DonationStatusDisputed, DonationStatusDisputeLost, true, nil},
+		{DonationStatusCreated, DonationStatusRefunded, false, ErrInvalidTransition},
+		{DonationStatusRefunded, DonationStatusPayed, false, ErrInvalidTransition},
+		{DonationStatusDisputeLost, DonationStatusPayed, false, ErrInvalidTransition},
+	}
+
+	for _, tc := range cases {
+		d := Donation{Status: tc.from}
+		changed, err := d.Transition(tc.to)
+		if changed != tc.changed || !errors.Is(err, tc.err) {
+			t.Errorf("%s -> %s: expected (%v, %v), got (%v, %v)", tc.from, tc.to, tc.changed, tc.err, changed, err)
+		}
+		if err != nil && d.Status != tc.from {
+			t.Errorf("%s -> %s: status changed on invalid transition", tc.from, tc.to)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+-- Drop the outbox table
+DROP TABLE outbox;
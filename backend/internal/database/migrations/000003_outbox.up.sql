@@ -0,0 +1,11 @@
+-- Create the outbox table
+CREATE TABLE outbox (
+    id SERIAL PRIMARY KEY,
+    event_name VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX outbox_undelivered_idx ON outbox (id) WHERE delivered_at IS NULL;
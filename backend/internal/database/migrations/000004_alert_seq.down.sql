@@ -0,0 +1,6 @@
+-- Drop alert sequence numbers
+DROP INDEX donations_alert_seq_idx;
+
+ALTER TABLE donations DROP COLUMN alert_seq;
+
+DROP SEQUENCE donation_alert_seq;
@@ -0,0 +1,6 @@
+-- Number paid donations in the order their alerts are shown
+CREATE SEQUENCE donation_alert_seq;
+
+ALTER TABLE donations ADD COLUMN alert_seq BIGINT;
+
+CREATE INDEX donations_alert_seq_idx ON donations (streamer_id, alert_seq) WHERE alert_seq IS NOT NULL;
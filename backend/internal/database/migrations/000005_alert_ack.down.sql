@@ -0,0 +1,2 @@
+-- Forget alert acknowledgements
+ALTER TABLE donations DROP COLUMN alert_acked_at;
@@ -0,0 +1,2 @@
+-- Remember which alerts the overlay has shown
+ALTER TABLE donations ADD COLUMN alert_acked_at TIMESTAMP;
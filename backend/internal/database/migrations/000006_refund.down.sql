@@ -0,0 +1,2 @@
+-- Forget refunds issued by streamers
+ALTER TABLE donations DROP COLUMN refund_id, DROP COLUMN refund_reason;
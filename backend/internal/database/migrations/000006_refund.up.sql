@@ -0,0 +1,2 @@
+-- Remember refunds issued by streamers
+ALTER TABLE donations ADD COLUMN refund_id VARCHAR(255), ADD COLUMN refund_reason TEXT;
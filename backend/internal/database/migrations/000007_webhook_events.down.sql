@@ -0,0 +1,2 @@
+-- Drop the webhook events table
+DROP TABLE webhook_events;
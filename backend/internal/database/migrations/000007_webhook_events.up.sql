@@ -0,0 +1,14 @@
+-- Keep every received webhook event, so retries are processed once
+CREATE TABLE webhook_events (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(255) NOT NULL,
+    error TEXT,
+    attempts INT NOT NULL DEFAULT 1,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX webhook_events_status_idx ON webhook_events (status, received_at);
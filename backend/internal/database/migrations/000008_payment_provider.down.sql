@@ -0,0 +1,6 @@
+-- Forget payment providers
+ALTER TABLE webhook_events DROP CONSTRAINT webhook_events_pkey;
+ALTER TABLE webhook_events ADD PRIMARY KEY (id);
+ALTER TABLE webhook_events DROP COLUMN provider;
+
+ALTER TABLE donations DROP COLUMN provider;
@@ -0,0 +1,6 @@
+-- Remember which payment provider handled donations and webhook events
+ALTER TABLE donations ADD COLUMN provider VARCHAR(255) NOT NULL DEFAULT 'stripe';
+
+ALTER TABLE webhook_events ADD COLUMN provider VARCHAR(255) NOT NULL DEFAULT 'stripe';
+ALTER TABLE webhook_events DROP CONSTRAINT webhook_events_pkey;
+ALTER TABLE webhook_events ADD PRIMARY KEY (provider, id);
@@ -0,0 +1,4 @@
+-- Accept donations in USD only
+ALTER TABLE donations DROP COLUMN currency;
+
+ALTER TABLE streamers DROP COLUMN default_currency, DROP COLUMN currencies;
@@ -0,0 +1,6 @@
+-- Let streamers accept donations in several currencies
+ALTER TABLE streamers
+    ADD COLUMN default_currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    ADD COLUMN currencies TEXT NOT NULL DEFAULT 'USD';
+
+ALTER TABLE donations ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,2 @@
+-- Forget exchange rate snapshots
+ALTER TABLE donations DROP COLUMN home_currency, DROP COLUMN home_amount, DROP COLUMN exchange_rate;
@@ -0,0 +1,5 @@
+-- Snapshot the exchange rate to the streamer's home currency when a donation is payed
+ALTER TABLE donations
+    ADD COLUMN home_currency VARCHAR(3),
+    ADD COLUMN home_amount INT,
+    ADD COLUMN exchange_rate DOUBLE PRECISION;
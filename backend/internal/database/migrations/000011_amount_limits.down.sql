@@ -0,0 +1,4 @@
+-- Forget donation amount limits
+ALTER TABLE streamers DROP COLUMN min_amount, DROP COLUMN max_amount, DROP COLUMN locale;
+
+ALTER TABLE donations ALTER COLUMN amount TYPE INT, ALTER COLUMN home_amount TYPE INT;
@@ -0,0 +1,7 @@
+-- Store amounts in minor units as BIGINT and let streamers limit donation amounts
+ALTER TABLE donations ALTER COLUMN amount TYPE BIGINT, ALTER COLUMN home_amount TYPE BIGINT;
+
+ALTER TABLE streamers
+    ADD COLUMN min_amount BIGINT NOT NULL DEFAULT 100,
+    ADD COLUMN max_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT 'en-US';
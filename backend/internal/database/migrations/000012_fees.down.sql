@@ -0,0 +1,6 @@
+-- Forget donation fees
+ALTER TABLE donations
+    DROP COLUMN fee,
+    DROP COLUMN net_amount,
+    DROP COLUMN fees_covered,
+    DROP COLUMN home_net_amount;
@@ -0,0 +1,10 @@
+-- Store the processing fee and what the streamer receives separately from what the donor paid
+ALTER TABLE donations
+    ADD COLUMN fee BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN net_amount BIGINT,
+    ADD COLUMN fees_covered BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN home_net_amount BIGINT;
+
+UPDATE donations SET net_amount = amount, home_net_amount = home_amount;
+
+ALTER TABLE donations ALTER COLUMN net_amount SET NOT NULL;
@@ -0,0 +1,4 @@
+-- Forget payout accounts
+DROP INDEX IF EXISTS streamers_payout_account_id_idx;
+
+ALTER TABLE streamers DROP COLUMN payout_account_id, DROP COLUMN onboarding_status;
@@ -0,0 +1,6 @@
+-- Pay donations out to the streamer's own payment provider account
+ALTER TABLE streamers
+    ADD COLUMN payout_account_id VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN onboarding_status VARCHAR(20) NOT NULL DEFAULT 'NONE';
+
+CREATE UNIQUE INDEX streamers_payout_account_id_idx ON streamers (payout_account_id) WHERE payout_account_id <> '';
@@ -0,0 +1,4 @@
+-- Forget recurring donations
+ALTER TABLE donations DROP COLUMN subscription_id, DROP COLUMN month;
+
+DROP TABLE IF EXISTS subscriptions;
@@ -0,0 +1,25 @@
+-- Let supporters donate monthly, every payed invoice is stored as a donation
+CREATE TABLE subscriptions (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL DEFAULT 'stripe',
+    subscription_id VARCHAR(255) NOT NULL,
+    streamer_id INT NOT NULL REFERENCES streamers(id),
+    name TEXT NOT NULL,
+    message TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    fee BIGINT NOT NULL DEFAULT 0,
+    net_amount BIGINT NOT NULL,
+    fees_covered BOOLEAN NOT NULL DEFAULT false,
+    status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    canceled_at TIMESTAMP,
+    UNIQUE (provider, subscription_id)
+);
+
+CREATE INDEX subscriptions_streamer_id_idx ON subscriptions (streamer_id, status);
+
+ALTER TABLE donations
+    ADD COLUMN subscription_id INT REFERENCES subscriptions(id),
+    ADD COLUMN month INT NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Forget reconciliation
+DROP TABLE IF EXISTS payment_mismatches;
+
+DROP INDEX IF EXISTS donations_status_created_at_idx;
+
+ALTER TABLE donations DROP COLUMN created_at, DROP COLUMN updated_at;
@@ -0,0 +1,19 @@
+-- Track when donations change, so the reconciler finds the ones left unsettled
+ALTER TABLE donations
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX donations_status_created_at_idx ON donations (status, created_at);
+
+-- Differences between donations and what the payment provider reports
+CREATE TABLE payment_mismatches (
+    id SERIAL PRIMARY KEY,
+    donation_id INT NOT NULL REFERENCES donations(id),
+    payment_id VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    expected TEXT NOT NULL,
+    actual TEXT NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (donation_id, kind, actual)
+);
@@ -0,0 +1,4 @@
+-- Forget donation page sessions
+DROP INDEX IF EXISTS donations_session_id_idx;
+
+ALTER TABLE donations DROP COLUMN session_id;
@@ -0,0 +1,4 @@
+-- Remember the donation page session, so a reloaded page reuses its pending payment
+ALTER TABLE donations ADD COLUMN session_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX donations_session_id_idx ON donations (session_id) WHERE session_id <> '' AND status = 'CREATED';
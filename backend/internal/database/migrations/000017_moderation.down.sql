@@ -0,0 +1,7 @@
+-- Forget donation moderation
+DROP INDEX IF EXISTS donations_review_deadline_idx;
+DROP INDEX IF EXISTS donations_held_idx;
+
+ALTER TABLE donations DROP COLUMN moderation_status, DROP COLUMN review_deadline;
+
+ALTER TABLE streamers DROP COLUMN hold_for_review, DROP COLUMN auto_approve_seconds;
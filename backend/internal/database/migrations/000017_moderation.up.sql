@@ -0,0 +1,11 @@
+-- Let streamers hold donation messages for review before they are shown
+ALTER TABLE streamers
+    ADD COLUMN hold_for_review BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN auto_approve_seconds INT NOT NULL DEFAULT 0;
+
+ALTER TABLE donations
+    ADD COLUMN moderation_status VARCHAR(16) NOT NULL DEFAULT 'NONE',
+    ADD COLUMN review_deadline TIMESTAMP;
+
+CREATE INDEX donations_held_idx ON donations (streamer_id, id) WHERE moderation_status = 'PENDING';
+CREATE INDEX donations_review_deadline_idx ON donations (review_deadline) WHERE moderation_status = 'PENDING';
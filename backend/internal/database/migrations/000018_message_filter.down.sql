@@ -0,0 +1,6 @@
+-- Forget message filters
+ALTER TABLE subscriptions DROP COLUMN filter_action, DROP COLUMN filter_decisions;
+
+ALTER TABLE donations DROP COLUMN filter_action, DROP COLUMN filter_decisions;
+
+ALTER TABLE streamers DROP COLUMN filter_settings;
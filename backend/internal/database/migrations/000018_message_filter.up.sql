@@ -0,0 +1,10 @@
+-- Filter donation names and messages with the streamer's rules and keep what the filter decided
+ALTER TABLE streamers ADD COLUMN filter_settings TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE donations
+    ADD COLUMN filter_action VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN filter_decisions JSONB;
+
+ALTER TABLE subscriptions
+    ADD COLUMN filter_action VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN filter_decisions JSONB;
@@ -0,0 +1,11 @@
+-- Forget blocked donors
+ALTER TABLE subscriptions DROP COLUMN donor_name, DROP COLUMN donor_email, DROP COLUMN donor_ip;
+
+ALTER TABLE donations
+    DROP COLUMN donor_name,
+    DROP COLUMN donor_email,
+    DROP COLUMN donor_ip,
+    DROP COLUMN customer_id,
+    DROP COLUMN card_fingerprint;
+
+DROP TABLE IF EXISTS blocked_donors;
@@ -0,0 +1,23 @@
+-- Let streamers block donors by name, email, IP or what the payment provider knows about them
+CREATE TABLE blocked_donors (
+    id SERIAL PRIMARY KEY,
+    streamer_id INT NOT NULL REFERENCES streamers(id),
+    kind VARCHAR(16) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    donation_id INT REFERENCES donations(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (streamer_id, kind, value)
+);
+
+ALTER TABLE donations
+    ADD COLUMN donor_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN donor_email VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN donor_ip VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN customer_id VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN card_fingerprint VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE subscriptions
+    ADD COLUMN donor_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN donor_email VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN donor_ip VARCHAR(64) NOT NULL DEFAULT '';
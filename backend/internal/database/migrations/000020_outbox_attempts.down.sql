@@ -0,0 +1,5 @@
+-- Deliver outbox messages until they succeed again
+DROP INDEX outbox_undelivered_idx;
+CREATE INDEX outbox_undelivered_idx ON outbox (id) WHERE delivered_at IS NULL;
+
+ALTER TABLE outbox DROP COLUMN attempts, DROP COLUMN handled_by, DROP COLUMN parked_at;
@@ -0,0 +1,8 @@
+-- Retry failed outbox messages with backoff, only for the subscribers that failed, and park them after too many attempts
+ALTER TABLE outbox
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN handled_by TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN parked_at TIMESTAMP;
+
+DROP INDEX outbox_undelivered_idx;
+CREATE INDEX outbox_undelivered_idx ON outbox (id) WHERE delivered_at IS NULL AND parked_at IS NULL;
@@ -0,0 +1,2 @@
+-- Allow more than one donation per subscription invoice
+DROP INDEX IF EXISTS donations_subscription_payment_idx;
@@ -0,0 +1,2 @@
+-- Create a subscription's donation once per invoice, retried webhooks only pay it
+CREATE UNIQUE INDEX donations_subscription_payment_idx ON donations (subscription_id, payment_id) WHERE subscription_id IS NOT NULL;
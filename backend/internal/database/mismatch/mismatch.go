@@ -0,0 +1,71 @@
+package mismatch
+
+import (
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+)
+
+// Mismatch is a difference between a donation and its payment at the provider.
+// Each difference is recorded once.
+type Mismatch struct {
+	ID         int    `db:"id"`
+	DonationID int    `db:"donation_id"`
+	PaymentID  string `db:"payment_id"`
+	Kind       string `db:"kind"`
+	// Expected is the donation's value and Actual the provider's.
+	Expected string `db:"expected"`
+	Actual   string `db:"actual"`
+	// Source is what found the mismatch.
+	Source    string    `db:"source"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const (
+	// KindAmount is a payment of another amount than the donation.
+	KindAmount = "AMOUNT"
+	// KindStatus is a donation whose status change was missed, the status is fixed.
+	KindStatus = "STATUS"
+	// KindMissing is a donation the provider has no payment for.
+	KindMissing = "MISSING"
+)
+
+const (
+	SourceWebhook    = "WEBHOOK"
+	SourceReconciler = "RECONCILER"
+	SourceSweeper    = "SWEEPER"
+)
+
+type MismatchRepo interface {
+	// Create records m. It reports false if the mismatch was already recorded.
+	Create(m *Mismatch) (bool, error)
+	// GetMismatches returns the last limit mismatches, newest first.
+	GetMismatches(limit int) ([]Mismatch, error)
+}
+
+type Repo struct {
+	database.Repo
+}
+
+func (r Repo) Create(m *Mismatch) (bool, error) {
+	rows, err := r.DB.Query(`
+		INSERT INTO payment_mismatches (donation_id, payment_id, kind, expected, actual, source)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (donation_id, kind, actual) DO NOTHING
+		RETURNING id, created_at`, m.DonationID, m.PaymentID, m.Kind, m.Expected, m.Actual, m.Source)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	return true, rows.Scan(&m.ID, &m.CreatedAt)
+}
+
+func (r Repo) GetMismatches(limit int) ([]Mismatch, error) {
+	res := []Mismatch{}
+	err := r.DB.Select(&res, "SELECT * FROM payment_mismatches ORDER BY created_at DESC, id DESC LIMIT $1", limit)
+	return res, err
+}
@@ -0,0 +1,27 @@
+package mismatch
+
+import "time"
+
+type MismatchMock struct {
+	Mismatches []Mismatch
+}
+
+func (repo *MismatchMock) Create(m *Mismatch) (bool, error) {
+	for _, existing := range repo.Mismatches {
+		if existing.DonationID == m.DonationID && existing.Kind == m.Kind && existing.Actual == m.Actual {
+			return false, nil
+		}
+	}
+	m.ID = len(repo.Mismatches) + 1
+	m.CreatedAt = time.Now()
+	repo.Mismatches = append(repo.Mismatches, *m)
+	return true, nil
+}
+
+func (repo *MismatchMock) GetMismatches(limit int) ([]Mismatch, error) {
+	res := []Mismatch{}
+	for i := len(repo.Mismatches) - 1; i >= 0 && len(res) < limit; i-- {
+		res = append(res, repo.Mismatches[i])
+	}
+	return res, nil
+}
@@ -0,0 +1,62 @@
+//go:build integration
+// +build integration
+
+package mismatch
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestMismatchRepoIntegration(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("BACKEND__CONNECTION_STRING"))
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer db.Close()
+	repo := Repo{Repo: database.Repo{DB: db}}
+	repo.Migrate()
+	db.Exec("DELETE FROM payment_mismatches")
+
+	streamers := streamer.Repo{Repo: repo.Repo}
+	st := streamer.Streamer{TwitchId: "mismatchTwitchId", TwitchName: "mismatchTwitchName", SecretCode: "mismatchSecret"}
+	if err := streamers.CreateStreamer(&st); err != nil {
+		t.Fatal(err)
+	}
+	donations := donation.Repo{Repo: repo.Repo}
+	d := donation.Donation{PaymentID: "pi_mismatch", StreamerID: st.ID, Amount: 500, Currency: "USD", Status: donation.DonationStatusCreated}
+	if err := donations.Create(&d); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test Create records a mismatch once
+	m := Mismatch{DonationID: d.ID, PaymentID: d.PaymentID, Kind: KindAmount, Expected: "500", Actual: "400", Source: SourceWebhook}
+	for i, expected := range []bool{true, false} {
+		created, err := repo.Create(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != expected {
+			t.Errorf("Expected created %v on attempt %d, got %v", expected, i+1, created)
+		}
+	}
+
+	// Test GetMismatches
+	mismatches, err := repo.GetMismatches(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Actual != "400" || mismatches[0].Source != SourceWebhook {
+		t.Errorf("Expected the amount mismatch, got %+v", mismatches)
+	}
+
+	db.Exec("DELETE FROM payment_mismatches")
+	db.Exec("DELETE FROM donations WHERE id = $1", d.ID)
+	db.Exec("DELETE FROM streamers WHERE id = $1", st.ID)
+}
@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Message is an event waiting to be delivered to the event bus.
+// Messages are written in the same transaction as the state change
+// that produced them, so an event is never lost once the change is committed.
+type Message struct {
+	EventName   string       `db:"event_name"`
+	Payload     []byte       `db:"payload"`
+	CreatedAt   time.Time    `db:"created_at"`
+	LockedUntil sql.NullTime `db:"locked_until"`
+	DeliveredAt sql.NullTime `db:"delivered_at"`
+	// Attempts counts the failed deliveries, HandledBy are the subscribers
+	// that handled the message in one of them.
+	Attempts  int            `db:"attempts"`
+	HandledBy pq.StringArray `db:"handled_by"`
+	// ParkedAt is set once the message failed too often, it's not delivered anymore.
+	ParkedAt sql.NullTime `db:"parked_at"`
+	ID       int
+}
+
+type OutboxRepo interface {
+	// Claim locks up to limit undelivered messages for lease duration
+	// and returns them ordered by ID.
+	Claim(limit int, lease time.Duration) ([]Message, error)
+	MarkDelivered(id int) error
+	// Retry records a failed delivery of the message, which is claimed again after retryIn.
+	// handledBy are the subscribers that handled it so far.
+	Retry(id int, handledBy []string, retryIn time.Duration) error
+	// Park records a failed delivery of the message and stops delivering it.
+	Park(id int, handledBy []string) error
+}
+
+type Repo struct {
+	database.Repo
+}
+
+func NewMessage(eventName string, payload any) (Message, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		EventName: eventName,
+		Payload:   data,
+	}, nil
+}
+
+// Insert writes messages as part of tx.
+func Insert(tx *sqlx.Tx, messages ...Message) error {
+	for _, m := range messages {
+		if _, err := tx.Exec("INSERT INTO outbox (event_name, payload) VALUES ($1, $2)", m.EventName, m.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Repo) Claim(limit int, lease time.Duration) ([]Message, error) {
+	res := []Message{}
+	err := r.DB.Select(&res, `
+		UPDATE outbox
+		SET locked_until = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE delivered_at IS NULL AND parked_at IS NULL AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (r Repo) MarkDelivered(id int) error {
+	_, err := r.DB.Exec("UPDATE outbox SET delivered_at = NOW(), locked_until = NULL WHERE id = $1", id)
+	return err
+}
+
+func (r Repo) Retry(id int, handledBy []string, retryIn time.Duration) error {
+	_, err := r.DB.Exec(`
+		UPDATE outbox
+		SET attempts = attempts + 1, handled_by = $2, locked_until = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1`, id, pq.StringArray(handledBy), retryIn.Milliseconds())
+	return err
+}
+
+func (r Repo) Park(id int, handledBy []string) error {
+	_, err := r.DB.Exec(`
+		UPDATE outbox
+		SET attempts = attempts + 1, handled_by = $2, parked_at = NOW(), locked_until = NULL
+		WHERE id = $1`, id, pq.StringArray(handledBy))
+	return err
+}
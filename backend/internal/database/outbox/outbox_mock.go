@@ -0,0 +1,69 @@
+package outbox
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type OutboxMock struct {
+	Messages []Message
+}
+
+func (om *OutboxMock) Add(m Message) {
+	m.ID = len(om.Messages) + 1
+	om.Messages = append(om.Messages, m)
+}
+
+func (om *OutboxMock) Claim(limit int, lease time.Duration) ([]Message, error) {
+	res := []Message{}
+	now := time.Now()
+	for i := range om.Messages {
+		if len(res) == limit {
+			break
+		}
+		m := &om.Messages[i]
+		if m.DeliveredAt.Valid || m.ParkedAt.Valid || (m.LockedUntil.Valid && m.LockedUntil.Time.After(now)) {
+			continue
+		}
+		m.LockedUntil = sql.NullTime{Time: now.Add(lease), Valid: true}
+		res = append(res, *m)
+	}
+	return res, nil
+}
+
+func (om *OutboxMock) MarkDelivered(id int) error {
+	for i := range om.Messages {
+		if om.Messages[i].ID == id {
+			om.Messages[i].DeliveredAt = sql.NullTime{Time: time.Now(), Valid: true}
+			om.Messages[i].LockedUntil = sql.NullTime{}
+			return nil
+		}
+	}
+	return errors.New("Message not found")
+}
+
+func (om *OutboxMock) Retry(id int, handledBy []string, retryIn time.Duration) error {
+	for i := range om.Messages {
+		if om.Messages[i].ID == id {
+			om.Messages[i].Attempts++
+			om.Messages[i].HandledBy = append([]string{}, handledBy...)
+			om.Messages[i].LockedUntil = sql.NullTime{Time: time.Now().Add(retryIn), Valid: true}
+			return nil
+		}
+	}
+	return errors.New("Message not found")
+}
+
+func (om *OutboxMock) Park(id int, handledBy []string) error {
+	for i := range om.Messages {
+		if om.Messages[i].ID == id {
+			om.Messages[i].Attempts++
+			om.Messages[i].HandledBy = append([]string{}, handledBy...)
+			om.Messages[i].ParkedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			om.Messages[i].LockedUntil = sql.NullTime{}
+			return nil
+		}
+	}
+	return errors.New("Message not found")
+}
@@ -0,0 +1,99 @@
+//go:build integration
+// +build integration
+
+package outbox
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestOutboxRepoIntegration(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("BACKEND__CONNECTION_STRING"))
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer db.Close()
+	repo := Repo{Repo: database.Repo{DB: db}}
+	repo.Migrate()
+	db.Exec("DELETE FROM outbox")
+
+	// Test Insert
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := NewMessage("DonationPayed", map[string]int{"DonationID": 1})
+	second, _ := NewMessage("DonationPayed", map[string]int{"DonationID": 2})
+	if err := Insert(tx, first, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test Claim
+	messages, err := repo.Claim(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	if messages[0].ID > messages[1].ID {
+		t.Errorf("Expected messages ordered by ID, got %d before %d", messages[0].ID, messages[1].ID)
+	}
+
+	// Claimed messages are not returned again until the lease expires
+	claimed, err := repo.Claim(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Errorf("Expected 0 messages while leased, got %d", len(claimed))
+	}
+
+	// Test MarkDelivered
+	if err := repo.MarkDelivered(messages[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("UPDATE outbox SET locked_until = NULL")
+	messages, err = repo.Claim(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 undelivered message, got %d", len(messages))
+	}
+
+	// Test Retry
+	if err := repo.Retry(messages[0].ID, []string{"overlay"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("UPDATE outbox SET locked_until = NULL")
+	messages, err = repo.Claim(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Attempts != 1 || len(messages[0].HandledBy) != 1 || messages[0].HandledBy[0] != "overlay" {
+		t.Fatalf("Expected the retried message with its handlers, got %+v", messages)
+	}
+
+	// Test Park
+	if err := repo.Park(messages[0].ID, messages[0].HandledBy); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("UPDATE outbox SET locked_until = NULL")
+	messages, err = repo.Claim(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("Expected parked messages not to be claimed, got %d", len(messages))
+	}
+}
@@ -2,21 +2,83 @@ package streamer
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/blindlobstar/donation-alarm/backend/internal/database"
 )
 
 type Streamer struct {
-	ID         int
-	TwitchId   string `db:"twitch_id"`
-	TwitchName string `db:"twitch_name"`
-	SecretCode string `db:"secret_code"`
+	ID              int
+	TwitchId        string `db:"twitch_id"`
+	TwitchName      string `db:"twitch_name"`
+	SecretCode      string `db:"secret_code"`
+	DefaultCurrency string `db:"default_currency"`
+	// Currencies is the comma separated list of currencies the streamer accepts.
+	Currencies string `db:"currencies"`
+	// MinAmount and MaxAmount limit donations, in the minor unit of DefaultCurrency.
+	// A zero MaxAmount means no limit.
+	MinAmount int64 `db:"min_amount"`
+	MaxAmount int64 `db:"max_amount"`
+	// Locale is used to format amounts on the overlay.
+	Locale string `db:"locale"`
+	// PayoutAccountID is the streamer's account at the payment provider donations are payed out to.
+	PayoutAccountID  string `db:"payout_account_id"`
+	OnboardingStatus string `db:"onboarding_status"`
+	// HoldForReview keeps payed donations off the overlay until the streamer approves them,
+	// they are approved automatically after AutoApproveSeconds unless it's zero.
+	HoldForReview      bool `db:"hold_for_review"`
+	AutoApproveSeconds int  `db:"auto_approve_seconds"`
+	// FilterSettings are the rules donation names and messages are filtered with, as JSON.
+	// The default rules apply while it's empty.
+	FilterSettings string `db:"filter_settings"`
+}
+
+const (
+	// OnboardingStatusNone is set until the streamer starts onboarding.
+	OnboardingStatusNone    = "NONE"
+	OnboardingStatusPending = "PENDING"
+	// OnboardingStatusRestricted is set when the provider needs more details
+	// from an onboarded streamer before payouts are enabled again.
+	OnboardingStatusRestricted = "RESTRICTED"
+	OnboardingStatusEnabled    = "ENABLED"
+)
+
+// PayoutsEnabled reports whether donations can be payed out to the streamer.
+func (s Streamer) PayoutsEnabled() bool {
+	return s.PayoutAccountID != "" && s.OnboardingStatus == OnboardingStatusEnabled
+}
+
+// AcceptedCurrencies returns the currencies the streamer accepts donations in.
+func (s Streamer) AcceptedCurrencies() []string {
+	if s.Currencies == "" {
+		return nil
+	}
+	return strings.Split(s.Currencies, ",")
+}
+
+func (s Streamer) AcceptsCurrency(currency string) bool {
+	for _, c := range s.AcceptedCurrencies() {
+		if c == currency {
+			return true
+		}
+	}
+	return false
 }
 
 type StreamerRepo interface {
 	CreateStreamer(s *Streamer) error
 	GetStreamers(s Streamer) ([]Streamer, error)
 	GetStreamerById(id int) (*Streamer, error)
+	// UpdateCurrencies sets the currencies the streamer accepts, defaultCurrency must be one of them.
+	UpdateCurrencies(id int, defaultCurrency string, currencies []string) error
+	UpdateDonationSettings(id int, minAmount int64, maxAmount int64, locale string) error
+	UpdateModerationSettings(id int, holdForReview bool, autoApproveSeconds int) error
+	UpdateFilterSettings(id int, filterSettings string) error
+	// SetPayoutAccount links the streamer to a new payout account that is pending onboarding.
+	SetPayoutAccount(id int, accountID string) error
+	// UpdateOnboardingStatus sets the status of the streamer with the payout account,
+	// it returns false if there is no such streamer.
+	UpdateOnboardingStatus(accountID string, status string) (bool, error)
 }
 
 type Repo struct {
@@ -24,8 +86,13 @@ type Repo struct {
 }
 
 func (r Repo) CreateStreamer(s *Streamer) error {
-	_, err := r.DB.Exec("INSERT INTO streamers (twitch_id, twitch_name, secret_code) VALUES ($1, $2, $3)", s.TwitchId, s.TwitchName, s.SecretCode)
-	return err
+	return r.DB.QueryRowx(
+		`INSERT INTO streamers (twitch_id, twitch_name, secret_code) VALUES ($1, $2, $3)
+		RETURNING id, default_currency, currencies, min_amount, max_amount, locale, payout_account_id, onboarding_status,
+			hold_for_review, auto_approve_seconds, filter_settings`,
+		s.TwitchId, s.TwitchName, s.SecretCode,
+	).Scan(&s.ID, &s.DefaultCurrency, &s.Currencies, &s.MinAmount, &s.MaxAmount, &s.Locale, &s.PayoutAccountID, &s.OnboardingStatus,
+		&s.HoldForReview, &s.AutoApproveSeconds, &s.FilterSettings)
 }
 
 func (r Repo) GetStreamers(s Streamer) ([]Streamer, error) {
@@ -64,3 +131,42 @@ func (r Repo) GetStreamerById(id int) (*Streamer, error) {
 
 	return res, err
 }
+
+func (r Repo) UpdateCurrencies(id int, defaultCurrency string, currencies []string) error {
+	_, err := r.DB.Exec("UPDATE streamers SET default_currency = $1, currencies = $2 WHERE id = $3",
+		defaultCurrency, strings.Join(currencies, ","), id)
+	return err
+}
+
+func (r Repo) UpdateDonationSettings(id int, minAmount int64, maxAmount int64, locale string) error {
+	_, err := r.DB.Exec("UPDATE streamers SET min_amount = $1, max_amount = $2, locale = $3 WHERE id = $4",
+		minAmount, maxAmount, locale, id)
+	return err
+}
+
+func (r Repo) UpdateModerationSettings(id int, holdForReview bool, autoApproveSeconds int) error {
+	_, err := r.DB.Exec("UPDATE streamers SET hold_for_review = $1, auto_approve_seconds = $2 WHERE id = $3",
+		holdForReview, autoApproveSeconds, id)
+	return err
+}
+
+func (r Repo) UpdateFilterSettings(id int, filterSettings string) error {
+	_, err := r.DB.Exec("UPDATE streamers SET filter_settings = $1 WHERE id = $2", filterSettings, id)
+	return err
+}
+
+func (r Repo) SetPayoutAccount(id int, accountID string) error {
+	_, err := r.DB.Exec("UPDATE streamers SET payout_account_id = $1, onboarding_status = $2 WHERE id = $3",
+		accountID, OnboardingStatusPending, id)
+	return err
+}
+
+func (r Repo) UpdateOnboardingStatus(accountID string, status string) (bool, error) {
+	res, err := r.DB.Exec("UPDATE streamers SET onboarding_status = $1 WHERE payout_account_id = $2 AND payout_account_id <> ''",
+		status, accountID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -1,11 +1,25 @@
 package streamer
 
+import (
+	"errors"
+	"strings"
+)
+
 type StreamerMock struct {
 	Streamers []Streamer
 }
 
 func (sm *StreamerMock) CreateStreamer(s *Streamer) error {
 	s.ID = len(sm.Streamers)
+	if s.DefaultCurrency == "" {
+		s.DefaultCurrency = "USD"
+		s.Currencies = "USD"
+		s.MinAmount = 100
+		s.Locale = "en-US"
+	}
+	if s.OnboardingStatus == "" {
+		s.OnboardingStatus = OnboardingStatusNone
+	}
 	sm.Streamers = append(sm.Streamers, *s)
 
 	return nil
@@ -43,13 +57,88 @@ func (sm *StreamerMock) GetStreamerById(id int) (*Streamer, error) {
 	for _, s := range sm.Streamers {
 		if s.ID == id {
 			return &Streamer{
-				ID:         id,
-				TwitchId:   s.TwitchId,
-				TwitchName: s.TwitchName,
-				SecretCode: s.SecretCode,
+				ID:                 id,
+				TwitchId:           s.TwitchId,
+				TwitchName:         s.TwitchName,
+				SecretCode:         s.SecretCode,
+				DefaultCurrency:    s.DefaultCurrency,
+				Currencies:         s.Currencies,
+				MinAmount:          s.MinAmount,
+				MaxAmount:          s.MaxAmount,
+				Locale:             s.Locale,
+				PayoutAccountID:    s.PayoutAccountID,
+				OnboardingStatus:   s.OnboardingStatus,
+				HoldForReview:      s.HoldForReview,
+				AutoApproveSeconds: s.AutoApproveSeconds,
+				FilterSettings:     s.FilterSettings,
 			}, nil
 		}
 	}
 
 	return nil, nil
 }
+
+func (sm *StreamerMock) UpdateCurrencies(id int, defaultCurrency string, currencies []string) error {
+	for i := range sm.Streamers {
+		if sm.Streamers[i].ID == id {
+			sm.Streamers[i].DefaultCurrency = defaultCurrency
+			sm.Streamers[i].Currencies = strings.Join(currencies, ",")
+			return nil
+		}
+	}
+	return errors.New("Streamer not found")
+}
+
+func (sm *StreamerMock) UpdateDonationSettings(id int, minAmount int64, maxAmount int64, locale string) error {
+	for i := range sm.Streamers {
+		if sm.Streamers[i].ID == id {
+			sm.Streamers[i].MinAmount = minAmount
+			sm.Streamers[i].MaxAmount = maxAmount
+			sm.Streamers[i].Locale = locale
+			return nil
+		}
+	}
+	return errors.New("Streamer not found")
+}
+
+func (sm *StreamerMock) UpdateModerationSettings(id int, holdForReview bool, autoApproveSeconds int) error {
+	for i := range sm.Streamers {
+		if sm.Streamers[i].ID == id {
+			sm.Streamers[i].HoldForReview = holdForReview
+			sm.Streamers[i].AutoApproveSeconds = autoApproveSeconds
+			return nil
+		}
+	}
+	return errors.New("Streamer not found")
+}
+
+func (sm *StreamerMock) UpdateFilterSettings(id int, filterSettings string) error {
+	for i := range sm.Streamers {
+		if sm.Streamers[i].ID == id {
+			sm.Streamers[i].FilterSettings = filterSettings
+			return nil
+		}
+	}
+	return errors.New("Streamer not found")
+}
+
+func (sm *StreamerMock) SetPayoutAccount(id int, accountID string) error {
+	for i := range sm.Streamers {
+		if sm.Streamers[i].ID == id {
+			sm.Streamers[i].PayoutAccountID = accountID
+			sm.Streamers[i].OnboardingStatus = OnboardingStatusPending
+			return nil
+		}
+	}
+	return errors.New("Streamer not found")
+}
+
+func (sm *StreamerMock) UpdateOnboardingStatus(accountID string, status string) (bool, error) {
+	for i := range sm.Streamers {
+		if accountID != "" && sm.Streamers[i].PayoutAccountID == accountID {
+			sm.Streamers[i].OnboardingStatus = status
+			return true, nil
+		}
+	}
+	return false, nil
+}
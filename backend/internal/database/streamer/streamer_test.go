@@ -68,6 +68,82 @@ func TestStreamerRepository(t *testing.T) {
 	if fetchedStreamer.TwitchName != "testTwitchName" {
 		t.Fatalf("Expected TwitchName to be 'testTwitchName', got %s", fetchedStreamer.TwitchName)
 	}
+	if fetchedStreamer.DefaultCurrency != "USD" || !fetchedStreamer.AcceptsCurrency("USD") {
+		t.Fatalf("Expected a new streamer to accept USD, got %s", fetchedStreamer.Currencies)
+	}
+
+	// Test UpdateDonationSettings
+	if err := repo.UpdateDonationSettings(id, 500, 100000, "de-DE"); err != nil {
+		t.Fatalf("Failed to update donation settings: %v", err)
+	}
+	fetchedStreamer, err = repo.GetStreamerById(id)
+	if err != nil {
+		t.Fatalf("Failed to get streamer by ID: %v", err)
+	}
+	if fetchedStreamer.MinAmount != 500 || fetchedStreamer.MaxAmount != 100000 || fetchedStreamer.Locale != "de-DE" {
+		t.Fatalf("Unexpected donation settings: %+v", fetchedStreamer)
+	}
+
+	// Test UpdateModerationSettings
+	if err := repo.UpdateModerationSettings(id, true, 300); err != nil {
+		t.Fatalf("Failed to update moderation settings: %v", err)
+	}
+	fetchedStreamer, err = repo.GetStreamerById(id)
+	if err != nil {
+		t.Fatalf("Failed to get streamer by ID: %v", err)
+	}
+	if !fetchedStreamer.HoldForReview || fetchedStreamer.AutoApproveSeconds != 300 {
+		t.Fatalf("Unexpected moderation settings: %+v", fetchedStreamer)
+	}
+
+	// Test UpdateFilterSettings
+	if fetchedStreamer.FilterSettings != "" {
+		t.Fatalf("Expected a new streamer without filter settings, got %s", fetchedStreamer.FilterSettings)
+	}
+	if err := repo.UpdateFilterSettings(id, `{"rules":[]}`); err != nil {
+		t.Fatalf("Failed to update filter settings: %v", err)
+	}
+	fetchedStreamer, err = repo.GetStreamerById(id)
+	if err != nil {
+		t.Fatalf("Failed to get streamer by ID: %v", err)
+	}
+	if fetchedStreamer.FilterSettings != `{"rules":[]}` {
+		t.Fatalf("Unexpected filter settings: %s", fetchedStreamer.FilterSettings)
+	}
+
+	// Test UpdateCurrencies
+	if err := repo.UpdateCurrencies(id, "EUR", []string{"EUR", "JPY"}); err != nil {
+		t.Fatalf("Failed to update currencies: %v", err)
+	}
+	fetchedStreamer, err = repo.GetStreamerById(id)
+	if err != nil {
+		t.Fatalf("Failed to get streamer by ID: %v", err)
+	}
+	if fetchedStreamer.DefaultCurrency != "EUR" || !fetchedStreamer.AcceptsCurrency("JPY") || fetchedStreamer.AcceptsCurrency("USD") {
+		t.Fatalf("Unexpected currencies: default %s, accepted %s", fetchedStreamer.DefaultCurrency, fetchedStreamer.Currencies)
+	}
+
+	// Test payout onboarding
+	if fetchedStreamer.OnboardingStatus != OnboardingStatusNone || fetchedStreamer.PayoutsEnabled() {
+		t.Fatalf("Expected a new streamer without payouts, got %+v", fetchedStreamer)
+	}
+	if err := repo.SetPayoutAccount(id, "acct_test"); err != nil {
+		t.Fatalf("Failed to set payout account: %v", err)
+	}
+	found, err := repo.UpdateOnboardingStatus("acct_test", OnboardingStatusEnabled)
+	if err != nil || !found {
+		t.Fatalf("Failed to update onboarding status: %v", err)
+	}
+	fetchedStreamer, err = repo.GetStreamerById(id)
+	if err != nil {
+		t.Fatalf("Failed to get streamer by ID: %v", err)
+	}
+	if fetchedStreamer.PayoutAccountID != "acct_test" || !fetchedStreamer.PayoutsEnabled() {
+		t.Fatalf("Expected payouts enabled, got %+v", fetchedStreamer)
+	}
+	if found, err = repo.UpdateOnboardingStatus("acct_unknown", OnboardingStatusEnabled); err != nil || found {
+		t.Fatalf("Expected no streamer with an unknown account, got %v, %v", found, err)
+	}
 
 	// Clean up test data
 	_, err = db.Exec("DELETE FROM streamers WHERE id = $1", id)
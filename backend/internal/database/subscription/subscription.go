@@ -0,0 +1,125 @@
+package subscription
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+)
+
+// Subscription is a supporter's monthly donation to a streamer.
+// Every payed invoice is stored as a donation of the subscription.
+type Subscription struct {
+	ID int `db:"id"`
+	// Provider is the payment provider and SubscriptionID the subscription's ID there.
+	Provider       string `db:"provider"`
+	SubscriptionID string `db:"subscription_id"`
+	StreamerID     int    `db:"streamer_id"`
+	Name           string `db:"name"`
+	Message        string `db:"message"`
+	// Amount is what the supporter pays every month, in the minor unit of Currency.
+	Amount      int64        `db:"amount"`
+	Currency    string       `db:"currency"`
+	Fee         int64        `db:"fee"`
+	NetAmount   int64        `db:"net_amount"`
+	FeesCovered bool         `db:"fees_covered"`
+	Status      string       `db:"status"`
+	CreatedAt   time.Time    `db:"created_at"`
+	UpdatedAt   time.Time    `db:"updated_at"`
+	CanceledAt  sql.NullTime `db:"canceled_at"`
+	// FilterAction and FilterDecisions are what the message filter decided
+	// when the supporter subscribed, every donation of the subscription gets them.
+	FilterAction    string         `db:"filter_action"`
+	FilterDecisions sql.NullString `db:"filter_decisions"`
+	DonorName       string         `db:"donor_name"`
+	DonorEmail      string         `db:"donor_email"`
+	DonorIP         string         `db:"donor_ip"`
+	// Months counts the payed invoices, it is only set by GetSubscriptions.
+	Months int `db:"months"`
+}
+
+const (
+	// StatusIncomplete is set until the first invoice is payed.
+	StatusIncomplete = "INCOMPLETE"
+	StatusActive     = "ACTIVE"
+	// StatusPastDue is set while the provider retries a failed invoice.
+	StatusPastDue  = "PAST_DUE"
+	StatusCanceled = "CANCELED"
+)
+
+type SubscriptionRepo interface {
+	Create(s *Subscription) error
+	GetSubscription(provider string, subscriptionID string) (Subscription, error)
+	GetSubscriptionById(id int) (Subscription, error)
+	// GetSubscriptions returns the streamer's subscriptions with their Months, newest first.
+	GetSubscriptions(streamerID int) ([]Subscription, error)
+	// UpdateStatus sets the subscription's status. A canceled subscription keeps its status.
+	UpdateStatus(id int, status string) error
+}
+
+type Repo struct {
+	database.Repo
+}
+
+func (r Repo) Create(s *Subscription) error {
+	return r.DB.QueryRowx(`
+		INSERT INTO subscriptions (
+			provider,
+			subscription_id,
+			streamer_id,
+			name,
+			message,
+			amount,
+			currency,
+			fee,
+			net_amount,
+			fees_covered,
+			status,
+			filter_action,
+			filter_decisions,
+			donor_name,
+			donor_email,
+			donor_ip
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id, created_at, updated_at`,
+		s.Provider, s.SubscriptionID, s.StreamerID, s.Name, s.Message, s.Amount, s.Currency,
+		s.Fee, s.NetAmount, s.FeesCovered, s.Status, s.FilterAction, s.FilterDecisions,
+		s.DonorName, s.DonorEmail, s.DonorIP,
+	).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+func (r Repo) GetSubscription(provider string, subscriptionID string) (Subscription, error) {
+	var s Subscription
+	err := r.DB.Get(&s, `
+		SELECT *, 0 AS months FROM subscriptions
+		WHERE provider = $1 AND subscription_id = $2`, provider, subscriptionID)
+	return s, err
+}
+
+func (r Repo) GetSubscriptionById(id int) (Subscription, error) {
+	var s Subscription
+	err := r.DB.Get(&s, "SELECT *, 0 AS months FROM subscriptions WHERE id = $1", id)
+	return s, err
+}
+
+func (r Repo) GetSubscriptions(streamerID int) ([]Subscription, error) {
+	res := []Subscription{}
+	err := r.DB.Select(&res, `
+		SELECT s.*, (
+			SELECT COUNT(*) FROM donations d WHERE d.subscription_id = s.id AND d.status = $2
+		) AS months
+		FROM subscriptions s
+		WHERE s.streamer_id = $1
+		ORDER BY s.created_at DESC`, streamerID, donation.DonationStatusPayed)
+	return res, err
+}
+
+func (r Repo) UpdateStatus(id int, status string) error {
+	_, err := r.DB.Exec(`
+		UPDATE subscriptions
+		SET status = $2, updated_at = NOW(),
+			canceled_at = CASE WHEN $2 = $3 THEN NOW() ELSE canceled_at END
+		WHERE id = $1 AND status <> $3`, id, status, StatusCanceled)
+	return err
+}
@@ -0,0 +1,75 @@
+package subscription
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+type SubscriptionMock struct {
+	subscriptions map[int]Subscription
+	nextID        int
+}
+
+func NewSubscriptionMock() *SubscriptionMock {
+	return &SubscriptionMock{
+		subscriptions: make(map[int]Subscription),
+		nextID:        1,
+	}
+}
+
+func (repo *SubscriptionMock) Create(s *Subscription) error {
+	s.ID = repo.nextID
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	repo.subscriptions[s.ID] = *s
+	repo.nextID++
+	return nil
+}
+
+func (repo *SubscriptionMock) GetSubscription(provider string, subscriptionID string) (Subscription, error) {
+	for _, s := range repo.subscriptions {
+		if s.Provider == provider && s.SubscriptionID == subscriptionID {
+			return s, nil
+		}
+	}
+	return Subscription{}, sql.ErrNoRows
+}
+
+func (repo *SubscriptionMock) GetSubscriptionById(id int) (Subscription, error) {
+	s, ok := repo.subscriptions[id]
+	if !ok {
+		return Subscription{}, sql.ErrNoRows
+	}
+	return s, nil
+}
+
+// GetSubscriptions doesn't count Months, the mock doesn't know the donations.
+func (repo *SubscriptionMock) GetSubscriptions(streamerID int) ([]Subscription, error) {
+	res := []Subscription{}
+	for _, s := range repo.subscriptions {
+		if s.StreamerID == streamerID {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID > res[j].ID })
+	return res, nil
+}
+
+func (repo *SubscriptionMock) UpdateStatus(id int, status string) error {
+	s, ok := repo.subscriptions[id]
+	if !ok {
+		return errors.New("Subscription not found")
+	}
+	if s.Status == StatusCanceled {
+		return nil
+	}
+	s.Status = status
+	s.UpdatedAt = time.Now()
+	if status == StatusCanceled {
+		s.CanceledAt = sql.NullTime{Time: s.UpdatedAt, Valid: true}
+	}
+	repo.subscriptions[id] = s
+	return nil
+}
@@ -0,0 +1,113 @@
+//go:build integration
+// +build integration
+
+package subscription
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestSubscriptionRepoIntegration(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("BACKEND__CONNECTION_STRING"))
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer db.Close()
+	repo := Repo{Repo: database.Repo{DB: db}}
+	repo.Migrate()
+	db.Exec("DELETE FROM donations")
+	db.Exec("DELETE FROM subscriptions")
+
+	streamers := streamer.Repo{Repo: repo.Repo}
+	st := streamer.Streamer{TwitchId: "subscriptionTwitchId", TwitchName: "subscriptionTwitchName", SecretCode: "subscriptionSecret"}
+	if err := streamers.CreateStreamer(&st); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM streamers WHERE id = $1", st.ID)
+
+	// Test Create
+	s := &Subscription{
+		Provider:       "stripe",
+		SubscriptionID: "sub_1",
+		StreamerID:     st.ID,
+		Name:           "supporter",
+		Amount:         500,
+		Currency:       "USD",
+		Fee:            45,
+		NetAmount:      455,
+		Status:         StatusIncomplete,
+	}
+	if err := repo.Create(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID == 0 {
+		t.Fatal("Expected a non-zero ID")
+	}
+
+	// Test that donations of the subscription count the months
+	donations := donation.Repo{Repo: repo.Repo}
+	for i, paymentID := range []string{"pi_1", "pi_2"} {
+		d := &donation.Donation{
+			PaymentID:      paymentID,
+			StreamerID:     st.ID,
+			Amount:         500,
+			Currency:       "USD",
+			Status:         donation.DonationStatusCreated,
+			SubscriptionID: sql.NullInt64{Int64: int64(s.ID), Valid: true},
+		}
+		if err := donations.Create(d); err != nil {
+			t.Fatal(err)
+		}
+		if d.Month != i+1 {
+			t.Errorf("Expected month %d, got %d", i+1, d.Month)
+		}
+		d.Status = donation.DonationStatusPayed
+		if err := donations.Update(*d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Test UpdateStatus
+	if err := repo.UpdateStatus(s.ID, StatusCanceled); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateStatus(s.ID, StatusActive); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetSubscription("stripe", "sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusCanceled || !got.CanceledAt.Valid {
+		t.Errorf("Expected a canceled subscription, got %+v", got)
+	}
+
+	// Test GetSubscriptionById
+	got, err = repo.GetSubscriptionById(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SubscriptionID != "sub_1" || got.Status != StatusCanceled {
+		t.Errorf("Expected subscription sub_1, got %+v", got)
+	}
+
+	// Test GetSubscriptions
+	subs, err := repo.GetSubscriptions(st.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Months != 2 {
+		t.Errorf("Expected 1 subscription with 2 months, got %+v", subs)
+	}
+
+	db.Exec("DELETE FROM donations")
+	db.Exec("DELETE FROM subscriptions")
+}
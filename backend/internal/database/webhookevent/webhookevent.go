@@ -0,0 +1,114 @@
+package webhookevent
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+)
+
+// Event is a webhook event received from a payment provider. IDs are unique per provider.
+type Event struct {
+	ID       string         `db:"id"`
+	Provider string         `db:"provider"`
+	Type     string         `db:"type"`
+	Payload  []byte         `db:"payload"`
+	Status   string         `db:"status"`
+	Error    sql.NullString `db:"error"`
+	// Attempts counts how many times the event was processed.
+	Attempts    int          `db:"attempts"`
+	ReceivedAt  time.Time    `db:"received_at"`
+	UpdatedAt   time.Time    `db:"updated_at"`
+	ProcessedAt sql.NullTime `db:"processed_at"`
+}
+
+const (
+	StatusReceived  = "RECEIVED"
+	StatusProcessed = "PROCESSED"
+	StatusFailed    = "FAILED"
+)
+
+// staleAfter is how long an event may stay RECEIVED before it is considered
+// abandoned, e.g. because the instance processing it crashed.
+const staleAfter = 5 * time.Minute
+
+type WebhookEventRepo interface {
+	// Receive stores e as RECEIVED. It reports false if the event was already
+	// processed or is being processed, failed and abandoned events are received again.
+	Receive(e Event) (bool, error)
+	// Retry marks the failed event id as RECEIVED again. It reports false
+	// if the event didn't fail.
+	Retry(provider string, id string) (Event, bool, error)
+	// Finish records the outcome of processing the event id. A non-empty errMsg fails it.
+	Finish(provider string, id string, errMsg string) error
+	GetEvent(provider string, id string) (Event, error)
+	// GetEvents returns the last limit events with status, newest first.
+	// An empty status returns events of any status.
+	GetEvents(status string, limit int) ([]Event, error)
+}
+
+type Repo struct {
+	database.Repo
+}
+
+func (r Repo) Receive(e Event) (bool, error) {
+	var id string
+	err := r.DB.Get(&id, `
+		INSERT INTO webhook_events (id, type, payload, status, provider) VALUES ($1, $2, $3, $4, $7)
+		ON CONFLICT (provider, id) DO UPDATE
+		SET status = $4, error = NULL, attempts = webhook_events.attempts + 1, updated_at = NOW()
+		WHERE webhook_events.status = $5
+			OR (webhook_events.status = $4 AND webhook_events.updated_at < NOW() - $6 * INTERVAL '1 millisecond')
+		RETURNING id`, e.ID, e.Type, e.Payload, StatusReceived, StatusFailed, staleAfter.Milliseconds(), e.Provider)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r Repo) Retry(provider string, id string) (Event, bool, error) {
+	var e Event
+	err := r.DB.Get(&e, `
+		UPDATE webhook_events
+		SET status = $2, error = NULL, attempts = attempts + 1, updated_at = NOW()
+		WHERE id = $1 AND status = $3 AND provider = $4
+		RETURNING *`, id, StatusReceived, StatusFailed, provider)
+	if err == sql.ErrNoRows {
+		return Event{}, false, nil
+	}
+	return e, err == nil, err
+}
+
+func (r Repo) Finish(provider string, id string, errMsg string) error {
+	status := StatusProcessed
+	if errMsg != "" {
+		status = StatusFailed
+	}
+
+	_, err := r.DB.Exec(`
+		UPDATE webhook_events
+		SET status = $2, error = $3, updated_at = NOW(), processed_at = NOW()
+		WHERE id = $1 AND provider = $4`, id, status, sql.NullString{String: errMsg, Valid: errMsg != ""}, provider)
+	return err
+}
+
+func (r Repo) GetEvent(provider string, id string) (Event, error) {
+	var e Event
+	err := r.DB.Get(&e, "SELECT * FROM webhook_events WHERE provider = $1 AND id = $2", provider, id)
+	return e, err
+}
+
+func (r Repo) GetEvents(status string, limit int) ([]Event, error) {
+	res := []Event{}
+	if status == "" {
+		err := r.DB.Select(&res, "SELECT * FROM webhook_events ORDER BY received_at DESC LIMIT $1", limit)
+		return res, err
+	}
+
+	err := r.DB.Select(&res, `
+		SELECT * FROM webhook_events
+		WHERE status = $1
+		ORDER BY received_at DESC
+		LIMIT $2`, status, limit)
+	return res, err
+}
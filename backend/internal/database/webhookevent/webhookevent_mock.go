@@ -0,0 +1,103 @@
+package webhookevent
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+type WebhookEventMock struct {
+	events map[eventKey]Event
+}
+
+type eventKey struct {
+	provider string
+	id       string
+}
+
+func NewWebhookEventMock() *WebhookEventMock {
+	return &WebhookEventMock{
+		events: make(map[eventKey]Event),
+	}
+}
+
+func (repo *WebhookEventMock) Receive(e Event) (bool, error) {
+	now := time.Now()
+	key := eventKey{provider: e.Provider, id: e.ID}
+	existing, ok := repo.events[key]
+	if ok {
+		abandoned := existing.Status == StatusReceived && existing.UpdatedAt.Before(now.Add(-staleAfter))
+		if existing.Status != StatusFailed && !abandoned {
+			return false, nil
+		}
+		existing.Status = StatusReceived
+		existing.Error = sql.NullString{}
+		existing.Attempts++
+		existing.UpdatedAt = now
+		repo.events[key] = existing
+		return true, nil
+	}
+
+	e.Status = StatusReceived
+	e.Attempts = 1
+	e.ReceivedAt = now
+	e.UpdatedAt = now
+	repo.events[key] = e
+	return true, nil
+}
+
+func (repo *WebhookEventMock) Retry(provider string, id string) (Event, bool, error) {
+	key := eventKey{provider: provider, id: id}
+	e, ok := repo.events[key]
+	if !ok || e.Status != StatusFailed {
+		return Event{}, false, nil
+	}
+
+	e.Status = StatusReceived
+	e.Error = sql.NullString{}
+	e.Attempts++
+	e.UpdatedAt = time.Now()
+	repo.events[key] = e
+	return e, true, nil
+}
+
+func (repo *WebhookEventMock) Finish(provider string, id string, errMsg string) error {
+	key := eventKey{provider: provider, id: id}
+	e, ok := repo.events[key]
+	if !ok {
+		return errors.New("Event not found")
+	}
+
+	e.Status = StatusProcessed
+	if errMsg != "" {
+		e.Status = StatusFailed
+	}
+	e.Error = sql.NullString{String: errMsg, Valid: errMsg != ""}
+	e.UpdatedAt = time.Now()
+	e.ProcessedAt = sql.NullTime{Time: e.UpdatedAt, Valid: true}
+	repo.events[key] = e
+	return nil
+}
+
+func (repo *WebhookEventMock) GetEvent(provider string, id string) (Event, error) {
+	e, ok := repo.events[eventKey{provider: provider, id: id}]
+	if !ok {
+		return Event{}, sql.ErrNoRows
+	}
+	return e, nil
+}
+
+func (repo *WebhookEventMock) GetEvents(status string, limit int) ([]Event, error) {
+	res := []Event{}
+	for _, e := range repo.events {
+		if status == "" || e.Status == status {
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ReceivedAt.After(res[j].ReceivedAt) })
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
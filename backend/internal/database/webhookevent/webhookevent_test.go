@@ -0,0 +1,84 @@
+//go:build integration
+// +build integration
+
+package webhookevent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestWebhookEventRepoIntegration(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("BACKEND__CONNECTION_STRING"))
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer db.Close()
+	repo := Repo{Repo: database.Repo{DB: db}}
+	repo.Migrate()
+	db.Exec("DELETE FROM webhook_events")
+
+	e := Event{ID: "evt_1", Provider: "stripe", Type: "payment_intent.succeeded", Payload: []byte(`{"id":"evt_1"}`)}
+
+	// Test Receive
+	received, err := repo.Receive(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !received {
+		t.Fatal("Expected a new event to be received")
+	}
+
+	// Test that an event being processed is a duplicate
+	if received, err = repo.Receive(e); err != nil || received {
+		t.Fatalf("Expected a duplicate, got received: %v, err: %v", received, err)
+	}
+
+	// Test that a failed event is received again
+	if err := repo.Finish(e.Provider, e.ID, "can't update donation"); err != nil {
+		t.Fatal(err)
+	}
+	if received, err = repo.Receive(e); err != nil || !received {
+		t.Fatalf("Expected a failed event to be received again, got received: %v, err: %v", received, err)
+	}
+
+	// Test that a processed event is a duplicate
+	if err := repo.Finish(e.Provider, e.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if received, err = repo.Receive(e); err != nil || received {
+		t.Fatalf("Expected a duplicate, got received: %v, err: %v", received, err)
+	}
+
+	stored, err := repo.GetEvent(e.Provider, e.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != StatusProcessed || stored.Attempts != 2 || !stored.ProcessedAt.Valid {
+		t.Errorf("Unexpected stored event: %+v", stored)
+	}
+
+	// Test Retry
+	if _, retried, err := repo.Retry(e.Provider, e.ID); err != nil || retried {
+		t.Fatalf("Expected a processed event not to be retried, got retried: %v, err: %v", retried, err)
+	}
+	repo.Finish(e.Provider, e.ID, "failed again")
+	failed, err := repo.GetEvents(StatusFailed, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].ID != e.ID || failed[0].Provider != e.Provider {
+		t.Fatalf("Expected 1 failed event, got %+v", failed)
+	}
+	retriedEvent, retried, err := repo.Retry(e.Provider, e.ID)
+	if err != nil || !retried {
+		t.Fatalf("Expected a failed event to be retried, got retried: %v, err: %v", retried, err)
+	}
+	if retriedEvent.Status != StatusReceived || string(retriedEvent.Payload) != `{"id": "evt_1"}` {
+		t.Errorf("Unexpected retried event: %+v", retriedEvent)
+	}
+}
@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/mismatch"
+	"github.com/blindlobstar/donation-alarm/backend/internal/reconciler"
+)
+
+// maxListedMismatches caps how many mismatches are listed at once.
+const maxListedMismatches = 100
+
+type Reconciliation struct {
+	Mismatches mismatch.MismatchRepo
+	Reconciler reconciler.Reconciler
+}
+
+type MismatchResponse struct {
+	DonationID int    `json:"donationId"`
+	PaymentID  string `json:"paymentId"`
+	Kind       string `json:"kind"`
+	Expected   string `json:"expected"`
+	Actual     string `json:"actual"`
+	Source     string `json:"source"`
+	// CreatedAt is when the mismatch was first recorded.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+type ReportResponse struct {
+	Checked    int                `json:"checked"`
+	Fixed      int                `json:"fixed"`
+	Mismatches []MismatchResponse `json:"mismatches"`
+}
+
+// ListMismatches lists the recorded differences between donations and their payments, newest first.
+func (rc Reconciliation) ListMismatches(w http.ResponseWriter, r *http.Request) error {
+	limit := maxListedMismatches
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListedMismatches {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		limit = n
+	}
+
+	mismatches, err := rc.Mismatches.GetMismatches(limit)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, newMismatchResponses(mismatches))
+}
+
+// Reconcile runs the reconciliation now and returns its report.
+func (rc Reconciliation) Reconcile(w http.ResponseWriter, r *http.Request) error {
+	report, err := rc.Reconciler.Reconcile(time.Now())
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, ReportResponse{
+		Checked:    report.Checked,
+		Fixed:      report.Fixed,
+		Mismatches: newMismatchResponses(report.Mismatches),
+	})
+}
+
+func newMismatchResponses(mismatches []mismatch.Mismatch) []MismatchResponse {
+	resp := make([]MismatchResponse, 0, len(mismatches))
+	for _, m := range mismatches {
+		mr := MismatchResponse{
+			DonationID: m.DonationID,
+			PaymentID:  m.PaymentID,
+			Kind:       m.Kind,
+			Expected:   m.Expected,
+			Actual:     m.Actual,
+			Source:     m.Source,
+		}
+		if !m.CreatedAt.IsZero() {
+			createdAt := m.CreatedAt
+			mr.CreatedAt = &createdAt
+		}
+		resp = append(resp, mr)
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	respBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
@@ -0,0 +1,180 @@
+package blocklist
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/blocklist"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/gorilla/mux"
+)
+
+// maxNote caps the length of the note a streamer keeps with a blocked donor.
+const maxNote = 500
+
+type Blocklist struct {
+	BR blocklist.BlocklistRepo
+	DR donation.DonationRepo
+}
+
+// AddRequest blocks Kind and Value, or the donor of DonationID.
+type AddRequest struct {
+	Kind       string `json:"kind"`
+	Value      string `json:"value"`
+	DonationID int    `json:"donationId"`
+	// BlockName blocks the name the donor of DonationID typed as well,
+	// everyone else who types it is blocked too.
+	BlockName bool   `json:"blockName"`
+	Note      string `json:"note"`
+}
+
+type EntryResponse struct {
+	ID   int    `json:"id"`
+	Kind string `json:"kind"`
+	// Value is empty for the donor details of a blocked donation.
+	Value      string    `json:"value,omitempty"`
+	DonationID int       `json:"donationId,omitempty"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// List returns the logged in streamer's blocked donors.
+func (b Blocklist) List(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	entries, err := b.BR.GetEntries(streamerID)
+	if err != nil {
+		return err
+	}
+	return writeEntries(w, entries)
+}
+
+// Add blocks a donor of the logged in streamer and returns the new entries.
+// Blocking a donation blocks its donor's email, IP and payment details, and
+// the donor's name if asked to. Keys that are already blocked are skipped.
+func (b Blocklist) Add(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	var request AddRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Note) > maxNote {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	var (
+		keys       []blocklist.Key
+		donationID sql.NullInt64
+	)
+	if request.DonationID != 0 {
+		d, err := b.DR.GetDonation(request.DonationID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && d.StreamerID != streamerID) {
+			w.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, k := range blocklist.DonorKeys(d) {
+			// a name isn't the donor's own, anyone can type a common one
+			if k.Kind == blocklist.KindName && !request.BlockName {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		donationID = sql.NullInt64{Int64: int64(d.ID), Valid: true}
+	} else {
+		key, err := blocklist.NewKey(request.Kind, request.Value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		keys = []blocklist.Key{key}
+	}
+
+	created := []blocklist.Entry{}
+	for _, k := range keys {
+		e := blocklist.Entry{
+			StreamerID: streamerID,
+			Kind:       k.Kind,
+			Value:      k.Value,
+			Note:       request.Note,
+			DonationID: donationID,
+		}
+		ok, err := b.BR.Create(&e)
+		if err != nil {
+			return err
+		}
+		if ok {
+			created = append(created, e)
+		}
+	}
+	return writeEntries(w, created)
+}
+
+// Remove unblocks an entry of the logged in streamer's blocklist.
+func (b Blocklist) Remove(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	deleted, err := b.BR.Delete(streamerID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func writeEntries(w http.ResponseWriter, entries []blocklist.Entry) error {
+	resp := make([]EntryResponse, 0, len(entries))
+	for _, e := range entries {
+		er := EntryResponse{
+			ID:         e.ID,
+			Kind:       e.Kind,
+			Value:      e.Value,
+			DonationID: int(e.DonationID.Int64),
+			Note:       e.Note,
+			CreatedAt:  e.CreatedAt,
+		}
+		// the donor's name is on the donation, the rest is private
+		if e.DonationID.Valid && e.Kind != blocklist.KindName {
+			er.Value = ""
+		}
+		resp = append(resp, er)
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build unit
+// +build unit
+
+package blocklist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/blocklist"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+)
+
+func add(t *testing.T, b Blocklist, body string) []EntryResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/blocklist", strings.NewReader(body))
+	req = req.WithContext(twitch_auth.WithStreamerID(req.Context(), 1))
+	rec := httptest.NewRecorder()
+	if err := b.Add(rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var entries []EntryResponse
+	json.NewDecoder(rec.Body).Decode(&entries)
+	return entries
+}
+
+func kinds(entries []EntryResponse) []string {
+	res := []string{}
+	for _, e := range entries {
+		res = append(res, e.Kind)
+	}
+	return res
+}
+
+func TestAddDonation(t *testing.T) {
+	donations := donation.NewDonationMock()
+	d := donation.Donation{StreamerID: 1, Name: "John", DonorName: "John", DonorEmail: "troll@example.com", DonorIP: "10.0.0.1", CardFingerprint: "fp_1"}
+	donations.Create(&d)
+	b := Blocklist{BR: &blocklist.BlocklistMock{}, DR: donations}
+
+	// Test case 1: the donor is blocked without the name anyone can type
+	entries := add(t, b, `{"donationId":1}`)
+	if got := strings.Join(kinds(entries), ","); got != "EMAIL,IP,CARD" {
+		t.Errorf("expected the email, IP and card to be blocked, got %s", got)
+	}
+
+	// Test case 2: the name is blocked when asked to
+	entries = add(t, b, `{"donationId":1,"blockName":true}`)
+	if len(entries) != 1 || entries[0].Kind != blocklist.KindName || entries[0].Value != "john" {
+		t.Errorf("expected only the name to be added, got %+v", entries)
+	}
+}
@@ -1,79 +1,202 @@
 package donation
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/blocklist"
 	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
 	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
-	"github.com/stripe/stripe-go/v75"
-	"github.com/stripe/stripe-go/v75/paymentintent"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/blindlobstar/donation-alarm/backend/internal/filter"
+	"github.com/blindlobstar/donation-alarm/backend/internal/moderation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
 )
 
 type Donation struct {
-	DR donation.DonationRepo
-	SR streamer.StreamerRepo
+	DR        donation.DonationRepo
+	SR        streamer.StreamerRepo
+	SubR      subscription.SubscriptionRepo
+	BR        blocklist.BlocklistRepo
+	Providers payments.Providers
+	Rates     money.Rates
+	Moderator moderation.Moderator
+	// PaymentTTL is how long a payment may stay unpayed before it's canceled.
+	// Pending payments are resumed only in the first half of it.
+	PaymentTTL time.Duration
+	// PlatformHeld charges donations to streamers who haven't onboarded with a
+	// provider that pays out to their own account to the platform, as before payouts.
+	// It's a temporary opt-out while existing streamers onboard, without it they
+	// can't receive donations until their account is enabled.
+	PlatformHeld bool
+	// TrustProxy takes the donor's IP from the X-Forwarded-For header
+	// set by the reverse proxy in front of the server.
+	TrustProxy bool
 }
 
 type CreateRequest struct {
 	Streamer string `json:"streamer"`
 	Message  string `json:"message"`
 	Name     string `json:"name"`
-	Amount   int    `json:"amount"`
+	// Amount is in the minor unit of Currency, e.g. 499 for $4.99.
+	Amount int64 `json:"amount"`
+	// Currency is the ISO 4217 code, the streamer's default currency if empty.
+	Currency string `json:"currency"`
+	// Provider is the payment provider to pay with, stripe by default.
+	Provider string `json:"provider"`
+	// CoverFees adds the provider's processing fee on top of Amount,
+	// so the streamer receives all of it.
+	CoverFees bool `json:"coverFees"`
+	// SessionID identifies the donor's donation page. A request with the same
+	// session and charge resumes the pending payment instead of starting another.
+	SessionID string `json:"sessionId"`
+	// Email is optional, streamers can block donors by it.
+	Email string `json:"email"`
 }
 
+const (
+	maxSessionIDLength = 64
+	// maxNameLength and maxMessageLength cap the donor's name and message in bytes,
+	// so an alert fits into a notification shared with the other instances.
+	maxNameLength    = 255
+	maxMessageLength = 500
+)
+
 type CreateResponse struct {
 	ClientSecret string `json:"clientSecret"`
+	// Amount is what the donor is charged and Fee the part of it
+	// the provider keeps, in the minor unit of the donation's currency.
+	Amount int64 `json:"amount"`
+	Fee    int64 `json:"fee"`
 }
 
 func (de Donation) Create(w http.ResponseWriter, r *http.Request) error {
 	var request CreateRequest
 	json.NewDecoder(r.Body).Decode(&request)
-
-	if request.Streamer == "" {
+	if len(request.SessionID) > maxSessionIDLength {
 		w.WriteHeader(http.StatusBadRequest)
 		return nil
 	}
-	if request.Amount <= 0 {
+
+	c, ok, err := de.newCharge(request, de.clientIP(r))
+	if err != nil {
+		return err
+	}
+	if !ok {
 		w.WriteHeader(http.StatusBadRequest)
 		return nil
 	}
-	streamers, err := de.SR.GetStreamers(streamer.Streamer{TwitchName: request.Streamer})
+	if c.screen.Rejected() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return nil
+	}
+	blocked, err := de.blocked(c)
 	if err != nil {
 		return err
 	}
-
-	if len(streamers) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
+	if blocked {
+		w.WriteHeader(http.StatusForbidden)
 		return nil
 	}
 
-	amount := request.Amount * 100
-	paymentParams := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(int64(amount)),
-		Currency: stripe.String(string(stripe.CurrencyUSD)),
-		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
-			Enabled: stripe.Bool(true),
-		},
+	payment, resumed, err := de.resume(c, request)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		return writeCreateResponse(w, payment, c)
+	}
+
+	payment, err = c.provider.CreatePayment(c.params)
+	// e.g. an amount the provider can't charge in the currency
+	if errors.Is(err, payments.ErrUnsupported) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
 	}
-	pi, err := paymentintent.New(paymentParams)
 	if err != nil {
 		return err
 	}
 	donation := &donation.Donation{
-		PaymentID:  pi.ID,
-		StreamerID: streamers[0].ID,
-		Amount:     amount,
-		Message:    request.Message,
-		Name:       request.Name,
-		Status:     donation.DonationStatusCreated,
+		PaymentID:       payment.ID,
+		Provider:        c.provider.Name(),
+		StreamerID:      c.params.StreamerID,
+		Amount:          c.params.Amount,
+		Currency:        c.params.Currency,
+		Fee:             c.fee,
+		NetAmount:       c.params.Amount - c.fee,
+		FeesCovered:     request.CoverFees,
+		Message:         c.screen.Message,
+		Name:            c.screen.Name,
+		Status:          donation.DonationStatusCreated,
+		SessionID:       request.SessionID,
+		FilterAction:    c.screen.Action,
+		FilterDecisions: decisions(c.screen),
+		DonorName:       c.name,
+		DonorEmail:      c.email,
+		DonorIP:         c.ip,
 	}
 	if err := de.DR.Create(donation); err != nil {
 		return err
 	}
 
+	return writeCreateResponse(w, payment, c)
+}
+
+// resume returns the session's pending payment for the same charge, so a reloaded
+// donation page doesn't start another payment. It reports false if there's none.
+func (de Donation) resume(c charge, request CreateRequest) (payments.Payment, bool, error) {
+	if request.SessionID == "" {
+		return payments.Payment{}, false, nil
+	}
+
+	// a payment close to its TTL could be canceled while the donor pays it
+	pending, err := de.DR.GetPending(c.params.StreamerID, request.SessionID, time.Now().Add(-de.PaymentTTL/2))
+	if err != nil {
+		return payments.Payment{}, false, err
+	}
+	for _, d := range pending {
+		if d.Provider != c.provider.Name() || d.Amount != c.params.Amount || d.Currency != c.params.Currency {
+			continue
+		}
+
+		payment, err := c.provider.ResumePayment(d.PaymentID)
+		if err != nil {
+			return payments.Payment{}, false, err
+		}
+
+		// the donation is moderated and blocked by what the donor sent last
+		d.Name = c.screen.Name
+		d.Message = c.screen.Message
+		d.FeesCovered = request.CoverFees
+		d.FilterAction = c.screen.Action
+		d.FilterDecisions = decisions(c.screen)
+		d.DonorName = c.name
+		d.DonorEmail = c.email
+		d.DonorIP = c.ip
+		// the donation could have been payed or canceled since it was read
+		updated, err := de.DR.UpdateFrom(d, donation.DonationStatusCreated)
+		if err != nil {
+			return payments.Payment{}, false, err
+		}
+		if !updated {
+			continue
+		}
+		return payment, true, nil
+	}
+	return payments.Payment{}, false, nil
+}
+
+func writeCreateResponse(w http.ResponseWriter, payment payments.Payment, c charge) error {
 	respBytes, err := json.Marshal(CreateResponse{
-		ClientSecret: pi.ClientSecret,
+		ClientSecret: payment.ClientSecret,
+		Amount:       c.params.Amount,
+		Fee:          c.fee,
 	})
 	if err != nil {
 		return err
@@ -83,3 +206,167 @@ func (de Donation) Create(w http.ResponseWriter, r *http.Request) error {
 	w.Write(respBytes)
 	return nil
 }
+
+// charge is what a donor is charged for a valid donation request.
+type charge struct {
+	provider payments.Provider
+	params   payments.PaymentParams
+	fee      int64
+	// screen is the donor's name and message after the streamer's filter.
+	screen filter.Result
+	// name, email and ip identify the donor, name is the canonical name the donor typed,
+	// email is empty if the donor didn't give one.
+	name  string
+	email string
+	ip    string
+}
+
+// newCharge validates the request of the donor at ip against the streamer's
+// settings and computes the payment. It reports false if the request is invalid.
+func (de Donation) newCharge(request CreateRequest, ip string) (charge, bool, error) {
+	if request.Streamer == "" || request.Amount <= 0 {
+		return charge{}, false, nil
+	}
+	if len(request.Name) > maxNameLength || len(request.Message) > maxMessageLength {
+		return charge{}, false, nil
+	}
+	// a name that is no identifier is only shown, it's never blocked
+	var name string
+	if key, err := blocklist.NewKey(blocklist.KindName, request.Name); err == nil {
+		name = key.Value
+	}
+	var email string
+	if request.Email != "" {
+		key, err := blocklist.NewKey(blocklist.KindEmail, request.Email)
+		if err != nil {
+			return charge{}, false, nil
+		}
+		email = key.Value
+	}
+	if request.Provider == "" {
+		request.Provider = payments.ProviderStripe
+	}
+	provider, err := de.Providers.Get(request.Provider)
+	if err != nil {
+		return charge{}, false, nil
+	}
+	streamers, err := de.SR.GetStreamers(streamer.Streamer{TwitchName: request.Streamer})
+	if err != nil {
+		return charge{}, false, err
+	}
+	if len(streamers) == 0 {
+		return charge{}, false, nil
+	}
+	s := streamers[0]
+
+	settings, err := filter.ParseSettings(s.FilterSettings)
+	if err != nil {
+		return charge{}, false, err
+	}
+	f, err := filter.New(settings)
+	if err != nil {
+		return charge{}, false, err
+	}
+	screen := f.Screen(request.Name, request.Message)
+
+	// donations are payed out to the streamer's account once it's onboarded
+	_, connect := provider.(payments.Connect)
+	connected := connect && s.PayoutsEnabled()
+	if connect && !connected && !de.PlatformHeld {
+		return charge{}, false, nil
+	}
+
+	currency := s.DefaultCurrency
+	if request.Currency != "" {
+		currency, err = money.ParseCurrency(request.Currency)
+		if err != nil || !s.AcceptsCurrency(currency) {
+			return charge{}, false, nil
+		}
+	}
+
+	// a currency accepted before its rate was removed can't be checked against the limits
+	ok, err := withinLimits(s, money.New(request.Amount, currency), de.Rates)
+	if errors.Is(err, money.ErrNoRate) {
+		return charge{}, false, nil
+	}
+	if err != nil {
+		return charge{}, false, err
+	}
+	if !ok {
+		return charge{}, false, nil
+	}
+
+	fees := provider.Fees()
+	gross := request.Amount
+	if request.CoverFees {
+		gross = fees.GrossUp(money.New(request.Amount, currency))
+	}
+	fee := fees.Fee(money.New(gross, currency))
+	if gross-fee <= 0 {
+		return charge{}, false, nil
+	}
+
+	params := payments.PaymentParams{
+		Amount:     gross,
+		Currency:   currency,
+		StreamerID: s.ID,
+	}
+	if connected {
+		// the platform keeps the fee and pays the provider's fee from it
+		params.Destination = s.PayoutAccountID
+		params.ApplicationFee = fee
+	}
+	return charge{provider: provider, params: params, fee: fee, screen: screen, name: name, email: email, ip: ip}, true, nil
+}
+
+// blocked reports whether the streamer blocked the donor of c. Names are
+// only on the blocklist if the streamer chose to block them.
+func (de Donation) blocked(c charge) (bool, error) {
+	if de.BR == nil {
+		return false, nil
+	}
+	keys := blocklist.DonorKeys(donation.Donation{DonorName: c.name, DonorEmail: c.email, DonorIP: c.ip})
+	entries, err := de.BR.Match(c.params.StreamerID, keys)
+	return len(entries) > 0, err
+}
+
+// clientIP returns the IP the request came from, empty if it's unknown.
+func (de Donation) clientIP(r *http.Request) string {
+	addr := r.RemoteAddr
+	if de.TrustProxy {
+		// the proxy appends the address it got the request from, the ones
+		// before it could be made up by the donor
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			addr = strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// decisions returns the filter decisions to store with a donation.
+func decisions(screen filter.Result) sql.NullString {
+	raw := screen.DecisionsJSON()
+	return sql.NullString{String: raw, Valid: raw != ""}
+}
+
+// withinLimits reports whether m is within the streamer's limits,
+// which are set in the streamer's default currency.
+func withinLimits(s streamer.Streamer, m money.Money, rates money.Rates) (bool, error) {
+	rate, err := rates.Rate(m.Currency, s.DefaultCurrency)
+	if err != nil {
+		return false, err
+	}
+
+	amount := money.Convert(m.Amount, m.Currency, s.DefaultCurrency, rate)
+	if amount < s.MinAmount {
+		return false, nil
+	}
+	return s.MaxAmount == 0 || amount <= s.MaxAmount, nil
+}
@@ -0,0 +1,263 @@
+//go:build unit
+// +build unit
+
+package donation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/blocklist"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/filter"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+)
+
+func TestNewChargePayouts(t *testing.T) {
+	streamers := &streamer.StreamerMock{}
+	fresh := streamer.Streamer{TwitchName: "fresh"}
+	streamers.CreateStreamer(&fresh)
+	onboarded := streamer.Streamer{TwitchName: "onboarded"}
+	streamers.CreateStreamer(&onboarded)
+	streamers.SetPayoutAccount(onboarded.ID, "acct_1")
+	streamers.UpdateOnboardingStatus("acct_1", streamer.OnboardingStatusEnabled)
+
+	de := Donation{
+		SR:        streamers,
+		Providers: payments.NewProviders(payments.NewStripe(payments.StripeConfig{Fees: payments.StripeFees})),
+		Rates:     money.StaticRates{Base: "USD"},
+	}
+	request := func(name string) CreateRequest {
+		return CreateRequest{Streamer: name, Name: "donor", Amount: 500}
+	}
+
+	// Test case 1: a streamer has to onboard before receiving donations
+	if _, ok, err := de.newCharge(request("fresh"), ""); err != nil || ok {
+		t.Errorf("expected the request to be refused, got %v %v", ok, err)
+	}
+
+	// Test case 2: donations to an onboarded streamer are payed out to the account
+	c, ok, err := de.newCharge(request("onboarded"), "")
+	if err != nil || !ok {
+		t.Fatalf("expected a charge, got %v %v", ok, err)
+	}
+	if c.params.Destination != "acct_1" || c.params.ApplicationFee != c.fee {
+		t.Errorf("expected a charge payed out to acct_1, got %+v", c.params)
+	}
+
+	// Test case 3: with platform-held donations the platform keeps them until the streamer onboards
+	de.PlatformHeld = true
+	c, ok, err = de.newCharge(request("fresh"), "")
+	if err != nil || !ok {
+		t.Fatalf("expected a charge, got %v %v", ok, err)
+	}
+	if c.params.Destination != "" || c.params.ApplicationFee != 0 {
+		t.Errorf("expected a platform charge, got %+v", c.params)
+	}
+}
+
+type failingRates struct{}
+
+func (failingRates) Rate(from, to string) (float64, error) {
+	return 0, errors.New("rates are unavailable")
+}
+
+func TestNewChargeRates(t *testing.T) {
+	streamers := &streamer.StreamerMock{}
+	streamers.CreateStreamer(&streamer.Streamer{TwitchName: "streamer", DefaultCurrency: "USD", Currencies: "USD,EUR", MinAmount: 100})
+	de := Donation{
+		SR:        streamers,
+		Providers: payments.NewProviders(&payments.ProviderMock{}),
+		Rates:     money.StaticRates{Base: "USD"},
+	}
+
+	// Test case 1: amounts below the streamer's limits are refused
+	if _, ok, err := de.newCharge(CreateRequest{Streamer: "streamer", Provider: "mock", Amount: 50}, ""); err != nil || ok {
+		t.Errorf("expected the request to be refused, got %v %v", ok, err)
+	}
+
+	// Test case 2: a currency without a rate can't be checked against the limits
+	if _, ok, err := de.newCharge(CreateRequest{Streamer: "streamer", Provider: "mock", Amount: 500, Currency: "EUR"}, ""); err != nil || ok {
+		t.Errorf("expected the request to be refused, got %v %v", ok, err)
+	}
+
+	// Test case 3: a failed rate lookup is an error, not a bad request
+	de.Rates = failingRates{}
+	if _, _, err := de.newCharge(CreateRequest{Streamer: "streamer", Provider: "mock", Amount: 500}, ""); err == nil {
+		t.Error("expected the rate error")
+	}
+}
+
+func TestNewChargeLength(t *testing.T) {
+	streamers := &streamer.StreamerMock{}
+	streamers.CreateStreamer(&streamer.Streamer{TwitchName: "streamer"})
+	de := Donation{
+		SR:        streamers,
+		Providers: payments.NewProviders(&payments.ProviderMock{}),
+		Rates:     money.StaticRates{Base: "USD"},
+	}
+
+	// Test case 1: names and messages that wouldn't fit into an alert are refused
+	long := CreateRequest{Streamer: "streamer", Provider: "mock", Amount: 500, Message: strings.Repeat("a", maxMessageLength+1)}
+	if _, ok, err := de.newCharge(long, ""); err != nil || ok {
+		t.Errorf("expected the long message to be refused, got %v %v", ok, err)
+	}
+	long = CreateRequest{Streamer: "streamer", Provider: "mock", Amount: 500, Name: strings.Repeat("a", maxNameLength+1)}
+	if _, ok, err := de.newCharge(long, ""); err != nil || ok {
+		t.Errorf("expected the long name to be refused, got %v %v", ok, err)
+	}
+
+	// Test case 2: the longest name and message are accepted
+	request := CreateRequest{Streamer: "streamer", Provider: "mock", Amount: 500, Name: strings.Repeat("a", maxNameLength), Message: strings.Repeat("a", maxMessageLength)}
+	if _, ok, err := de.newCharge(request, ""); err != nil || !ok {
+		t.Errorf("expected a charge, got %v %v", ok, err)
+	}
+}
+
+func TestCreateResume(t *testing.T) {
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	settings := filter.Settings{Rules: []filter.Rule{{Kind: filter.KindWord, Value: "badword", Action: filter.ActionModerate}}}
+	streamers.UpdateFilterSettings(s.ID, settings.String())
+	donations := donation.NewDonationMock()
+	de := Donation{
+		DR:         donations,
+		SR:         streamers,
+		Providers:  payments.NewProviders(&payments.ProviderMock{}),
+		Rates:      money.StaticRates{Base: "USD"},
+		PaymentTTL: time.Hour,
+	}
+	create := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/donation", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		if err := de.Create(rec, req); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %v", rec.Code, err)
+		}
+	}
+
+	create(`{"streamer":"streamer","provider":"mock","amount":500,"name":"donor","message":"hi","sessionId":"s1"}`)
+	create(`{"streamer":"streamer","provider":"mock","amount":500,"name":"donor","message":"hi badword","sessionId":"s1","email":"Donor@example.com"}`)
+
+	// Test case 1: a reloaded page reuses the payment with what the donor sent last
+	pending, _ := donations.GetPending(s.ID, "s1", time.Now().Add(-time.Hour))
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending donation, got %+v", pending)
+	}
+	d := pending[0]
+	if d.Message != "hi badword" || d.FilterAction != filter.ActionModerate || !d.FilterDecisions.Valid || d.DonorEmail != "donor@example.com" {
+		t.Errorf("expected the last message to be screened, got %+v", d)
+	}
+
+	// Test case 2: a donation payed while it's resumed is left payed and another payment is started
+	de.DR = payedOnRead{donations}
+	create(`{"streamer":"streamer","provider":"mock","amount":500,"name":"donor","message":"hi","sessionId":"s1"}`)
+	payed, _ := donations.GetDonation(d.ID)
+	if payed.Status != donation.DonationStatusPayed {
+		t.Errorf("expected the donation to stay payed, got %s", payed.Status)
+	}
+	pending, _ = donations.GetPending(s.ID, "s1", time.Now().Add(-time.Hour))
+	if len(pending) != 1 || pending[0].ID == d.ID {
+		t.Errorf("expected a new pending donation, got %+v", pending)
+	}
+}
+
+// payedOnRead pays the pending donations it returns, as if their payments
+// succeeded right after they were read.
+type payedOnRead struct {
+	*donation.DonationMock
+}
+
+func (r payedOnRead) GetPending(streamerID int, sessionID string, createdAfter time.Time) ([]donation.Donation, error) {
+	pending, err := r.DonationMock.GetPending(streamerID, sessionID, createdAfter)
+	for _, d := range pending {
+		d.Status = donation.DonationStatusPayed
+		r.DonationMock.Update(d)
+	}
+	return pending, err
+}
+
+func TestCreateBlockedName(t *testing.T) {
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	settings := filter.Settings{Rules: []filter.Rule{{Kind: filter.KindWord, Value: "troll", Action: filter.ActionMask}}}
+	streamers.UpdateFilterSettings(s.ID, settings.String())
+	entries := &blocklist.BlocklistMock{}
+	entries.Create(&blocklist.Entry{StreamerID: s.ID, Kind: blocklist.KindName, Value: "troll head"})
+	donations := donation.NewDonationMock()
+	de := Donation{
+		DR:         donations,
+		SR:         streamers,
+		BR:         entries,
+		Providers:  payments.NewProviders(&payments.ProviderMock{}),
+		Rates:      money.StaticRates{Base: "USD"},
+		PaymentTTL: time.Hour,
+	}
+	create := func(name string) int {
+		t.Helper()
+		body := `{"streamer":"streamer","provider":"mock","amount":500,"name":"` + name + `","sessionId":"s1"}`
+		rec := httptest.NewRecorder()
+		if err := de.Create(rec, httptest.NewRequest(http.MethodPost, "/donation", strings.NewReader(body))); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+
+	// Test case 1: a blocked name is matched however the filter masks it
+	if code := create("Tr0ll Head"); code != http.StatusForbidden {
+		t.Errorf("expected %d, got %d", http.StatusForbidden, code)
+	}
+
+	// Test case 2: the donation keeps the name the donor typed next to the masked one
+	if code := create("Troll Face"); code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, code)
+	}
+	pending, _ := donations.GetPending(s.ID, "s1", time.Now().Add(-time.Hour))
+	if len(pending) != 1 || pending[0].Name != "***** Face" || pending[0].DonorName != "troll face" {
+		t.Errorf("expected the masked name and the donor's, got %+v", pending)
+	}
+}
+
+func TestTotalUnconverted(t *testing.T) {
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer", DefaultCurrency: "USD"}
+	streamers.CreateStreamer(&s)
+	donations := donation.NewDonationMock()
+	for _, d := range []donation.Donation{
+		{Amount: 500, NetAmount: 450, Currency: "USD"},
+		{Amount: 200, NetAmount: 180, Currency: "EUR"},
+		{Amount: 300, NetAmount: 270, Currency: "GBP"},
+	} {
+		d.StreamerID = s.ID
+		d.Status = donation.DonationStatusPayed
+		donations.Create(&d)
+	}
+	de := Donation{SR: streamers, DR: donations, Rates: money.StaticRates{Base: "USD", Rates: map[string]float64{"EUR": 0.5}}}
+
+	req := httptest.NewRequest(http.MethodGet, "/donations/total", nil)
+	req = req.WithContext(twitch_auth.WithStreamerID(req.Context(), s.ID))
+	rec := httptest.NewRecorder()
+	if err := de.Total(rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Test case 1: a currency without a rate is reported on its own instead of failing the total
+	var resp TotalResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Amount != 900 || resp.Net != 810 || resp.Currency != "USD" {
+		t.Errorf("expected 900 and 810 USD, got %+v", resp)
+	}
+	if len(resp.Unconverted) != 1 || resp.Unconverted[0] != (CurrencyTotal{Amount: 300, Net: 270, Currency: "GBP"}) {
+		t.Errorf("expected the GBP total to be unconverted, got %+v", resp.Unconverted)
+	}
+}
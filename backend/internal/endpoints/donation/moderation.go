@@ -0,0 +1,182 @@
+package donation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/gorilla/mux"
+)
+
+// heldLimit caps how many held donations are listed at once.
+const heldLimit = 100
+
+type HeldDonationResponse struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Message  string `json:"message"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	// ReviewDeadline is when the donation is approved automatically.
+	ReviewDeadline *time.Time `json:"reviewDeadline,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+type ReviewRequest struct {
+	// Message replaces the donation's message, it's kept if nil.
+	Message *string `json:"message"`
+}
+
+type ReviewResponse struct {
+	ID               int    `json:"id"`
+	ModerationStatus string `json:"moderationStatus"`
+	Message          string `json:"message"`
+}
+
+// HeldDonations returns the logged in streamer's payed donations waiting for review, oldest first.
+func (de Donation) HeldDonations(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	donations, err := de.DR.GetHeld(streamerID, heldLimit)
+	if err != nil {
+		return err
+	}
+
+	resp := make([]HeldDonationResponse, 0, len(donations))
+	for _, d := range donations {
+		hd := HeldDonationResponse{
+			ID:        d.ID,
+			Name:      d.Name,
+			Message:   d.Message,
+			Amount:    d.Amount,
+			Currency:  d.Currency,
+			CreatedAt: d.CreatedAt,
+		}
+		if d.ReviewDeadline.Valid {
+			hd.ReviewDeadline = &d.ReviewDeadline.Time
+		}
+		resp = append(resp, hd)
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
+
+// Approve shows a held donation of the logged in streamer on the overlay,
+// with the message from the request if it has one.
+func (de Donation) Approve(w http.ResponseWriter, r *http.Request) error {
+	d, ok, err := de.heldDonation(w, r, false)
+	if err != nil || !ok {
+		return err
+	}
+	return de.review(w, d, de.Moderator.Approve)
+}
+
+// Reject keeps a held donation of the logged in streamer off the overlay.
+func (de Donation) Reject(w http.ResponseWriter, r *http.Request) error {
+	d, ok, err := de.heldDonation(w, r, false)
+	if err != nil || !ok {
+		return err
+	}
+	return de.review(w, d, de.Moderator.Reject)
+}
+
+// EditHeld replaces the message of a held donation of the logged in streamer,
+// the donation stays held.
+func (de Donation) EditHeld(w http.ResponseWriter, r *http.Request) error {
+	d, ok, err := de.heldDonation(w, r, true)
+	if err != nil || !ok {
+		return err
+	}
+	return de.review(w, d, de.Moderator.Edit)
+}
+
+// heldDonation returns the logged in streamer's donation from the request path
+// with the message from the request body applied, the body must have a message
+// if requireMessage is set. It writes the response and reports false if the request is invalid.
+func (de Donation) heldDonation(w http.ResponseWriter, r *http.Request, requireMessage bool) (donation.Donation, bool, error) {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return donation.Donation{}, false, nil
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return donation.Donation{}, false, nil
+	}
+
+	var request ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		return donation.Donation{}, false, nil
+	}
+	if (requireMessage && request.Message == nil) || (request.Message != nil && len(*request.Message) > maxMessageLength) {
+		w.WriteHeader(http.StatusBadRequest)
+		return donation.Donation{}, false, nil
+	}
+
+	d, err := de.DR.GetDonation(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && d.StreamerID != streamerID) {
+		w.WriteHeader(http.StatusNotFound)
+		return donation.Donation{}, false, nil
+	}
+	if err != nil {
+		return donation.Donation{}, false, err
+	}
+
+	if request.Message != nil {
+		d.Message = *request.Message
+	}
+	return d, true, nil
+}
+
+// review applies the streamer's decision to d. A donation that isn't held
+// anymore, e.g. approved automatically in the meantime, is a conflict.
+func (de Donation) review(w http.ResponseWriter, d donation.Donation, decide func(donation.Donation) (bool, error)) error {
+	ok, err := decide(d)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		return nil
+	}
+
+	updated, err := de.DR.GetDonation(d.ID)
+	if err != nil {
+		return err
+	}
+
+	respBytes, err := json.Marshal(ReviewResponse{
+		ID:               updated.ID,
+		ModerationStatus: updated.ModerationStatus,
+		Message:          updated.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
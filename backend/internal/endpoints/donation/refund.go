@@ -0,0 +1,133 @@
+package donation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/gorilla/mux"
+)
+
+// maxRefundReason caps the length of the reason a streamer gives for a refund.
+const maxRefundReason = 500
+
+type RefundRequest struct {
+	Reason string `json:"reason"`
+}
+
+type RefundResponse struct {
+	Status string `json:"status"`
+}
+
+// Refund refunds a donation of the logged in streamer in full.
+// Repeated requests return the refunded donation without refunding it again.
+func (de Donation) Refund(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	var request RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Reason) > maxRefundReason {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	d, err := de.DR.GetDonation(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && d.StreamerID != streamerID) {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.Status == donation.DonationStatusRefunded {
+		return writeRefundResponse(w, d)
+	}
+	from := d.Status
+	if _, err := d.Transition(donation.DonationStatusRefunded); err != nil {
+		w.WriteHeader(http.StatusConflict)
+		return nil
+	}
+
+	provider, err := de.Providers.Get(d.Provider)
+	if err != nil {
+		return err
+	}
+	// the provider returns the same refund for a repeated key, so a double click
+	// doesn't refund the donation twice
+	refundID, err := provider.Refund(payments.RefundParams{
+		PaymentID:      d.PaymentID,
+		DonationID:     d.ID,
+		IdempotencyKey: "donation-refund-" + strconv.Itoa(d.ID),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("donation refunded by streamer. DonationID: %d, RefundID: %s", d.ID, refundID)
+
+	d.RefundID = sql.NullString{String: refundID, Valid: true}
+	d.RefundReason = sql.NullString{String: request.Reason, Valid: request.Reason != ""}
+
+	var messages []outbox.Message
+	// the alert of a disputed donation is already retracted
+	if from != donation.DonationStatusDisputed {
+		message, err := outbox.NewMessage(events.DonationRetractedName, events.DonationRetracted{
+			PaymentID:  d.PaymentID,
+			Status:     d.Status,
+			AlertSeq:   d.AlertSeq.Int64,
+			DonationID: d.ID,
+			StreamerID: d.StreamerID,
+			Amount:     d.Amount,
+			Currency:   d.Currency,
+		})
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+
+	// of concurrent refunds only the first retracts the alert, the provider
+	// returned the same refund to all of them
+	updated, err := de.DR.UpdateFrom(d, from, messages...)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		if d, err = de.DR.GetDonation(id); err != nil {
+			return err
+		}
+		if d.Status != donation.DonationStatusRefunded {
+			w.WriteHeader(http.StatusConflict)
+			return nil
+		}
+	}
+	return writeRefundResponse(w, d)
+}
+
+func writeRefundResponse(w http.ResponseWriter, d donation.Donation) error {
+	respBytes, err := json.Marshal(RefundResponse{Status: d.Status})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
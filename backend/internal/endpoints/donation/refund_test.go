@@ -0,0 +1,108 @@
+//go:build unit
+// +build unit
+
+package donation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/gorilla/mux"
+)
+
+// staleRepo returns the donation once as it was before a concurrent request changed it.
+type staleRepo struct {
+	*donation.DonationMock
+	stale *donation.Donation
+}
+
+func (sr staleRepo) GetDonation(id int) (donation.Donation, error) {
+	if sr.stale != nil && id == sr.stale.ID {
+		d := *sr.stale
+		*sr.stale = donation.Donation{}
+		return d, nil
+	}
+	return sr.DonationMock.GetDonation(id)
+}
+
+func refund(t *testing.T, de Donation, streamerID int, id int) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/donations/"+strconv.Itoa(id)+"/refund", strings.NewReader(`{"reason":"spam"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)})
+	if streamerID != 0 {
+		req = req.WithContext(twitch_auth.WithStreamerID(req.Context(), streamerID))
+	}
+	rec := httptest.NewRecorder()
+	if err := de.Refund(rec, req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return rec
+}
+
+func TestRefund(t *testing.T) {
+	donations := donation.NewDonationMock()
+	provider := &payments.ProviderMock{}
+	de := Donation{DR: donations, Providers: payments.NewProviders(provider)}
+
+	create := func(paymentID string, status string) donation.Donation {
+		d := donation.Donation{PaymentID: paymentID, Provider: provider.Name(), StreamerID: 1, Amount: 500, Currency: "USD", Status: donation.DonationStatusCreated}
+		donations.Create(&d)
+		d.Status = status
+		donations.Update(d)
+		d, _ = donations.GetDonation(d.ID)
+		return d
+	}
+	payed := create("pay_payed", donation.DonationStatusPayed)
+	unpayed := create("pay_unpayed", donation.DonationStatusCreated)
+	concurrent := create("pay_concurrent", donation.DonationStatusPayed)
+
+	// Test case 1: only a logged in streamer can refund
+	if rec := refund(t, de, 0, payed.ID); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+
+	// Test case 2: another streamer's donation is not found
+	if rec := refund(t, de, 2, payed.ID); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+
+	// Test case 3: a donation that isn't payed can't be refunded
+	if rec := refund(t, de, 1, unpayed.ID); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rec.Code)
+	}
+
+	// Test case 4: a payed donation is refunded and its alert retracted, once
+	for i := 0; i < 2; i++ {
+		rec := refund(t, de, 1, payed.ID)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), donation.DonationStatusRefunded) {
+			t.Errorf("expected the refunded donation, got %d %s", rec.Code, rec.Body)
+		}
+	}
+	if len(provider.Refunds) != 1 || provider.Refunds[0].PaymentID != payed.PaymentID {
+		t.Errorf("expected 1 refund of %s, got %+v", payed.PaymentID, provider.Refunds)
+	}
+	if len(donations.Outbox.Messages) != 1 || donations.Outbox.Messages[0].EventName != events.DonationRetractedName {
+		t.Errorf("expected 1 DonationRetracted message, got %+v", donations.Outbox.Messages)
+	}
+	if d, _ := donations.GetDonation(payed.ID); d.RefundReason.String != "spam" || !d.RefundID.Valid {
+		t.Errorf("expected the refund to be saved, got %+v", d)
+	}
+
+	// Test case 5: a refund racing another one doesn't retract the alert again
+	refund(t, de, 1, concurrent.ID)
+	de.DR = staleRepo{DonationMock: donations, stale: &concurrent}
+	rec := refund(t, de, 1, concurrent.ID)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), donation.DonationStatusRefunded) {
+		t.Errorf("expected the refunded donation, got %d %s", rec.Code, rec.Body)
+	}
+	if len(donations.Outbox.Messages) != 2 {
+		t.Errorf("expected 2 DonationRetracted messages, got %+v", donations.Outbox.Messages)
+	}
+}
@@ -0,0 +1,143 @@
+package donation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+)
+
+type SubscriptionResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Amount is charged every month, Net is what the streamer receives of it.
+	Amount   int64  `json:"amount"`
+	Net      int64  `json:"net"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+	// Months counts the payed months.
+	Months     int        `json:"months"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	CanceledAt *time.Time `json:"canceledAt,omitempty"`
+}
+
+// Subscribe starts a monthly donation. The supporter pays the first month
+// with the returned client secret, later months are charged automatically.
+func (de Donation) Subscribe(w http.ResponseWriter, r *http.Request) error {
+	var request CreateRequest
+	json.NewDecoder(r.Body).Decode(&request)
+
+	c, ok, err := de.newCharge(request, de.clientIP(r))
+	if err != nil {
+		return err
+	}
+	subscriptions, supported := c.provider.(payments.Subscriptions)
+	if !ok || !supported {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	if c.screen.Rejected() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return nil
+	}
+	blocked, err := de.blocked(c)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		w.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+
+	payment, err := subscriptions.CreateSubscription(payments.SubscriptionParams{
+		PaymentParams: c.params,
+		Name:          c.screen.Name,
+	})
+	if errors.Is(err, payments.ErrUnsupported) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sub := &subscription.Subscription{
+		Provider:        c.provider.Name(),
+		SubscriptionID:  payment.ID,
+		StreamerID:      c.params.StreamerID,
+		Name:            c.screen.Name,
+		Message:         c.screen.Message,
+		Amount:          c.params.Amount,
+		Currency:        c.params.Currency,
+		Fee:             c.fee,
+		NetAmount:       c.params.Amount - c.fee,
+		FeesCovered:     request.CoverFees,
+		Status:          subscription.StatusIncomplete,
+		FilterAction:    c.screen.Action,
+		FilterDecisions: decisions(c.screen),
+		DonorName:       c.name,
+		DonorEmail:      c.email,
+		DonorIP:         c.ip,
+	}
+	if err := de.SubR.Create(sub); err != nil {
+		return err
+	}
+
+	respBytes, err := json.Marshal(CreateResponse{
+		ClientSecret: payment.ClientSecret,
+		Amount:       c.params.Amount,
+		Fee:          c.fee,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
+
+// Subscriptions returns the logged in streamer's supporters with monthly donations.
+func (de Donation) Subscriptions(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	subs, err := de.SubR.GetSubscriptions(streamerID)
+	if err != nil {
+		return err
+	}
+
+	resp := make([]SubscriptionResponse, 0, len(subs))
+	for _, s := range subs {
+		sr := SubscriptionResponse{
+			ID:        s.ID,
+			Name:      s.Name,
+			Amount:    s.Amount,
+			Net:       s.NetAmount,
+			Currency:  s.Currency,
+			Status:    s.Status,
+			Months:    s.Months,
+			CreatedAt: s.CreatedAt,
+		}
+		if s.CanceledAt.Valid {
+			sr.CanceledAt = &s.CanceledAt.Time
+		}
+		resp = append(resp, sr)
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
@@ -0,0 +1,79 @@
+package donation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+)
+
+type TotalResponse struct {
+	// Amount is what donors paid and Net what the streamer received after fees,
+	// in the minor unit of Currency.
+	Amount   int64  `json:"amount"`
+	Net      int64  `json:"net"`
+	Currency string `json:"currency"`
+	// Unconverted are the totals in currencies without a rate to Currency,
+	// they are left out of Amount and Net.
+	Unconverted []CurrencyTotal `json:"unconverted"`
+}
+
+// CurrencyTotal is the sum of the donations in Currency.
+type CurrencyTotal struct {
+	Amount   int64  `json:"amount"`
+	Net      int64  `json:"net"`
+	Currency string `json:"currency"`
+}
+
+// Total returns the sum of the logged in streamer's donations in their home currency.
+// Donations in currencies that can't be converted are summed up per currency.
+func (de Donation) Total(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	s, err := de.SR.GetStreamerById(streamerID)
+	if err != nil {
+		return err
+	}
+	totals, err := de.DR.GetTotals(streamerID)
+	if err != nil {
+		return err
+	}
+	resp := TotalResponse{Currency: s.DefaultCurrency, Unconverted: []CurrencyTotal{}}
+	gross := make([]money.Money, 0, len(totals))
+	net := make([]money.Money, 0, len(totals))
+	for _, t := range totals {
+		// e.g. a currency the streamer stopped accepting and removed the rate of
+		_, err := de.Rates.Rate(t.Currency, s.DefaultCurrency)
+		if errors.Is(err, money.ErrNoRate) {
+			resp.Unconverted = append(resp.Unconverted, CurrencyTotal{Amount: t.Gross, Net: t.Net, Currency: t.Currency})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		gross = append(gross, money.New(t.Gross, t.Currency))
+		net = append(net, money.New(t.Net, t.Currency))
+	}
+	// donations converted to a previous home currency are converted again at the current rate
+	if resp.Amount, err = money.Sum(gross, s.DefaultCurrency, de.Rates); err != nil {
+		return err
+	}
+	if resp.Net, err = money.Sum(net, s.DefaultCurrency, de.Rates); err != nil {
+		return err
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
@@ -0,0 +1,40 @@
+package overlay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
+)
+
+type Overlay struct {
+	Hub *sockets.Hub
+}
+
+// Control sends a moderator command to every overlay of the logged in streamer.
+func (o Overlay) Control(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	var command sockets.Command
+	if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := o.Hub.Control(streamerID, command); err != nil {
+		if errors.Is(err, sockets.ErrInvalidCommand) {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		return err
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
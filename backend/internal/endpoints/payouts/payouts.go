@@ -0,0 +1,81 @@
+package payouts
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+)
+
+type Payouts struct {
+	SR      streamer.StreamerRepo
+	Connect payments.Connect
+	// RefreshURL is where the provider sends the streamer when an onboarding
+	// link expires, it should lead back to Onboard. ReturnURL is where
+	// the streamer lands after onboarding.
+	RefreshURL string
+	ReturnURL  string
+}
+
+type StatusResponse struct {
+	Status  string `json:"status"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Status returns the onboarding status of the logged in streamer's payout account.
+func (p Payouts) Status(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	s, err := p.SR.GetStreamerById(streamerID)
+	if err != nil {
+		return err
+	}
+
+	respBytes, err := json.Marshal(StatusResponse{Status: s.OnboardingStatus, Enabled: s.PayoutsEnabled()})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
+
+// Onboard redirects the logged in streamer to the provider's onboarding,
+// creating their payout account on the first visit.
+func (p Payouts) Onboard(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	s, err := p.SR.GetStreamerById(streamerID)
+	if err != nil {
+		return err
+	}
+
+	accountID := s.PayoutAccountID
+	if accountID == "" {
+		if accountID, err = p.Connect.CreateAccount(streamerID); err != nil {
+			return err
+		}
+		if err := p.SR.SetPayoutAccount(streamerID, accountID); err != nil {
+			return err
+		}
+	}
+
+	url, err := p.Connect.OnboardingLink(accountID, p.RefreshURL, p.ReturnURL)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,105 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+)
+
+type Settings struct {
+	SR streamer.StreamerRepo
+	// Rates convert donations to the streamer's default currency,
+	// only currencies they have a rate for are accepted.
+	Rates money.Rates
+}
+
+type Currencies struct {
+	Default    string   `json:"default"`
+	Currencies []string `json:"currencies"`
+}
+
+// Currencies returns the currencies the logged in streamer accepts.
+func (s Settings) Currencies(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	st, err := s.SR.GetStreamerById(streamerID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, Currencies{Default: st.DefaultCurrency, Currencies: st.AcceptedCurrencies()})
+}
+
+// UpdateCurrencies sets the currencies the logged in streamer accepts.
+func (s Settings) UpdateCurrencies(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	var request Currencies
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	defaultCurrency, err := money.ParseCurrency(request.Default)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	currencies := []string{}
+	seen := map[string]bool{}
+	for _, c := range request.Currencies {
+		code, err := money.ParseCurrency(c)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		if !seen[code] {
+			seen[code] = true
+			currencies = append(currencies, code)
+		}
+	}
+	if !seen[defaultCurrency] {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	// donations are checked against the limits in the default currency
+	for _, code := range currencies {
+		_, err := s.Rates.Rate(code, defaultCurrency)
+		if errors.Is(err, money.ErrNoRate) {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.SR.UpdateCurrencies(streamerID, defaultCurrency, currencies); err != nil {
+		return err
+	}
+	return writeJSON(w, Currencies{Default: defaultCurrency, Currencies: currencies})
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	respBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
@@ -0,0 +1,63 @@
+package settings
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"golang.org/x/text/language"
+)
+
+type DonationSettings struct {
+	// MinAmount and MaxAmount are in the minor unit of the default currency,
+	// a zero MaxAmount means no limit.
+	MinAmount int64  `json:"minAmount"`
+	MaxAmount int64  `json:"maxAmount"`
+	Locale    string `json:"locale"`
+}
+
+// DonationSettings returns the donation limits and the locale of the logged in streamer.
+func (s Settings) DonationSettings(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	st, err := s.SR.GetStreamerById(streamerID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, DonationSettings{MinAmount: st.MinAmount, MaxAmount: st.MaxAmount, Locale: st.Locale})
+}
+
+// UpdateDonationSettings sets the donation limits and the locale of the logged in streamer.
+func (s Settings) UpdateDonationSettings(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	var request DonationSettings
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	if request.MinAmount < 0 || request.MaxAmount < 0 || (request.MaxAmount != 0 && request.MaxAmount < request.MinAmount) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	tag, err := language.Parse(request.Locale)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	request.Locale = tag.String()
+
+	if err := s.SR.UpdateDonationSettings(streamerID, request.MinAmount, request.MaxAmount, request.Locale); err != nil {
+		return err
+	}
+	return writeJSON(w, request)
+}
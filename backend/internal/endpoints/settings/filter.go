@@ -0,0 +1,68 @@
+package settings
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+	"github.com/blindlobstar/donation-alarm/backend/internal/filter"
+)
+
+type FilterSettings struct {
+	Rules []filter.Rule `json:"rules"`
+	// Languages are the built-in word lists rules can use, they are ignored in updates.
+	Languages []string `json:"languages"`
+}
+
+// FilterSettings returns the rules donation names and messages of the logged in streamer are filtered with.
+func (s Settings) FilterSettings(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	st, err := s.SR.GetStreamerById(streamerID)
+	if err != nil {
+		return err
+	}
+	settings, err := filter.ParseSettings(st.FilterSettings)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, newFilterSettings(settings))
+}
+
+// UpdateFilterSettings replaces the filter rules of the logged in streamer.
+// The rules apply to donations made afterwards.
+func (s Settings) UpdateFilterSettings(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	var request FilterSettings
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	settings := filter.Settings{Rules: request.Rules}
+	if settings.Rules == nil {
+		settings.Rules = []filter.Rule{}
+	}
+	if _, err := filter.New(settings); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.SR.UpdateFilterSettings(streamerID, settings.String()); err != nil {
+		return err
+	}
+	return writeJSON(w, newFilterSettings(settings))
+}
+
+func newFilterSettings(settings filter.Settings) FilterSettings {
+	return FilterSettings{Rules: settings.Rules, Languages: filter.Languages()}
+}
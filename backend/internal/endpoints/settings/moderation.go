@@ -0,0 +1,59 @@
+package settings
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
+)
+
+// maxAutoApproveSeconds caps how long a held donation waits for review, a week.
+const maxAutoApproveSeconds = 7 * 24 * 60 * 60
+
+type ModerationSettings struct {
+	// HoldForReview keeps payed donations off the overlay until they are approved.
+	HoldForReview bool `json:"holdForReview"`
+	// AutoApproveSeconds approves held donations after that many seconds, zero never does.
+	AutoApproveSeconds int `json:"autoApproveSeconds"`
+}
+
+// ModerationSettings returns whether the logged in streamer reviews donations before they are shown.
+func (s Settings) ModerationSettings(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	st, err := s.SR.GetStreamerById(streamerID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, ModerationSettings{HoldForReview: st.HoldForReview, AutoApproveSeconds: st.AutoApproveSeconds})
+}
+
+// UpdateModerationSettings sets whether the logged in streamer reviews donations before they are shown.
+// The settings apply to donations payed afterwards.
+func (s Settings) UpdateModerationSettings(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok := twitch_auth.StreamerID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	var request ModerationSettings
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	if request.AutoApproveSeconds < 0 || request.AutoApproveSeconds > maxAutoApproveSeconds {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.SR.UpdateModerationSettings(streamerID, request.HoldForReview, request.AutoApproveSeconds); err != nil {
+		return err
+	}
+	return writeJSON(w, request)
+}
@@ -0,0 +1,156 @@
+package sse
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// keepAlivePeriod is how often a comment is sent, so proxies don't close an idle stream.
+	keepAlivePeriod = 30 * time.Second
+	// maxMessageSize is the biggest overlay message accepted.
+	maxMessageSize = 4096
+)
+
+// SSE streams the overlay feed as Server-Sent Events. It is backed by the
+// same hub as the websocket feed, overlays send acks with POST requests.
+type SSE struct {
+	StreamerRepo streamer.StreamerRepo
+	Hub          *sockets.Hub
+}
+
+func (s SSE) Connect(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok, err := s.streamerID(r)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming is not supported by %T", w)
+	}
+
+	// EventSource sends the id of the last event it got when it reconnects,
+	// the id is the last alert the overlays have shown
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastSeq")
+	}
+	var lastSeq int64
+	if lastEventID != "" {
+		lastSeq, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastSeq < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	client, ok := s.Hub.Subscribe(streamerID, lastSeq)
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return nil
+	}
+	defer s.Hub.UnregisterClient(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlivePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame, ok := <-client.Frames():
+			if !ok {
+				return nil
+			}
+			// replayed alerts are acked after newer ones, the id never goes back
+			if frame.Type == sockets.FrameAcked {
+				if frame.Seq <= lastSeq {
+					continue
+				}
+				lastSeq = frame.Seq
+			}
+			if err := writeFrame(w, frame); err != nil {
+				log.Printf("can't send server-sent event. StreamerID: %d, Error: %v", streamerID, err)
+				return nil
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case <-r.Context().Done():
+			return nil
+		}
+		flusher.Flush()
+	}
+}
+
+// Message accepts a message from an overlay connected with Connect, e.g. an alert ack.
+func (s SSE) Message(w http.ResponseWriter, r *http.Request) error {
+	streamerID, ok, err := s.streamerID(r)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.Hub.HandleMessage(streamerID, data); err != nil {
+		log.Printf("bad overlay message. StreamerID: %d, Error: %v", streamerID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (s SSE) streamerID(r *http.Request) (int, bool, error) {
+	secretCode := mux.Vars(r)["secretCode"]
+	streamers, err := s.StreamerRepo.GetStreamers(streamer.Streamer{SecretCode: secretCode})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(streamers) == 0 {
+		log.Printf("Streamer not found. SecretCode: %s", secretCode)
+		return 0, false, nil
+	}
+	return streamers[0].ID, true, nil
+}
+
+// writeFrame writes frame as an event. Acked frames only set the event id
+// to the shown alert, so the browser resumes after it on a reconnect. Alerts
+// don't carry an id: one that was sent but not shown must be sent again.
+func writeFrame(w io.Writer, frame sockets.Frame) error {
+	if frame.Type == sockets.FrameAcked {
+		_, err := fmt.Fprintf(w, "id: %d\n\n", frame.Seq)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", frame.Type, frame.Data)
+	return err
+}
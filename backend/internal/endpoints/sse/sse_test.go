@@ -0,0 +1,149 @@
+//go:build unit
+// +build unit
+
+package sse
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
+	"github.com/gorilla/mux"
+)
+
+// storeMock keeps the alerts of streamer 0 until they are acked.
+type storeMock struct {
+	mu      sync.Mutex
+	pending []sockets.DonationEvent
+}
+
+func (s *storeMock) PendingAlerts(streamerID int) ([]sockets.DonationEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sockets.DonationEvent(nil), s.pending...), nil
+}
+
+func (s *storeMock) AckAlert(streamerID int, seq int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, d := range s.pending {
+		if d.Seq == seq {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *storeMock) RecentAlerts(streamerID int, limit int) ([]sockets.DonationEvent, error) {
+	return nil, nil
+}
+
+func TestConnect(t *testing.T) {
+	hub := sockets.CreateNew(&storeMock{pending: []sockets.DonationEvent{{Name: "missed", Seq: 7}, {Name: "next", Seq: 8}}}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	s := SSE{
+		StreamerRepo: &streamer.StreamerMock{Streamers: []streamer.Streamer{{ID: 0, SecretCode: "secret"}}},
+		Hub:          &hub,
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/sse/{secretCode}", func(w http.ResponseWriter, r *http.Request) { s.Connect(w, r) }).Methods(http.MethodGet)
+	r.HandleFunc("/sse/{secretCode}", func(w http.ResponseWriter, r *http.Request) { s.Message(w, r) }).Methods(http.MethodPost)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	connect := func(lastEventID string) (*http.Response, chan string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/sse/secret", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("expected text/event-stream, got %s", ct)
+		}
+		lines := make(chan string, 16)
+		go func() {
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+		return resp, lines
+	}
+	expectLine := func(lines chan string, prefix string) string {
+		t.Helper()
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("expected %q, stream is closed", prefix)
+				}
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+				if strings.HasPrefix(line, "id: ") {
+					t.Fatalf("expected %q, got %s", prefix, line)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("expected %q, got nothing", prefix)
+			}
+		}
+	}
+	post := func(body string) int {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/sse/secret", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Test case 1: the state comes first, then the pending alert without an id
+	resp, lines := connect("")
+	expectLine(lines, "event: state")
+	expectLine(lines, "event: alert")
+	if data := expectLine(lines, "data: "); !strings.Contains(data, `"name":"missed"`) {
+		t.Fatalf("expected missed alert, got %s", data)
+	}
+
+	// Test case 2: ack through POST moves the id to the shown alert and shows the next alert
+	if status := post(`{"v":1,"type":"ack","payload":{"seq":7}}`); status != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", status)
+	}
+	if id := expectLine(lines, "id: "); id != "id: 7" {
+		t.Fatalf("expected id: 7, got %s", id)
+	}
+	if data := expectLine(lines, "data: "); !strings.Contains(data, `"name":"next"`) {
+		t.Fatalf("expected next alert, got %s", data)
+	}
+
+	// Test case 3: an alert sent but not shown is sent again after a reconnect
+	resp.Body.Close()
+	resp, lines = connect("7")
+	defer resp.Body.Close()
+	expectLine(lines, "event: alert")
+	if data := expectLine(lines, "data: "); !strings.Contains(data, `"name":"next"`) {
+		t.Fatalf("expected next alert again, got %s", data)
+	}
+
+	// Test case 4: malformed messages are rejected
+	if status := post(`{"v":2,"type":"ack"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", status)
+	}
+}
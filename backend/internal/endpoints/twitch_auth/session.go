@@ -0,0 +1,43 @@
+package twitch_auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+)
+
+type contextKey int
+
+const streamerIDKey contextKey = iota
+
+// RequireSession lets the request through only for a logged in streamer.
+// The streamer's ID is available to f through StreamerID.
+func (t *Twitch) RequireSession(f func(w http.ResponseWriter, r *http.Request) error) func(w http.ResponseWriter, r *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		session, err := t.CookieStore.Get(r, oauthSessionName)
+		if err != nil {
+			log.Printf("corrupted session %s", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}
+
+		streamerID, ok := session.Values[oauthTokenKey].(int)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}
+
+		return f(w, r.WithContext(WithStreamerID(r.Context(), streamerID)))
+	}
+}
+
+// WithStreamerID returns ctx of a request authenticated as the streamer.
+func WithStreamerID(ctx context.Context, streamerID int) context.Context {
+	return context.WithValue(ctx, streamerIDKey, streamerID)
+}
+
+// StreamerID returns the ID of the streamer authenticated by RequireSession.
+func StreamerID(ctx context.Context) (int, bool) {
+	streamerID, ok := ctx.Value(streamerIDKey).(int)
+	return streamerID, ok
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/webhookevent"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/gorilla/mux"
+)
+
+// maxListedEvents caps how many webhook events are listed at once.
+const maxListedEvents = 100
+
+type EventResponse struct {
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int        `json:"attempts"`
+	ReceivedAt  time.Time  `json:"receivedAt"`
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+}
+
+// ListEvents lists received webhook events, optionally filtered by the status query parameter.
+func (we WebhookEndpoint) ListEvents(w http.ResponseWriter, r *http.Request) error {
+	limit := maxListedEvents
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListedEvents {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		limit = n
+	}
+
+	events, err := we.EventRepo.GetEvents(r.URL.Query().Get("status"), limit)
+	if err != nil {
+		return err
+	}
+
+	resp := make([]EventResponse, 0, len(events))
+	for _, e := range events {
+		resp = append(resp, newEventResponse(e))
+	}
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+// Redrive processes a failed webhook event again.
+func (we WebhookEndpoint) Redrive(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	provider, err := we.Providers.Get(vars["provider"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	id := vars["id"]
+	e, retried, err := we.EventRepo.Retry(provider.Name(), id)
+	if err != nil {
+		return err
+	}
+	if !retried {
+		if _, err := we.EventRepo.GetEvent(provider.Name(), id); errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		// only failed events are processed again
+		w.WriteHeader(http.StatusConflict)
+		return nil
+	}
+
+	// the payload was verified when the event was received
+	we.process(provider, payments.Event{ID: e.ID, Type: e.Type, Payload: e.Payload})
+
+	e, err = we.EventRepo.GetEvent(provider.Name(), id)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, newEventResponse(e))
+}
+
+func newEventResponse(e webhookevent.Event) EventResponse {
+	resp := EventResponse{
+		ID:         e.ID,
+		Provider:   e.Provider,
+		Type:       e.Type,
+		Status:     e.Status,
+		Error:      e.Error.String,
+		Attempts:   e.Attempts,
+		ReceivedAt: e.ReceivedAt,
+	}
+	if e.ProcessedAt.Valid {
+		resp.ProcessedAt = &e.ProcessedAt.Time
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) error {
+	respBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(respBytes)
+	return nil
+}
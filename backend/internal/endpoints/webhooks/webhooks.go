@@ -1,7 +1,7 @@
 package webhooks
 
 import (
-	"encoding/json"
+	"database/sql"
 	"fmt"
 	"io"
 	"log"
@@ -9,21 +9,42 @@ import (
 	"os"
 
 	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
-	"github.com/blindlobstar/donation-alarm/backend/internal/events"
-	"github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/webhook"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/mismatch"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/webhookevent"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
+	"github.com/gorilla/mux"
 )
 
-type WebhookConfig struct {
-	Secret string
-}
 type WebhookEndpoint struct {
 	DonationRepo donation.DonationRepo
-	EventEmitter events.EventEmitter
-	Config       WebhookConfig
+	StreamerRepo streamer.StreamerRepo
+	EventRepo    webhookevent.WebhookEventRepo
+	// SubscriptionRepo is used by providers that implement payments.Subscriptions.
+	SubscriptionRepo subscription.SubscriptionRepo
+	Providers        payments.Providers
+	// Settler applies the payment outcomes, its mismatches are recorded as the webhook's.
+	Settler settlement.Settler
+}
+
+func (we WebhookEndpoint) settler() settlement.Settler {
+	return we.Settler.WithSource(mismatch.SourceWebhook)
 }
 
+// HandleWebhook processes a webhook of the provider in the path, stripe by default.
 func (we WebhookEndpoint) HandleWebhook(w http.ResponseWriter, req *http.Request) {
+	providerName := mux.Vars(req)["provider"]
+	if providerName == "" {
+		providerName = payments.ProviderStripe
+	}
+	provider, err := we.Providers.Get(providerName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
 	const MaxBodyBytes = int64(65536)
 	req.Body = http.MaxBytesReader(w, req.Body, MaxBodyBytes)
 	payload, err := io.ReadAll(req.Body)
@@ -33,84 +54,154 @@ func (we WebhookEndpoint) HandleWebhook(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	event := stripe.Event{}
-
-	if err := json.Unmarshal(payload, &event); err != nil {
-		fmt.Fprintf(os.Stderr, "⚠️  Webhook error while parsing basic request. %v\n", err.Error())
-		w.WriteHeader(http.StatusBadRequest)
+	event, err := provider.VerifyWebhook(payload, req.Header)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "webhook verification failed. %v\n", err)
+		w.WriteHeader(http.StatusBadRequest) // Return a 400 error on a bad signature
 		return
 	}
 
-	signatureHeader := req.Header.Get("Stripe-Signature")
-	event, err = webhook.ConstructEvent(payload, signatureHeader, we.Config.Secret)
+	// providers retry webhooks, an event is processed again only if it failed
+	received, err := we.EventRepo.Receive(webhookevent.Event{ID: event.ID, Provider: providerName, Type: event.Type, Payload: payload})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "webhook signature verification failed. %v\n", err)
-		w.WriteHeader(http.StatusBadRequest) // Return a 400 error on a bad signature
+		log.Printf("error saving webhook event. EventID: %s, Error: %v\n", event.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !received {
+		log.Printf("duplicate webhook event. EventID: %s\n", event.ID)
+		w.WriteHeader(http.StatusOK)
 		return
 	}
-	// Unmarshal the event data into an appropriate struct depending on its Type
-	switch event.Type {
-	case "payment_intent.succeeded":
-		var paymentIntent stripe.PaymentIntent
-		err := json.Unmarshal(event.Data.Raw, &paymentIntent)
+
+	w.WriteHeader(we.process(provider, event))
+}
+
+// process handles a received event, records the outcome and returns the status code for the provider.
+func (we WebhookEndpoint) process(provider payments.Provider, event payments.Event) int {
+	code, err := we.handleEvent(provider, event)
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+		log.Printf("error processing webhook event. EventID: %s, Type: %s, Error: %v\n", event.ID, event.Type, err)
+	}
+
+	if err := we.EventRepo.Finish(provider.Name(), event.ID, errMsg); err != nil {
+		log.Printf("error saving webhook event result. EventID: %s, Error: %v\n", event.ID, err)
+	}
+	return code
+}
+
+func (we WebhookEndpoint) handleEvent(provider payments.Provider, event payments.Event) (int, error) {
+	if connect, ok := provider.(payments.Connect); ok {
+		account, ok, err := connect.ParseAccount(event)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error parsing webhook JSON: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return http.StatusBadRequest, err
 		}
-		log.Printf("successful payment for %d.", paymentIntent.Amount)
-		donations, err := we.DonationRepo.GetDonations(&donation.Donation{PaymentID: paymentIntent.ID})
-		if err != nil {
-			log.Printf("error getting donation with PaymentID: %s\n", paymentIntent.ID)
-			w.WriteHeader(http.StatusOK)
-			return
+		if ok {
+			if err := we.updateOnboarding(account); err != nil {
+				return http.StatusInternalServerError, err
+			}
+			return http.StatusOK, nil
 		}
-		if len(donations) < 1 {
-			log.Printf("Donation not found. PaymentID: %s\n", paymentIntent.ID)
-			w.WriteHeader(http.StatusOK)
-			return
+	}
+
+	if subscriptions, ok := provider.(payments.Subscriptions); ok {
+		outcome, ok, err := subscriptions.ParseSubscription(event)
+		if err != nil {
+			return http.StatusBadRequest, err
 		}
-		if len(donations) > 1 {
-			log.Printf("more than one donation found. PaymentID: %s\n", paymentIntent.ID)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		if ok {
+			if err := we.changeSubscription(provider.Name(), outcome); err != nil {
+				return http.StatusInternalServerError, err
+			}
+			return http.StatusOK, nil
 		}
+	}
 
-		if paymentIntent.Amount != int64(donations[0].Amount) {
-			log.Printf("wrong amount. expected: %d, got: %d. PaymentID: %s\n", donations[0].Amount, paymentIntent.Amount, paymentIntent.ID)
-		}
+	outcome, ok, err := provider.ParseOutcome(event)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if !ok {
+		return http.StatusOK, nil
+	}
 
-		donations[0].Status = donation.DonationStatusPayed
-		if err = we.DonationRepo.Update(donations[0]); err != nil {
-			log.Printf("can't update donation status after payment. DonationID: %d\n", donations[0].ID)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if err = we.EventEmitter.Publish(events.DonationPayed{
-			PaymentID:  donations[0].PaymentID,
-			Message:    donations[0].Message,
-			Name:       donations[0].Name,
-			Status:     donations[0].Status,
-			DonationID: donations[0].ID,
-			StreamerID: donations[0].StreamerID,
-			Amount:     donations[0].Amount,
-		}, "DonationPayed"); err != nil {
-			log.Printf("error publishing error. Err: %v", err)
-		}
+	if _, err := we.settler().Apply(outcome); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
 
-	case "payment_method.attached":
-		var paymentMethod stripe.PaymentMethod
-		err := json.Unmarshal(event.Data.Raw, &paymentMethod)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing webhook JSON: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+// changeSubscription records the subscription's status and stores a payed
+// monthly payment as a payed donation of the subscription.
+func (we WebhookEndpoint) changeSubscription(providerName string, so payments.SubscriptionOutcome) error {
+	sub, err := we.SubscriptionRepo.GetSubscription(providerName, so.SubscriptionID)
+	if err == sql.ErrNoRows {
+		log.Printf("Subscription not found. SubscriptionID: %s\n", so.SubscriptionID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting subscription. SubscriptionID: %s: %w", so.SubscriptionID, err)
+	}
+
+	if so.Status != sub.Status {
+		if err := we.SubscriptionRepo.UpdateStatus(sub.ID, so.Status); err != nil {
+			return fmt.Errorf("can't update subscription status. SubscriptionID: %s: %w", so.SubscriptionID, err)
 		}
-		// Then define and call a func to handle the successful attachment of a PaymentMethod.
-		// handlePaymentMethodAttached(paymentMethod)
-	default:
-		fmt.Fprintf(os.Stderr, "Unhandled event type: %s\n", event.Type)
+	}
+	if so.PaymentID == "" {
+		return nil
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// the donation is created once per invoice, a retried or concurrent event only pays it
+	d := donation.Donation{
+		PaymentID:       so.PaymentID,
+		Provider:        providerName,
+		StreamerID:      sub.StreamerID,
+		Amount:          sub.Amount,
+		Currency:        sub.Currency,
+		Fee:             sub.Fee,
+		NetAmount:       sub.NetAmount,
+		FeesCovered:     sub.FeesCovered,
+		Message:         sub.Message,
+		Name:            sub.Name,
+		Status:          donation.DonationStatusCreated,
+		SubscriptionID:  sql.NullInt64{Int64: int64(sub.ID), Valid: true},
+		FilterAction:    sub.FilterAction,
+		FilterDecisions: sub.FilterDecisions,
+		DonorName:       sub.DonorName,
+		DonorEmail:      sub.DonorEmail,
+		DonorIP:         sub.DonorIP,
+	}
+	if _, err := we.DonationRepo.CreateForSubscription(&d); err != nil {
+		return fmt.Errorf("can't create donation. SubscriptionID: %s: %w", so.SubscriptionID, err)
+	}
+
+	_, err = we.settler().Apply(payments.Outcome{
+		PaymentID: so.PaymentID,
+		Status:    donation.DonationStatusPayed,
+		Amount:    so.Amount,
+	})
+	return err
+}
+
+// updateOnboarding sets the onboarding status of the streamer with the account,
+// donations are only accepted once the account is enabled.
+func (we WebhookEndpoint) updateOnboarding(account payments.Account) error {
+	status := streamer.OnboardingStatusPending
+	if account.Enabled {
+		status = streamer.OnboardingStatusEnabled
+	} else if account.DetailsSubmitted {
+		status = streamer.OnboardingStatusRestricted
+	}
+
+	found, err := we.StreamerRepo.UpdateOnboardingStatus(account.ID, status)
+	if err != nil {
+		return fmt.Errorf("can't update onboarding status. AccountID: %s: %w", account.ID, err)
+	}
+	if !found {
+		log.Printf("Streamer not found. AccountID: %s\n", account.ID)
+	}
+	return nil
 }
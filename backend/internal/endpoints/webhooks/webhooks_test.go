@@ -0,0 +1,237 @@
+//go:build unit
+// +build unit
+
+package webhooks
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/webhookevent"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
+	"github.com/stripe/stripe-go/v75/webhook"
+)
+
+const (
+	testSecret        = "whsec_test"
+	testConnectSecret = "whsec_connect_test"
+)
+
+func sendEvent(t *testing.T, we WebhookEndpoint, id string, eventType string, object string) int {
+	t.Helper()
+	return sendSignedEvent(t, we, testSecret, id, eventType, object)
+}
+
+func sendSignedEvent(t *testing.T, we WebhookEndpoint, secret string, id string, eventType string, object string) int {
+	t.Helper()
+	payload := []byte(fmt.Sprintf(`{"id":%q,"object":"event","type":%q,"data":{"object":%s}}`, id, eventType, object))
+	now := time.Now()
+	signature := hex.EncodeToString(webhook.ComputeSignature(now, payload, secret))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", now.Unix(), signature))
+	rec := httptest.NewRecorder()
+	we.HandleWebhook(rec, req)
+	return rec.Code
+}
+
+func TestHandleWebhookDuplicates(t *testing.T) {
+	donations := donation.NewDonationMock()
+	eventRepo := webhookevent.NewWebhookEventMock()
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	streamers.UpdateCurrencies(s.ID, "EUR", []string{"EUR", "USD"})
+	we := WebhookEndpoint{
+		DonationRepo: donations,
+		StreamerRepo: streamers,
+		EventRepo:    eventRepo,
+		Providers:    payments.NewProviders(payments.NewStripe(payments.StripeConfig{WebhookSecret: testSecret, Fees: payments.StripeFees})),
+	}
+	we.Settler = settlement.Settler{Donations: donations, Streamers: streamers, Rates: money.StaticRates{Base: "USD", Rates: map[string]float64{"EUR": 0.5}}, Providers: we.Providers}
+
+	d := donation.Donation{PaymentID: "pi_1", Provider: payments.ProviderStripe, StreamerID: s.ID, Currency: "USD", Amount: 500, Fee: 45, NetAmount: 455, Status: donation.DonationStatusCreated}
+	donations.Create(&d)
+
+	// Test case 1: a retried event is processed once
+	succeeded := `{"id":"pi_1","object":"payment_intent","amount":500}`
+	for i := 0; i < 2; i++ {
+		if code := sendEvent(t, we, "evt_1", "payment_intent.succeeded", succeeded); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+	}
+	if len(donations.Outbox.Messages) != 1 || donations.Outbox.Messages[0].EventName != events.DonationPayedName {
+		t.Fatalf("expected 1 DonationPayed message, got %+v", donations.Outbox.Messages)
+	}
+
+	e, err := eventRepo.GetEvent(payments.ProviderStripe, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != webhookevent.StatusProcessed || e.Attempts != 1 {
+		t.Errorf("expected a processed event with 1 attempt, got %+v", e)
+	}
+
+	stored, _ := donations.GetDonation(d.ID)
+	if stored.HomeCurrency.String != "EUR" || stored.HomeAmount.Int64 != 250 || stored.ExchangeRate.Float64 != 0.5 {
+		t.Errorf("expected the donation converted to 250 EUR, got %+v", stored)
+	}
+	if stored.HomeNetAmount.Int64 != 228 {
+		t.Errorf("expected the net amount converted to 228 EUR, got %+v", stored)
+	}
+
+	// Test case 2: a late event doesn't move the donation back
+	processing := `{"id":"pi_1","object":"payment_intent"}`
+	if code := sendEvent(t, we, "evt_2", "payment_intent.processing", processing); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	stored, _ = donations.GetDonation(d.ID)
+	if stored.Status != donation.DonationStatusPayed {
+		t.Errorf("expected status %s, got %s", donation.DonationStatusPayed, stored.Status)
+	}
+
+	// Test case 3: a refund retracts the alert
+	refunded := `{"id":"ch_1","object":"charge","payment_intent":"pi_1","refunded":true,"amount_refunded":500}`
+	if code := sendEvent(t, we, "evt_3", "charge.refunded", refunded); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	stored, _ = donations.GetDonation(d.ID)
+	if stored.Status != donation.DonationStatusRefunded {
+		t.Errorf("expected status %s, got %s", donation.DonationStatusRefunded, stored.Status)
+	}
+	if len(donations.Outbox.Messages) != 2 || donations.Outbox.Messages[1].EventName != events.DonationRetractedName {
+		t.Fatalf("expected a DonationRetracted message, got %+v", donations.Outbox.Messages)
+	}
+}
+
+func TestHandleAccountUpdated(t *testing.T) {
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	streamers.SetPayoutAccount(s.ID, "acct_1")
+	we := WebhookEndpoint{
+		DonationRepo: donation.NewDonationMock(),
+		StreamerRepo: streamers,
+		EventRepo:    webhookevent.NewWebhookEventMock(),
+		Providers: payments.NewProviders(payments.NewStripe(payments.StripeConfig{
+			WebhookSecret:        testSecret,
+			ConnectWebhookSecret: testConnectSecret,
+			Fees:                 payments.StripeFees,
+		})),
+	}
+
+	cases := []struct {
+		id      string
+		account string
+		status  string
+	}{
+		{"evt_1", `{"id":"acct_1","object":"account","details_submitted":false}`, streamer.OnboardingStatusPending},
+		{"evt_2", `{"id":"acct_1","object":"account","details_submitted":true,"charges_enabled":true,"payouts_enabled":true}`, streamer.OnboardingStatusEnabled},
+		{"evt_3", `{"id":"acct_1","object":"account","details_submitted":true,"charges_enabled":true,"payouts_enabled":false}`, streamer.OnboardingStatusRestricted},
+	}
+	for _, tc := range cases {
+		if code := sendSignedEvent(t, we, testConnectSecret, tc.id, "account.updated", tc.account); code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+		got, _ := streamers.GetStreamerById(s.ID)
+		if got.OnboardingStatus != tc.status {
+			t.Errorf("expected onboarding status %s, got %s", tc.status, got.OnboardingStatus)
+		}
+	}
+
+	// events of unknown accounts are acknowledged
+	if code := sendSignedEvent(t, we, testConnectSecret, "evt_4", "account.updated", `{"id":"acct_2","object":"account"}`); code != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, code)
+	}
+	if code := sendSignedEvent(t, we, "whsec_other", "evt_5", "account.updated", `{"id":"acct_1","object":"account"}`); code != http.StatusBadRequest {
+		t.Errorf("expected status code %d for a bad signature, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestHandleSubscription(t *testing.T) {
+	donations := donation.NewDonationMock()
+	subscriptions := subscription.NewSubscriptionMock()
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	we := WebhookEndpoint{
+		DonationRepo:     donations,
+		StreamerRepo:     streamers,
+		EventRepo:        webhookevent.NewWebhookEventMock(),
+		Providers:        payments.NewProviders(payments.NewStripe(payments.StripeConfig{WebhookSecret: testSecret, Fees: payments.StripeFees})),
+		SubscriptionRepo: subscriptions,
+	}
+	we.Settler = settlement.Settler{Donations: donations, Streamers: streamers, Rates: money.StaticRates{Base: "USD"}, Providers: we.Providers}
+
+	sub := subscription.Subscription{
+		Provider:       payments.ProviderStripe,
+		SubscriptionID: "sub_1",
+		StreamerID:     s.ID,
+		Name:           "supporter",
+		Amount:         500,
+		Currency:       "USD",
+		Fee:            45,
+		NetAmount:      455,
+		Status:         subscription.StatusIncomplete,
+	}
+	subscriptions.Create(&sub)
+
+	// Test case 1: every payed invoice is a payed donation counting the months
+	for i, pi := range []string{"pi_s1", "pi_s1", "pi_s2"} {
+		invoice := fmt.Sprintf(`{"id":"in_%d","object":"invoice","subscription":"sub_1","payment_intent":%q,"amount_paid":500}`, i, pi)
+		if code := sendEvent(t, we, fmt.Sprintf("evt_invoice_%d", i), "invoice.paid", invoice); code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+	}
+
+	payed, _ := donations.GetDonations(&donation.Donation{Status: donation.DonationStatusPayed})
+	if len(payed) != 2 {
+		t.Fatalf("expected 2 payed donations, got %+v", payed)
+	}
+	if len(donations.Outbox.Messages) != 2 {
+		t.Fatalf("expected 2 DonationPayed messages, got %+v", donations.Outbox.Messages)
+	}
+	for i, m := range donations.Outbox.Messages {
+		e, err := events.Decode(m.EventName, m.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payedEvent, ok := e.(events.DonationPayed)
+		if !ok || !payedEvent.Recurring || payedEvent.Month != i+1 || payedEvent.NetAmount != 455 {
+			t.Errorf("expected a recurring donation of month %d, got %+v", i+1, e)
+		}
+	}
+	if got, _ := subscriptions.GetSubscription(payments.ProviderStripe, "sub_1"); got.Status != subscription.StatusActive {
+		t.Errorf("expected status %s, got %s", subscription.StatusActive, got.Status)
+	}
+
+	// Test case 2: the subscription's status follows the provider, a canceled one stays canceled
+	cases := []struct {
+		stripeStatus string
+		status       string
+	}{
+		{"past_due", subscription.StatusPastDue},
+		{"canceled", subscription.StatusCanceled},
+		{"active", subscription.StatusCanceled},
+	}
+	for i, tc := range cases {
+		object := fmt.Sprintf(`{"id":"sub_1","object":"subscription","status":%q}`, tc.stripeStatus)
+		if code := sendEvent(t, we, fmt.Sprintf("evt_sub_%d", i), "customer.subscription.updated", object); code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+		if got, _ := subscriptions.GetSubscription(payments.ProviderStripe, "sub_1"); got.Status != tc.status {
+			t.Errorf("expected status %s, got %s", tc.status, got.Status)
+		}
+	}
+}
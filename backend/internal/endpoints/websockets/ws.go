@@ -3,6 +3,7 @@ package websockets
 import (
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
 	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
@@ -29,11 +30,22 @@ func (ws WebSockets) Connect(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
+	// lastSeq is the sequence number of the last alert the overlay has shown
+	var lastSeq int64
+	if v := r.URL.Query().Get("lastSeq"); v != "" {
+		lastSeq, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lastSeq < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+	}
+
 	c, err := ws.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return err
 	}
 
-	ws.Hub.RegisterClient(c, streamers[0].ID)
+	// unacknowledged alerts are loaded by the hub and shown one by one
+	ws.Hub.RegisterClient(c, streamers[0].ID, lastSeq)
 	return nil
 }
@@ -1,50 +1,233 @@
 package cevents
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"sync"
 
 	"github.com/blindlobstar/donation-alarm/backend/internal/events"
 )
 
+// subscriberQueueSize is how many events a single subscriber may lag behind
+// before the bus starts waiting for it.
+const subscriberQueueSize = 64
+
+var (
+	ErrBusStopped = errors.New("event bus is stopped")
+	ErrBusRunning = errors.New("event bus is already running")
+)
+
+type subscriber struct {
+	// id tells the subscribers of an event apart across restarts, it's the
+	// handler's type, numbered if the event has several handlers of a type.
+	id      string
+	name    string
+	handler events.EventHandler
+	queue   chan delivery
+}
+
+// delivery is an event queued for a subscriber, ack is called once it has run the handler
+// with whether the handler succeeded.
+type delivery struct {
+	payload any
+	ack     func(id string, ok bool)
+}
+
+// EventBus delivers published events to every handler registered for the
+// event name. Each handler runs in its own goroutine, so a slow, failing or
+// panicking handler does not affect the others.
 type EventBus struct {
-	c               chan events.Event
-	eventHandlerMap map[string]events.EventHandler
+	c           chan events.Event
+	mu          sync.RWMutex
+	subscribers map[string][]*subscriber
+	running     bool
+	// stopMu makes publishing atomic with stopping, so no event is buffered
+	// after Run has drained the buffer.
+	stopMu  sync.RWMutex
+	stopped bool
+	done    chan struct{}
 }
 
 func New(c chan events.Event) EventBus {
 	return EventBus{
-		c:               c,
-		eventHandlerMap: make(map[string]events.EventHandler),
+		c:           c,
+		subscribers: make(map[string][]*subscriber),
+		done:        make(chan struct{}),
 	}
 }
 
+// RegisterHandler subscribes handler to events with the given name.
+// Handlers must be registered before Run is called.
 func (eb *EventBus) RegisterHandler(handler events.EventHandler, name string) error {
-	if _, ok := eb.eventHandlerMap[name]; ok {
-		return errors.New("event handler already exists")
+	if handler == nil {
+		return errors.New("event handler is nil")
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.running {
+		return ErrBusRunning
+	}
+
+	id := fmt.Sprintf("%T", handler)
+	n := 1
+	for _, sub := range eb.subscribers[name] {
+		if fmt.Sprintf("%T", sub.handler) == id {
+			n++
+		}
+	}
+	if n > 1 {
+		id = fmt.Sprintf("%s#%d", id, n)
 	}
-	eb.eventHandlerMap[name] = handler
+	eb.subscribers[name] = append(eb.subscribers[name], &subscriber{
+		id:      id,
+		name:    name,
+		handler: handler,
+		queue:   make(chan delivery, subscriberQueueSize),
+	})
 	return nil
 }
 
-func (eb *EventBus) Publish(payload any, name string) error {
-	eb.c <- events.Event{
-		Payload: payload,
-		Name:    name,
+func (eb *EventBus) Publish(payload any, name string, skip []string, handled func(events.Ack)) error {
+	eb.stopMu.RLock()
+	defer eb.stopMu.RUnlock()
+	// a stopped bus may still have room in its buffer, nobody would dispatch from it
+	if eb.stopped {
+		return ErrBusStopped
+	}
+	select {
+	case eb.c <- events.Event{Payload: payload, Name: name, Skip: skip, Handled: handled}:
+		return nil
+	case <-eb.done:
+		return ErrBusStopped
 	}
-	return nil
 }
 
-func (eb *EventBus) Run() {
-	event := <-eb.c
+// Run dispatches events until ctx is cancelled. On cancellation it stops
+// accepting new events, dispatches the buffered ones, lets every subscriber
+// finish its queued events and returns. It returns ErrBusRunning if the bus
+// was already started.
+func (eb *EventBus) Run(ctx context.Context) error {
+	eb.mu.Lock()
+	if eb.running {
+		eb.mu.Unlock()
+		return ErrBusRunning
+	}
+	eb.running = true
+	eb.mu.Unlock()
 
-	handler, ok := eb.eventHandlerMap[event.Name]
+	var wg sync.WaitGroup
+	for _, subs := range eb.subscribers {
+		for _, sub := range subs {
+			wg.Add(1)
+			go func(s *subscriber) {
+				defer wg.Done()
+				s.run()
+			}(sub)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// wakes the publishers waiting for room, once they're gone nothing is published
+			close(eb.done)
+			eb.stopMu.Lock()
+			eb.stopped = true
+			eb.stopMu.Unlock()
+			// published events are not lost, the subscribers are still running
+			for drained := false; !drained; {
+				select {
+				case event := <-eb.c:
+					eb.dispatch(event)
+				default:
+					drained = true
+				}
+			}
+			for _, subs := range eb.subscribers {
+				for _, sub := range subs {
+					close(sub.queue)
+				}
+			}
+			wg.Wait()
+			return nil
+		case event := <-eb.c:
+			eb.dispatch(event)
+		}
+	}
+}
+
+// dispatch queues the event for its subscribers that haven't handled it yet,
+// waiting for the ones that lag behind.
+func (eb *EventBus) dispatch(event events.Event) {
+	all, ok := eb.subscribers[event.Name]
 	if !ok {
 		log.Printf("eventhandler not found. EventName: %s\n", event.Name)
+	}
+	subs := make([]*subscriber, 0, len(all))
+	for _, sub := range all {
+		if !contains(event.Skip, sub.id) {
+			subs = append(subs, sub)
+		}
+	}
+	if len(subs) == 0 {
+		if event.Handled != nil {
+			event.Handled(events.Ack{})
+		}
 		return
 	}
 
-	if err := handler.Handle(event.Payload); err != nil {
-		log.Printf("error while handling event. Name: %s, Error: %v\n", event.Name, err)
+	ack := func(string, bool) {}
+	if event.Handled != nil {
+		var (
+			mu     sync.Mutex
+			result events.Ack
+		)
+		ack = func(id string, ok bool) {
+			mu.Lock()
+			if ok {
+				result.Handled = append(result.Handled, id)
+			} else {
+				result.Failed = append(result.Failed, id)
+			}
+			last := len(result.Handled)+len(result.Failed) == len(subs)
+			mu.Unlock()
+			if last {
+				event.Handled(result)
+			}
+		}
 	}
+	for _, sub := range subs {
+		sub.queue <- delivery{payload: event.Payload, ack: ack}
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *subscriber) run() {
+	for d := range s.queue {
+		err := s.handle(d.payload)
+		if err != nil {
+			log.Printf("error while handling event. Name: %s, Handler: %T, Error: %v\n", s.name, s.handler, err)
+		}
+		d.ack(s.id, err == nil)
+	}
+}
+
+func (s *subscriber) handle(payload any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return s.handler.Handle(payload)
 }
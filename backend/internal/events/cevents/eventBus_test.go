@@ -0,0 +1,228 @@
+//go:build unit
+// +build unit
+
+package cevents
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+)
+
+type handlerFunc func(event any) error
+
+func (f handlerFunc) Handle(event any) error {
+	return f(event)
+}
+
+func TestEventBus(t *testing.T) {
+	bus := New(make(chan events.Event))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	received := map[string]int{}
+	record := func(name string) handlerFunc {
+		return func(event any) error {
+			defer wg.Done()
+			mu.Lock()
+			received[name]++
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	bus.RegisterHandler(record("overlay"), "DonationPayed")
+	bus.RegisterHandler(record("analytics"), "DonationPayed")
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		defer wg.Done()
+		panic("broken consumer")
+	}), "DonationPayed")
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		defer wg.Done()
+		return errors.New("failing consumer")
+	}), "DonationPayed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		bus.Run(ctx)
+		close(stopped)
+	}()
+
+	// Test case 1: the bus keeps running after the first event
+	// and every subscriber receives every event
+	wg.Add(3 * 4)
+	for i := 0; i < 3; i++ {
+		if err := bus.Publish(events.DonationPayed{DonationID: i}, "DonationPayed", nil, nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	wg.Wait()
+
+	if received["overlay"] != 3 || received["analytics"] != 3 {
+		t.Fatalf("expected 3 events per subscriber, got %v", received)
+	}
+
+	// Test case 2: registration is rejected while running
+	if err := bus.RegisterHandler(record("late"), "DonationPayed"); err != ErrBusRunning {
+		t.Fatalf("expected ErrBusRunning, got %v", err)
+	}
+
+	// Test case 3: the bus can't be started twice
+	if err := bus.Run(ctx); err != ErrBusRunning {
+		t.Fatalf("expected ErrBusRunning, got %v", err)
+	}
+
+	// Test case 4: bus stops on context cancellation
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("event bus didn't stop after context cancellation")
+	}
+
+	if err := bus.Publish(events.DonationPayed{}, "DonationPayed", nil, nil); err != ErrBusStopped {
+		t.Fatalf("expected ErrBusStopped, got %v", err)
+	}
+}
+
+func TestEventBusShutdown(t *testing.T) {
+	bus := New(make(chan events.Event, 8))
+	var mu sync.Mutex
+	handled := 0
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		mu.Lock()
+		handled++
+		mu.Unlock()
+		return nil
+	}), "DonationPayed")
+
+	for i := 0; i < 5; i++ {
+		if err := bus.Publish(events.DonationPayed{DonationID: i}, "DonationPayed", nil, nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Test case 1: events still buffered when the bus stops are handled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bus.Run(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if handled != 5 {
+		t.Fatalf("expected 5 handled events, got %d", handled)
+	}
+}
+
+func TestEventBusHandled(t *testing.T) {
+	bus := New(make(chan events.Event))
+	release := make(chan struct{})
+	bus.RegisterHandler(handlerFunc(func(event any) error { return nil }), "DonationPayed")
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		<-release
+		if event.(events.DonationPayed).DonationID == 2 {
+			return errors.New("failing consumer")
+		}
+		return nil
+	}), "DonationPayed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bus.Run(ctx)
+	publish := func(id int, name string, skip []string) chan events.Ack {
+		t.Helper()
+		acks := make(chan events.Ack, 1)
+		if err := bus.Publish(events.DonationPayed{DonationID: id}, name, skip, func(a events.Ack) { acks <- a }); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return acks
+	}
+	wait := func(acks chan events.Ack) events.Ack {
+		t.Helper()
+		select {
+		case a := <-acks:
+			return a
+		case <-time.After(time.Second):
+			t.Fatalf("expected the event to be handled")
+			return events.Ack{}
+		}
+	}
+
+	// Test case 1: an event is handled once every handler has run
+	acks := publish(1, "DonationPayed", nil)
+	select {
+	case <-acks:
+		t.Fatalf("expected the event to wait for the slow handler")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if a := wait(acks); !a.OK() || len(a.Handled) != 2 {
+		t.Fatalf("expected both handlers to succeed, got %+v", a)
+	}
+
+	// Test case 2: the failed handlers are reported
+	a := wait(publish(2, "DonationPayed", nil))
+	if a.OK() || len(a.Handled) != 1 || len(a.Failed) != 1 || a.Handled[0] == a.Failed[0] {
+		t.Fatalf("expected one handler to succeed and one to fail, got %+v", a)
+	}
+
+	// Test case 3: the handlers that succeeded are skipped
+	retried := wait(publish(2, "DonationPayed", a.Handled))
+	if len(retried.Handled) != 0 || len(retried.Failed) != 1 || retried.Failed[0] != a.Failed[0] {
+		t.Fatalf("expected only the failed handler to run, got %+v", retried)
+	}
+
+	// Test case 4: an event without handlers is handled right away
+	if a := wait(publish(1, "Unknown", nil)); !a.OK() {
+		t.Fatalf("expected the event to be handled, got %+v", a)
+	}
+}
+
+func TestEventBusPublishWhileStopping(t *testing.T) {
+	bus := New(make(chan events.Event, 8))
+	handled := 0
+	var mu sync.Mutex
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		mu.Lock()
+		handled++
+		mu.Unlock()
+		return nil
+	}), "DonationPayed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		bus.Run(ctx)
+		close(stopped)
+	}()
+
+	// Test case 1: every event accepted while the bus stops is handled
+	var wg sync.WaitGroup
+	published := 0
+	for p := 0; p < 8; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				if err := bus.Publish(events.DonationPayed{DonationID: i}, "DonationPayed", nil, nil); err != nil {
+					return
+				}
+				mu.Lock()
+				published++
+				mu.Unlock()
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	<-stopped
+
+	if handled != published {
+		t.Fatalf("expected %d handled events, got %d", published, handled)
+	}
+}
@@ -0,0 +1,14 @@
+package events
+
+const DonationApprovedName = "DonationApproved"
+
+// DonationApproved is published when a donation held for review is approved,
+// so its alert can be shown.
+type DonationApproved struct {
+	PaymentID  string
+	Message    string
+	DonationID int
+	StreamerID int
+	// Auto is set when the review deadline passed without the streamer's decision.
+	Auto bool
+}
@@ -0,0 +1,12 @@
+package events
+
+const DonationFailedName = "DonationFailed"
+
+// DonationFailed is published when a payment fails or is canceled.
+type DonationFailed struct {
+	PaymentID  string
+	Status     string
+	Reason     string
+	DonationID int
+	StreamerID int
+}
@@ -1,5 +1,7 @@
 package events
 
+const DonationPayedName = "DonationPayed"
+
 type DonationPayed struct {
 	PaymentID  string
 	Message    string
@@ -7,5 +9,16 @@ type DonationPayed struct {
 	Status     string
 	DonationID int
 	StreamerID int
-	Amount     int
+	// Amount is what the donor paid, in the minor unit of Currency.
+	Amount   int64
+	Currency string
+	// NetAmount is Amount less the provider's Fee, what the streamer receives.
+	Fee         int64
+	NetAmount   int64
+	FeesCovered bool
+	// Recurring is set for the monthly payments of a subscription, Month counts them from 1.
+	Recurring bool
+	Month     int
+	// HeldForReview is set when the donation's alert waits for the streamer's approval.
+	HeldForReview bool
 }
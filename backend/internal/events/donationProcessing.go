@@ -0,0 +1,10 @@
+package events
+
+const DonationProcessingName = "DonationProcessing"
+
+// DonationProcessing is published when a payment is accepted but not settled yet.
+type DonationProcessing struct {
+	PaymentID  string
+	DonationID int
+	StreamerID int
+}
@@ -0,0 +1,15 @@
+package events
+
+const DonationRetractedName = "DonationRetracted"
+
+// DonationRetracted is published when a payed donation is refunded or disputed,
+// so its alert can be taken off the overlays.
+type DonationRetracted struct {
+	PaymentID  string
+	Status     string
+	AlertSeq   int64
+	DonationID int
+	StreamerID int
+	Amount     int64
+	Currency   string
+}
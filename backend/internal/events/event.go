@@ -1,6 +1,54 @@
 package events
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type Event struct {
 	Payload any
 	Name    string
+	// Skip are the subscribers that already handled the event, it's not handed to them again.
+	Skip []string
+	// Handled is called once every other subscriber has run, it may be nil.
+	Handled func(Ack)
+}
+
+// Ack tells which subscribers handled an event and which of them failed.
+type Ack struct {
+	Handled []string
+	Failed  []string
+}
+
+// OK reports whether no subscriber failed.
+func (a Ack) OK() bool {
+	return len(a.Failed) == 0
+}
+
+// Decode restores a serialized event payload to its concrete type.
+func Decode(name string, data []byte) (any, error) {
+	switch name {
+	case DonationPayedName:
+		var e DonationPayed
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case DonationProcessingName:
+		var e DonationProcessing
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case DonationFailedName:
+		var e DonationFailed
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case DonationApprovedName:
+		var e DonationApproved
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case DonationRetractedName:
+		var e DonationRetracted
+		err := json.Unmarshal(data, &e)
+		return e, err
+	default:
+		return nil, fmt.Errorf("unknown event: %s", name)
+	}
 }
@@ -1,5 +1,8 @@
 package events
 
 type EventEmitter interface {
-	Publish(event any, name string) error
+	// Publish hands the event to the handlers of every subscriber but the skipped ones.
+	// handled is called once all of them have run with the ones that succeeded and
+	// failed, it may be nil.
+	Publish(event any, name string, skip []string, handled func(Ack)) error
 }
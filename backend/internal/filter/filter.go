@@ -0,0 +1,352 @@
+package filter
+
+import (
+	"bufio"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// ActionMask replaces the matched text with asterisks, links are removed.
+	ActionMask = "MASK"
+	// ActionModerate holds the donation for the streamer's review.
+	ActionModerate = "MODERATE"
+	// ActionReject refuses the donation.
+	ActionReject = "REJECT"
+)
+
+const (
+	// KindWordList matches the built-in word list of the language in Value.
+	KindWordList = "WORDLIST"
+	// KindWord matches the word or phrase in Value.
+	KindWord = "WORD"
+	// KindPattern matches the regular expression in Value against
+	// the lowercase text without accents and with lookalike letters replaced.
+	KindPattern = "PATTERN"
+	// KindLink matches web addresses.
+	KindLink = "LINK"
+)
+
+const (
+	FieldName    = "name"
+	FieldMessage = "message"
+)
+
+const (
+	maxRules         = 100
+	maxWordLength    = 100
+	maxPatternLength = 200
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid filter rule")
+
+	//go:embed words/*.txt
+	wordFiles embed.FS
+	// wordLists are the folded phrases of the built-in word lists by language.
+	wordLists = loadWordLists()
+
+	linkPattern = regexp.MustCompile(`(?:https?://|www\.)\S+|` +
+		`[a-z0-9][a-z0-9-]*(?:\.[a-z0-9-]+)*\.(?:app|biz|cc|co|com|de|dev|eu|fr|gg|info|io|link|ly|me|net|org|ru|to|tv|uk|us|xyz)\b(?:/\S*)?`)
+
+	actionRanks = map[string]int{ActionMask: 1, ActionModerate: 2, ActionReject: 3}
+)
+
+// Rule is a streamer's filter rule and what's done with the donations it matches.
+type Rule struct {
+	Kind string `json:"kind"`
+	// Value is the language of a word list, the word or the pattern, links have none.
+	Value  string `json:"value,omitempty"`
+	Action string `json:"action"`
+}
+
+// Settings are a streamer's filter rules.
+type Settings struct {
+	Rules []Rule `json:"rules"`
+}
+
+// DefaultSettings apply to streamers who didn't set up their filter.
+var DefaultSettings = Settings{Rules: []Rule{
+	{Kind: KindWordList, Value: "en", Action: ActionMask},
+	{Kind: KindLink, Action: ActionMask},
+}}
+
+// ParseSettings reads settings stored with Settings.String, empty settings are DefaultSettings.
+func ParseSettings(raw string) (Settings, error) {
+	if raw == "" {
+		return DefaultSettings, nil
+	}
+	var s Settings
+	err := json.Unmarshal([]byte(raw), &s)
+	return s, err
+}
+
+func (s Settings) String() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Languages returns the languages there are built-in word lists for.
+func Languages() []string {
+	res := make([]string, 0, len(wordLists))
+	for lang := range wordLists {
+		res = append(res, lang)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Decision records a rule matching a donation.
+type Decision struct {
+	Field  string `json:"field"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value,omitempty"`
+	Action string `json:"action"`
+	// Match is the text the rule matched, as the donor wrote it.
+	Match string `json:"match"`
+}
+
+// Result is a donation's name and message after filtering.
+type Result struct {
+	Name    string
+	Message string
+	// Action is the strictest action of the Decisions, empty if no rule matched.
+	Action    string
+	Decisions []Decision
+}
+
+// Rejected reports whether the donation must be refused.
+func (r Result) Rejected() bool {
+	return r.Action == ActionReject
+}
+
+// DecisionsJSON returns the decisions to store with the donation, empty if there are none.
+func (r Result) DecisionsJSON() string {
+	if len(r.Decisions) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(r.Decisions)
+	return string(data)
+}
+
+// ParseDecisions reads the decisions stored with a donation, none if raw is empty.
+func ParseDecisions(raw string) ([]Decision, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var decisions []Decision
+	err := json.Unmarshal([]byte(raw), &decisions)
+	return decisions, err
+}
+
+// Filter applies a streamer's rules to donations.
+type Filter struct {
+	rules []rule
+}
+
+type rule struct {
+	Rule
+	// phrases are the folded phrases of words and word lists, by their first token.
+	phrases map[string][][]string
+	pattern *regexp.Regexp
+}
+
+// New compiles the settings. It returns ErrInvalidRule if a rule is invalid.
+func New(s Settings) (Filter, error) {
+	if len(s.Rules) > maxRules {
+		return Filter{}, fmt.Errorf("%w: more than %d rules", ErrInvalidRule, maxRules)
+	}
+
+	f := Filter{rules: make([]rule, 0, len(s.Rules))}
+	for _, r := range s.Rules {
+		if _, ok := actionRanks[r.Action]; !ok {
+			return Filter{}, fmt.Errorf("%w: unknown action %q", ErrInvalidRule, r.Action)
+		}
+
+		compiled := rule{Rule: r}
+		switch r.Kind {
+		case KindWordList:
+			list, ok := wordLists[r.Value]
+			if !ok {
+				return Filter{}, fmt.Errorf("%w: no word list for %q", ErrInvalidRule, r.Value)
+			}
+			compiled.phrases = byFirstToken(list)
+		case KindWord:
+			p := phrase(r.Value)
+			if len(p) == 0 || len(r.Value) > maxWordLength {
+				return Filter{}, fmt.Errorf("%w: invalid word %q", ErrInvalidRule, r.Value)
+			}
+			compiled.phrases = byFirstToken([][]string{p})
+		case KindPattern:
+			if r.Value == "" || len(r.Value) > maxPatternLength {
+				return Filter{}, fmt.Errorf("%w: invalid pattern %q", ErrInvalidRule, r.Value)
+			}
+			pattern, err := regexp.Compile("(?i)" + r.Value)
+			if err != nil {
+				return Filter{}, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+			}
+			compiled.pattern = pattern
+		case KindLink:
+			compiled.pattern = linkPattern
+		default:
+			return Filter{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, r.Kind)
+		}
+		f.rules = append(f.rules, compiled)
+	}
+	return f, nil
+}
+
+// Screen normalizes the donation's name and message and applies the rules to both.
+func (f Filter) Screen(name string, message string) Result {
+	var res Result
+	res.Name = f.apply(FieldName, name, &res)
+	res.Message = f.apply(FieldMessage, message, &res)
+	for _, d := range res.Decisions {
+		if actionRanks[d.Action] > actionRanks[res.Action] {
+			res.Action = d.Action
+		}
+	}
+	return res
+}
+
+// apply returns text with the masked matches replaced, the decisions are added to res.
+func (f Filter) apply(field string, text string, res *Result) string {
+	text = Normalize(text)
+	if len(f.rules) == 0 || text == "" {
+		return text
+	}
+
+	original := []rune(text)
+	folded, index := fold(original)
+	tokens := tokenize(unleet(folded))
+
+	masked := make([]bool, len(original))
+	removed := make([]bool, len(original))
+	for _, r := range f.rules {
+		for _, m := range r.match(folded, tokens) {
+			// a match of folded runes covers every rune of text they came from
+			start, end := index[m[0]], index[m[1]-1]+1
+			res.Decisions = append(res.Decisions, Decision{
+				Field:  field,
+				Kind:   r.Kind,
+				Value:  r.Value,
+				Action: r.Action,
+				Match:  string(original[start:end]),
+			})
+			if r.Action != ActionMask {
+				continue
+			}
+			for i := start; i < end; i++ {
+				if r.Kind == KindLink {
+					removed[i] = true
+				} else {
+					masked[i] = true
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	stripped := false
+	for i, r := range original {
+		switch {
+		case removed[i]:
+			stripped = true
+		case masked[i] && unicode.Is(unicode.Mn, r):
+		case masked[i] && !unicode.IsSpace(r):
+			b.WriteRune('*')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if stripped {
+		return strings.Join(strings.Fields(b.String()), " ")
+	}
+	return b.String()
+}
+
+// match returns the ranges of folded runes the rule matches.
+func (r rule) match(folded []rune, tokens []token) [][2]int {
+	var matches [][2]int
+	if r.pattern != nil {
+		text := string(folded)
+		// the pattern reports byte offsets of text
+		runeAt := make([]int, len(text)+1)
+		n := 0
+		for i := range text {
+			runeAt[i] = n
+			n++
+		}
+		runeAt[len(text)] = n
+		for _, loc := range r.pattern.FindAllStringIndex(text, -1) {
+			if loc[0] < loc[1] {
+				matches = append(matches, [2]int{runeAt[loc[0]], runeAt[loc[1]]})
+			}
+		}
+		return matches
+	}
+
+	for i, t := range tokens {
+		for _, p := range r.phrases[t.text] {
+			if i+len(p) > len(tokens) {
+				continue
+			}
+			ok := true
+			for j := 1; j < len(p) && ok; j++ {
+				ok = tokens[i+j].text == p[j]
+			}
+			if ok {
+				matches = append(matches, [2]int{t.start, tokens[i+len(p)-1].end})
+			}
+		}
+	}
+	return matches
+}
+
+func byFirstToken(phrases [][]string) map[string][][]string {
+	res := make(map[string][][]string, len(phrases))
+	for _, p := range phrases {
+		res[p[0]] = append(res[p[0]], p)
+	}
+	return res
+}
+
+func loadWordLists() map[string][][]string {
+	entries, err := wordFiles.ReadDir("words")
+	if err != nil {
+		panic(err)
+	}
+
+	lists := make(map[string][][]string, len(entries))
+	for _, e := range entries {
+		file, err := wordFiles.Open(path.Join("words", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		lang := strings.TrimSuffix(e.Name(), ".txt")
+		// spellings with and without accents fold to the same phrase
+		seen := map[string]bool{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			p := phrase(line)
+			key := strings.Join(p, " ")
+			if len(p) > 0 && !seen[key] {
+				seen[key] = true
+				lists[lang] = append(lists[lang], p)
+			}
+		}
+		file.Close()
+	}
+	return lists
+}
@@ -0,0 +1,88 @@
+//go:build unit
+// +build unit
+
+package filter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScreen(t *testing.T) {
+	f, err := New(Settings{Rules: []Rule{
+		{Kind: KindWordList, Value: "en", Action: ActionMask},
+		{Kind: KindWord, Value: "bad streamer", Action: ActionModerate},
+		{Kind: KindPattern, Value: `\d{4,}`, Action: ActionReject},
+		{Kind: KindLink, Action: ActionMask},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		message string
+		want    string
+		action  string
+	}{
+		// Test case 1: clean messages are kept
+		{"clean", "Great stream, have fun!", "Great stream, have fun!", ""},
+		// Test case 2: words are masked however they are written
+		{"mask", "what the FUCK", "what the ****", ActionMask},
+		{"accents", "what the fûçk", "what the ****", ActionMask},
+		{"lookalikes", "what the fuсk", "what the ****", ActionMask},
+		{"leetspeak", "what a $h1t game", "what a **** game", ActionMask},
+		// Test case 3: words in other words are kept
+		{"substring", "classic", "classic", ""},
+		// Test case 4: links are removed
+		{"link", "follow me at https://example.com/x now", "follow me at now", ActionMask},
+		{"domain", "join discord.gg/abc", "join", ActionMask},
+		// Test case 5: phrases send the donation to moderation
+		{"phrase", "you are a bad   streamer", "you are a bad   streamer", ActionModerate},
+		// Test case 6: the strictest action wins
+		{"reject", "fuck, call 5551234", "****, call 5551234", ActionReject},
+		// Test case 7: zalgo text is cleaned up
+		{"zalgo", "he\u0301\u0302\u0303\u0304llo\u200b", "h\u00e9\u0302\u0303llo", ""},
+	}
+	for _, tc := range cases {
+		res := f.Screen("", tc.message)
+		if res.Message != tc.want || res.Action != tc.action {
+			t.Errorf("%s: expected %q with action %q, got %q with action %q", tc.name, tc.want, tc.action, res.Message, res.Action)
+		}
+	}
+
+	// Test case 8: names are filtered and decisions record the original text
+	res := f.Screen("sh1thead fucker", "")
+	if res.Name != "sh1thead ******" || len(res.Decisions) != 1 {
+		t.Fatalf("expected the name to be masked with 1 decision, got %+v", res)
+	}
+	d := res.Decisions[0]
+	if d.Field != FieldName || d.Kind != KindWordList || d.Value != "en" || d.Match != "fucker" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, r := range []Rule{
+		{Kind: KindWordList, Value: "xx", Action: ActionMask},
+		{Kind: KindWord, Value: "  ", Action: ActionMask},
+		{Kind: KindPattern, Value: "(", Action: ActionMask},
+		{Kind: KindLink, Action: "DROP"},
+		{Kind: "EMOJI", Action: ActionMask},
+	} {
+		if _, err := New(Settings{Rules: []Rule{r}}); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("expected rule %+v to be invalid, got %v", r, err)
+		}
+	}
+
+	s, err := ParseSettings("")
+	if err != nil || len(s.Rules) != len(DefaultSettings.Rules) {
+		t.Fatalf("expected the default settings, got %+v, %v", s, err)
+	}
+	if s, err = ParseSettings(DefaultSettings.String()); err != nil || len(s.Rules) != len(DefaultSettings.Rules) {
+		t.Errorf("expected stored settings to be read back, got %+v, %v", s, err)
+	}
+	if _, err := New(s); err != nil {
+		t.Errorf("expected the default settings to be valid, got %v", err)
+	}
+}
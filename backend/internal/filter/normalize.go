@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxMarks caps the combining marks kept on a letter, more are zalgo text.
+const maxMarks = 2
+
+// zeroWidthJoiner joins emoji sequences, it's the only format character kept.
+const zeroWidthJoiner = '\u200d'
+
+// confusables maps letters that look like latin ones to the latin letter.
+var confusables = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'і': 'i', 'ј': 'j', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'μ': 'u', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	// latin lookalikes
+	'ı': 'i', 'ɡ': 'g', 'ɑ': 'a', 'ʏ': 'y',
+}
+
+// leetspeak maps the digits and symbols written in place of letters to the letter.
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
+
+// Normalize cleans up text before it's shown: it's composed to NFC, control and
+// invisible format characters are dropped and letters keep at most maxMarks combining marks.
+func Normalize(text string) string {
+	var b strings.Builder
+	marks := 0
+	for _, r := range norm.NFC.String(text) {
+		switch {
+		case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+			marks++
+			if marks > maxMarks {
+				continue
+			}
+		case r == '\n' || r == '\t':
+			marks = 0
+		case unicode.IsControl(r) || (unicode.Is(unicode.Cf, r) && r != zeroWidthJoiner):
+			continue
+		default:
+			marks = 0
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fold reduces text to lowercase letters without marks, with confusable
+// letters replaced by latin ones, so rules match however the text is written.
+// It returns the folded runes with the index of the rune of text each came from.
+func fold(text []rune) ([]rune, []int) {
+	folded := make([]rune, 0, len(text))
+	index := make([]int, 0, len(text))
+	for i, r := range text {
+		for _, fr := range norm.NFKD.String(string(r)) {
+			if unicode.Is(unicode.Mn, fr) || unicode.Is(unicode.Cf, fr) {
+				continue
+			}
+			fr = unicode.ToLower(fr)
+			if c, ok := confusables[fr]; ok {
+				fr = c
+			}
+			folded = append(folded, fr)
+			index = append(index, i)
+		}
+	}
+	return folded, index
+}
+
+// Canonical reduces text to its folded words, so names written differently compare equal.
+func Canonical(text string) string {
+	return strings.Join(phrase(Normalize(text)), " ")
+}
+
+// unleet returns folded text with leetspeak replaced, rune for rune,
+// so words are matched however they are spelled.
+func unleet(folded []rune) []rune {
+	res := make([]rune, len(folded))
+	for i, r := range folded {
+		if l, ok := leetspeak[r]; ok {
+			r = l
+		}
+		res[i] = r
+	}
+	return res
+}
+
+// token is a run of letters and digits of folded text, from rune start to end.
+type token struct {
+	text       string
+	start, end int
+}
+
+func tokenize(folded []rune) []token {
+	var tokens []token
+	start := -1
+	for i, r := range folded {
+		word := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			tokens = append(tokens, token{text: string(folded[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{text: string(folded[start:]), start: start, end: len(folded)})
+	}
+	return tokens
+}
+
+// phrase folds a word or phrase into the tokens it matches.
+func phrase(text string) []string {
+	folded, _ := fold([]rune(text))
+	tokens := tokenize(unleet(folded))
+	res := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		res = append(res, t.text)
+	}
+	return res
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
+)
+
+type DonationApprovedHandler struct {
+	hub       *sockets.Hub
+	donations donation.DonationRepo
+	streamers streamer.StreamerRepo
+}
+
+func NewDonationApprovedHandler(hub *sockets.Hub, donations donation.DonationRepo, streamers streamer.StreamerRepo) DonationApprovedHandler {
+	return DonationApprovedHandler{
+		hub:       hub,
+		donations: donations,
+		streamers: streamers,
+	}
+}
+
+func (h DonationApprovedHandler) Handle(event any) error {
+	dae := event.(events.DonationApproved)
+	return showAlert(h.hub, h.donations, h.streamers, dae.DonationID)
+}
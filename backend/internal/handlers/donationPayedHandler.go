@@ -1,27 +1,52 @@
 package handlers
 
 import (
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
 	"github.com/blindlobstar/donation-alarm/backend/internal/events"
 	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
 )
 
 type DonationPayedHandler struct {
-	hub *sockets.Hub
+	hub       *sockets.Hub
+	donations donation.DonationRepo
+	streamers streamer.StreamerRepo
 }
 
-func NewDonationPayedHandler(hub *sockets.Hub) DonationPayedHandler {
+func NewDonationPayedHandler(hub *sockets.Hub, donations donation.DonationRepo, streamers streamer.StreamerRepo) DonationPayedHandler {
 	return DonationPayedHandler{
-		hub: hub,
+		hub:       hub,
+		donations: donations,
+		streamers: streamers,
 	}
 }
 
 func (h DonationPayedHandler) Handle(event any) error {
 	dpe := event.(events.DonationPayed)
-	h.hub.Donate(sockets.DonationEvent{
-		Name:       dpe.Name,
-		Text:       dpe.Message,
-		Amount:     dpe.Amount / 100,
-		StreamerID: dpe.StreamerID,
-	})
+	return showAlert(h.hub, h.donations, h.streamers, dpe.DonationID)
+}
+
+// showAlert sends the alert of the donation to the streamer's overlays.
+func showAlert(hub *sockets.Hub, donations donation.DonationRepo, streamers streamer.StreamerRepo, donationID int) error {
+	// the alert sequence number is assigned by the database when the donation is payed
+	d, err := donations.GetDonation(donationID)
+	if err != nil {
+		return err
+	}
+	// the donation could be refunded before the event was handled
+	if d.Status != donation.DonationStatusPayed {
+		return nil
+	}
+	// a held donation is shown once it's approved
+	if !d.AlertSeq.Valid {
+		return nil
+	}
+
+	locale, err := sockets.StreamerLocale(streamers, d.StreamerID)
+	if err != nil {
+		return err
+	}
+
+	hub.Donate(sockets.NewDonationEvent(d, locale))
 	return nil
 }
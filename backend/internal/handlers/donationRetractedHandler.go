@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
+)
+
+type DonationRetractedHandler struct {
+	hub *sockets.Hub
+}
+
+func NewDonationRetractedHandler(hub *sockets.Hub) DonationRetractedHandler {
+	return DonationRetractedHandler{
+		hub: hub,
+	}
+}
+
+func (h DonationRetractedHandler) Handle(event any) error {
+	dre := event.(events.DonationRetracted)
+	if dre.AlertSeq == 0 {
+		return nil
+	}
+
+	h.hub.Retract(dre.StreamerID, dre.AlertSeq)
+	return nil
+}
@@ -0,0 +1,117 @@
+package moderation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+)
+
+const (
+	defaultInterval  = 15 * time.Second
+	defaultBatchSize = 100
+)
+
+// Moderator reviews the donations streamers hold for review. Approved
+// donations are assigned their alert sequence number and shown on the overlay,
+// the ones past their review deadline are approved automatically.
+type Moderator struct {
+	Donations donation.DonationRepo
+	Interval  time.Duration
+	BatchSize int
+}
+
+// Approve shows the alert of the held donation d with d.Message.
+// It reports false if d isn't held for review.
+func (m Moderator) Approve(d donation.Donation) (bool, error) {
+	return m.approve(d, false)
+}
+
+// Reject keeps the alert of the held donation d off the overlay for good.
+// It reports false if d isn't held for review.
+func (m Moderator) Reject(d donation.Donation) (bool, error) {
+	d.ModerationStatus = donation.ModerationStatusRejected
+	return m.Donations.Review(d)
+}
+
+// Edit replaces the message of the held donation d with d.Message.
+// It reports false if d isn't held for review.
+func (m Moderator) Edit(d donation.Donation) (bool, error) {
+	d.ModerationStatus = donation.ModerationStatusPending
+	return m.Donations.Review(d)
+}
+
+func (m Moderator) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		approved, err := m.AutoApprove(time.Now())
+		if err != nil {
+			log.Printf("error approving overdue donations: %v\n", err)
+		}
+		if approved > 0 {
+			log.Printf("approved overdue donations. Count: %d\n", approved)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AutoApprove approves the held donations whose review deadline is before now
+// and returns how many were approved.
+func (m Moderator) AutoApprove(now time.Time) (int, error) {
+	batchSize := m.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	approved := 0
+	for {
+		// approved donations aren't overdue anymore, so every batch is a new one
+		donations, err := m.Donations.GetOverdueReviews(now, batchSize)
+		if err != nil {
+			return approved, err
+		}
+
+		for _, d := range donations {
+			ok, err := m.approve(d, true)
+			if err != nil {
+				return approved, err
+			}
+			if ok {
+				approved++
+			}
+		}
+
+		if len(donations) < batchSize {
+			return approved, nil
+		}
+	}
+}
+
+func (m Moderator) approve(d donation.Donation, auto bool) (bool, error) {
+	d.ModerationStatus = donation.ModerationStatusApproved
+	message, err := outbox.NewMessage(events.DonationApprovedName, events.DonationApproved{
+		PaymentID:  d.PaymentID,
+		Message:    d.Message,
+		DonationID: d.ID,
+		StreamerID: d.StreamerID,
+		Auto:       auto,
+	})
+	if err != nil {
+		return false, err
+	}
+	return m.Donations.Review(d, message)
+}
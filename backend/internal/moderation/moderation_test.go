@@ -0,0 +1,145 @@
+//go:build unit
+// +build unit
+
+package moderation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/filter"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
+)
+
+func TestModeration(t *testing.T) {
+	donations := donation.NewDonationMock()
+	streamers := &streamer.StreamerMock{}
+	held := streamer.Streamer{TwitchName: "held"}
+	streamers.CreateStreamer(&held)
+	streamers.UpdateModerationSettings(held.ID, true, 60)
+	open := streamer.Streamer{TwitchName: "open"}
+	streamers.CreateStreamer(&open)
+
+	settler := settlement.Settler{
+		Donations: donations,
+		Streamers: streamers,
+		Rates:     money.StaticRates{Base: "USD"},
+	}
+	pay := func(paymentID string, streamerID int, filterAction string) donation.Donation {
+		d := donation.Donation{
+			PaymentID:    paymentID,
+			StreamerID:   streamerID,
+			Amount:       500,
+			NetAmount:    500,
+			Currency:     "USD",
+			Message:      "hello",
+			Status:       donation.DonationStatusCreated,
+			FilterAction: filterAction,
+		}
+		donations.Create(&d)
+		if _, err := settler.Apply(payments.Outcome{PaymentID: paymentID, Status: donation.DonationStatusPayed}); err != nil {
+			t.Fatal(err)
+		}
+		d, _ = donations.GetDonation(d.ID)
+		return d
+	}
+	edited := pay("pay_edited", held.ID, "")
+	rejected := pay("pay_rejected", held.ID, "")
+	overdue := pay("pay_overdue", held.ID, "")
+	shown := pay("pay_shown", open.ID, filter.ActionMask)
+	flagged := pay("pay_flagged", open.ID, filter.ActionModerate)
+	heldFlagged := pay("pay_held_flagged", held.ID, filter.ActionModerate)
+
+	// Test case 1: payed donations of a streamer reviewing them are held without an alert
+	for _, d := range []donation.Donation{edited, rejected, overdue} {
+		if d.ModerationStatus != donation.ModerationStatusPending || d.AlertSeq.Valid || !d.ReviewDeadline.Valid {
+			t.Errorf("expected donation %d to be held with a deadline, got %+v", d.ID, d)
+		}
+	}
+	if shown.ModerationStatus != donation.ModerationStatusNone || !shown.AlertSeq.Valid {
+		t.Errorf("expected donation %d to be shown, got %+v", shown.ID, shown)
+	}
+	// the message filter sends donations to moderation for any streamer
+	// and they wait for the streamer even if donations are approved automatically
+	for _, d := range []donation.Donation{flagged, heldFlagged} {
+		if d.ModerationStatus != donation.ModerationStatusPending || d.AlertSeq.Valid || d.ReviewDeadline.Valid {
+			t.Errorf("expected donation %d to be held without a deadline, got %+v", d.ID, d)
+		}
+	}
+	var payed events.DonationPayed
+	json.Unmarshal(donations.Outbox.Messages[0].Payload, &payed)
+	if !payed.HeldForReview {
+		t.Errorf("expected DonationPayed to be held for review, got %+v", payed)
+	}
+
+	m := Moderator{Donations: donations}
+	messages := len(donations.Outbox.Messages)
+
+	// Test case 2: an edited donation stays held
+	edited.Message = "hi"
+	if ok, err := m.Edit(edited); err != nil || !ok {
+		t.Fatalf("expected the message to be edited, got %v, %v", ok, err)
+	}
+	stored, _ := donations.GetDonation(edited.ID)
+	if stored.Message != "hi" || stored.ModerationStatus != donation.ModerationStatusPending || stored.AlertSeq.Valid {
+		t.Errorf("expected the edited donation to be held, got %+v", stored)
+	}
+
+	// Test case 3: an approved donation is assigned its alert
+	if ok, err := m.Approve(stored); err != nil || !ok {
+		t.Fatalf("expected the donation to be approved, got %v, %v", ok, err)
+	}
+	stored, _ = donations.GetDonation(edited.ID)
+	if stored.ModerationStatus != donation.ModerationStatusApproved || !stored.AlertSeq.Valid {
+		t.Errorf("expected the donation to be approved with an alert, got %+v", stored)
+	}
+	if len(donations.Outbox.Messages) != messages+1 || donations.Outbox.Messages[messages].EventName != events.DonationApprovedName {
+		t.Fatalf("expected a DonationApproved message, got %+v", donations.Outbox.Messages)
+	}
+
+	// Test case 4: a rejected donation is never shown
+	if ok, err := m.Reject(rejected); err != nil || !ok {
+		t.Fatalf("expected the donation to be rejected, got %v, %v", ok, err)
+	}
+	if ok, _ := m.Approve(rejected); ok {
+		t.Errorf("expected a rejected donation not to be approved")
+	}
+	stored, _ = donations.GetDonation(rejected.ID)
+	if stored.ModerationStatus != donation.ModerationStatusRejected || stored.AlertSeq.Valid {
+		t.Errorf("expected the donation to be rejected without an alert, got %+v", stored)
+	}
+
+	// Test case 5: another streamer can't review the donation
+	other := overdue
+	other.StreamerID = open.ID
+	if ok, _ := m.Reject(other); ok {
+		t.Errorf("expected the donation of another streamer not to be rejected")
+	}
+
+	// Test case 6: donations are approved automatically after their deadline
+	if approved, err := m.AutoApprove(time.Now()); err != nil || approved != 0 {
+		t.Fatalf("expected no donations approved before the deadline, got %d, %v", approved, err)
+	}
+	if approved, err := m.AutoApprove(time.Now().Add(2 * time.Minute)); err != nil || approved != 1 {
+		t.Fatalf("expected 1 donation approved after the deadline, got %d, %v", approved, err)
+	}
+	stored, _ = donations.GetDonation(overdue.ID)
+	if stored.ModerationStatus != donation.ModerationStatusApproved || !stored.AlertSeq.Valid {
+		t.Errorf("expected the overdue donation to be approved, got %+v", stored)
+	}
+	stored, _ = donations.GetDonation(heldFlagged.ID)
+	if stored.ModerationStatus != donation.ModerationStatusPending || stored.AlertSeq.Valid {
+		t.Errorf("expected the flagged donation to stay held, got %+v", stored)
+	}
+	var approved events.DonationApproved
+	json.Unmarshal(donations.Outbox.Messages[len(donations.Outbox.Messages)-1].Payload, &approved)
+	if approved.DonationID != overdue.ID || !approved.Auto {
+		t.Errorf("expected DonationApproved of donation %d to be automatic, got %+v", overdue.ID, approved)
+	}
+}
@@ -0,0 +1,47 @@
+package money
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultCurrency is used by streamers who haven't configured currencies.
+const DefaultCurrency = "USD"
+
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// exponents holds the ISO 4217 minor unit of every supported currency,
+// the number of decimal places between the major and the minor unit.
+var exponents = map[string]int{
+	"AED": 2, "ARS": 2, "AUD": 2, "BGN": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2,
+	"CLP": 0, "CNY": 2, "COP": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2,
+	"HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3, "PHP": 2, "PLN": 2,
+	"RON": 2, "SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TND": 3, "TRY": 2, "TWD": 2,
+	"UAH": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+// ParseCurrency returns the ISO 4217 code of currency in upper case.
+func ParseCurrency(currency string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	if _, ok := exponents[code]; !ok {
+		return "", ErrUnknownCurrency
+	}
+	return code, nil
+}
+
+// Exponent returns the minor unit of currency, 2 for unknown currencies.
+func Exponent(currency string) int {
+	if e, ok := exponents[currency]; ok {
+		return e
+	}
+	return 2
+}
+
+func scale(currency string) int64 {
+	s := int64(1)
+	for i := 0; i < Exponent(currency); i++ {
+		s *= 10
+	}
+	return s
+}
@@ -0,0 +1,47 @@
+//go:build unit
+// +build unit
+
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCurrency(t *testing.T) {
+	cases := []struct {
+		currency string
+		code     string
+		err      error
+	}{
+		{"usd", "USD", nil},
+		{" JPY ", "JPY", nil},
+		{"XXX", "", ErrUnknownCurrency},
+		{"", "", ErrUnknownCurrency},
+	}
+
+	for _, tc := range cases {
+		code, err := ParseCurrency(tc.currency)
+		if code != tc.code || !errors.Is(err, tc.err) {
+			t.Errorf("ParseCurrency(%q): expected (%q, %v), got (%q, %v)", tc.currency, tc.code, tc.err, code, err)
+		}
+	}
+}
+
+func TestExponent(t *testing.T) {
+	cases := []struct {
+		currency string
+		exponent int
+	}{
+		{"USD", 2},
+		{"JPY", 0},
+		{"BHD", 3},
+		{"XXX", 2},
+	}
+
+	for _, tc := range cases {
+		if e := Exponent(tc.currency); e != tc.exponent {
+			t.Errorf("Exponent(%s): expected %d, got %d", tc.currency, tc.exponent, e)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// DefaultLocale formats amounts of streamers who haven't chosen a locale.
+const DefaultLocale = "en-US"
+
+// Money is an amount in the minor unit of Currency, e.g. cents for USD.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Decimal returns the amount in the major unit without rounding, e.g. "4.99".
+func (m Money) Decimal() string {
+	exp := Exponent(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+
+	s := scale(m.Currency)
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/s, exp, amount%s)
+}
+
+// Format returns the amount with the currency symbol the way it is written in locale,
+// e.g. "$ 4.99" in en-US or "€ 4,99" in de-DE. Unknown locales fall back to DefaultLocale.
+func (m Money) Format(locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		tag = language.MustParse(DefaultLocale)
+	}
+	unit, err := currency.ParseISO(m.Currency)
+	if err != nil {
+		return m.Decimal() + " " + m.Currency
+	}
+
+	major := float64(m.Amount) / float64(scale(m.Currency))
+	return strings.TrimSpace(message.NewPrinter(tag).Sprint(currency.Symbol(unit.Amount(major))))
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
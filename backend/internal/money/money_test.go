@@ -0,0 +1,44 @@
+//go:build unit
+// +build unit
+
+package money
+
+import "testing"
+
+func TestDecimal(t *testing.T) {
+	cases := []struct {
+		money    Money
+		expected string
+	}{
+		{New(499, "USD"), "4.99"},
+		{New(5, "USD"), "0.05"},
+		{New(500, "JPY"), "500"},
+		{New(1234, "BHD"), "1.234"},
+		{New(-150, "EUR"), "-1.50"},
+	}
+
+	for _, tc := range cases {
+		if d := tc.money.Decimal(); d != tc.expected {
+			t.Errorf("%v: expected %s, got %s", tc.money, tc.expected, d)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		money    Money
+		locale   string
+		expected string
+	}{
+		{New(123499, "USD"), "en-US", "$ 1,234.99"},
+		{New(123499, "EUR"), "de-DE", "€ 1.234,99"},
+		{New(500, "JPY"), "en-US", "¥ 500"},
+		{New(499, "USD"), "not a locale", "$ 4.99"},
+	}
+
+	for _, tc := range cases {
+		if f := tc.money.Format(tc.locale); f != tc.expected {
+			t.Errorf("%v in %s: expected %q, got %q", tc.money, tc.locale, tc.expected, f)
+		}
+	}
+}
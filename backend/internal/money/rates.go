@@ -0,0 +1,82 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+)
+
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rates provides exchange rates between currencies.
+type Rates interface {
+	// Rate returns how many units of to one unit of from is worth.
+	Rate(from string, to string) (float64, error)
+}
+
+// StaticRates are fixed exchange rates against a base currency,
+// used when no live rate source is available.
+type StaticRates struct {
+	Base string `json:"base"`
+	// Rates holds how many units of each currency one unit of Base is worth.
+	Rates map[string]float64 `json:"rates"`
+}
+
+// LoadRates reads static rates from a JSON file.
+func LoadRates(path string) (StaticRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return StaticRates{}, err
+	}
+
+	var rates StaticRates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return StaticRates{}, err
+	}
+	return rates, nil
+}
+
+func (sr StaticRates) Rate(from string, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	fromRate, ok := sr.rate(from)
+	if !ok {
+		return 0, ErrNoRate
+	}
+	toRate, ok := sr.rate(to)
+	if !ok {
+		return 0, ErrNoRate
+	}
+	return toRate / fromRate, nil
+}
+
+func (sr StaticRates) rate(currency string) (float64, bool) {
+	if currency == sr.Base {
+		return 1, true
+	}
+	r, ok := sr.Rates[currency]
+	return r, ok && r > 0
+}
+
+// Convert converts amount in the minor unit of from to the minor unit of to at rate,
+// rounding to the nearest minor unit.
+func Convert(amount int64, from string, to string, rate float64) int64 {
+	major := float64(amount) / float64(scale(from))
+	return int64(math.Round(major * rate * float64(scale(to))))
+}
+
+// Sum adds amounts up in currency, converting them at the current rates.
+func Sum(amounts []Money, currency string, rates Rates) (int64, error) {
+	var total int64
+	for _, a := range amounts {
+		rate, err := rates.Rate(a.Currency, currency)
+		if err != nil {
+			return 0, err
+		}
+		total += Convert(a.Amount, a.Currency, currency, rate)
+	}
+	return total, nil
+}
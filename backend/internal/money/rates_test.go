@@ -0,0 +1,70 @@
+//go:build unit
+// +build unit
+
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStaticRates(t *testing.T) {
+	rates := StaticRates{Base: "USD", Rates: map[string]float64{"EUR": 0.5, "JPY": 100}}
+
+	cases := []struct {
+		from string
+		to   string
+		rate float64
+		err  error
+	}{
+		{"USD", "USD", 1, nil},
+		{"USD", "EUR", 0.5, nil},
+		{"EUR", "USD", 2, nil},
+		{"EUR", "JPY", 200, nil},
+		{"GBP", "USD", 0, ErrNoRate},
+	}
+
+	for _, tc := range cases {
+		rate, err := rates.Rate(tc.from, tc.to)
+		if rate != tc.rate || !errors.Is(err, tc.err) {
+			t.Errorf("Rate(%s, %s): expected (%v, %v), got (%v, %v)", tc.from, tc.to, tc.rate, tc.err, rate, err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		amount   int64
+		from     string
+		to       string
+		rate     float64
+		expected int64
+	}{
+		{500, "USD", "EUR", 0.5, 250},
+		{500, "USD", "JPY", 100, 500},
+		{1000, "JPY", "USD", 0.01, 1000},
+		{333, "USD", "EUR", 0.5, 167},
+	}
+
+	for _, tc := range cases {
+		if converted := Convert(tc.amount, tc.from, tc.to, tc.rate); converted != tc.expected {
+			t.Errorf("Convert(%d %s to %s): expected %d, got %d", tc.amount, tc.from, tc.to, tc.expected, converted)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	rates := StaticRates{Base: "USD", Rates: map[string]float64{"EUR": 0.5}}
+
+	total, err := Sum([]Money{{500, "USD"}, {250, "EUR"}}, "USD", rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1000 {
+		t.Errorf("expected 1000, got %d", total)
+	}
+
+	if _, err := Sum([]Money{{100, "GBP"}}, "USD", rates); !errors.Is(err, ErrNoRate) {
+		t.Errorf("expected ErrNoRate, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package payments
+
+import (
+	"math"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+)
+
+// FeeModel estimates what a provider charges for a payment.
+type FeeModel struct {
+	// Percent is the share of the payed amount taken by the provider.
+	Percent float64 `json:"percent"`
+	// Fixed is the fee per payment by currency, in the minor unit of the currency.
+	Fixed map[string]int64 `json:"fixed"`
+}
+
+// StripeFees is the standard Stripe pricing for card payments.
+var StripeFees = FeeModel{
+	Percent: 2.9,
+	Fixed: map[string]int64{
+		"USD": 30, "CAD": 30, "AUD": 30, "NZD": 30, "SGD": 50,
+		"EUR": 25, "GBP": 20, "CHF": 30, "SEK": 180, "NOK": 200, "DKK": 180, "PLN": 100,
+		"JPY": 0, "KRW": 0,
+	},
+}
+
+// Fee returns the fee for a payment of gross.
+func (fm FeeModel) Fee(gross money.Money) int64 {
+	return int64(math.Round(float64(gross.Amount)*fm.Percent/100)) + fm.Fixed[gross.Currency]
+}
+
+// GrossUp returns the smallest payment that leaves net after the fee.
+func (fm FeeModel) GrossUp(net money.Money) int64 {
+	fixed := fm.Fixed[net.Currency]
+	gross := int64(math.Ceil(float64(net.Amount+fixed) / (1 - fm.Percent/100)))
+	for gross-fm.Fee(money.New(gross, net.Currency)) < net.Amount {
+		gross++
+	}
+	return gross
+}
@@ -0,0 +1,34 @@
+//go:build unit
+// +build unit
+
+package payments
+
+import (
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+)
+
+func TestFeeModel(t *testing.T) {
+	cases := []struct {
+		net   money.Money
+		gross int64
+		fee   int64
+	}{
+		{money.New(1000, "USD"), 1061, 61},
+		{money.New(499, "USD"), 545, 46},
+		{money.New(500, "JPY"), 515, 15},
+		{money.New(1000, "XXX"), 1030, 30},
+	}
+
+	for _, tc := range cases {
+		gross := StripeFees.GrossUp(tc.net)
+		fee := StripeFees.Fee(money.New(gross, tc.net.Currency))
+		if gross != tc.gross || fee != tc.fee {
+			t.Errorf("%v: expected gross %d and fee %d, got %d and %d", tc.net, tc.gross, tc.fee, gross, fee)
+		}
+		if gross-fee < tc.net.Amount {
+			t.Errorf("%v: gross %d leaves less than net after fee %d", tc.net, gross, fee)
+		}
+	}
+}
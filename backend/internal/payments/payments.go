@@ -0,0 +1,164 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown payment provider")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrUnsupported     = errors.New("not supported by the payment provider")
+	ErrPaymentNotFound = errors.New("payment not found")
+	ErrPaymentSettled  = errors.New("payment already settled")
+)
+
+// Provider is a payment service donations are payed with.
+type Provider interface {
+	// Name identifies the provider, it is stored with donations and webhook events.
+	Name() string
+	CreatePayment(p PaymentParams) (Payment, error)
+	// VerifyWebhook checks that the webhook request was sent by the provider
+	// and returns its event. It wraps ErrInvalidWebhook for untrusted requests.
+	VerifyWebhook(payload []byte, header http.Header) (Event, error)
+	// ParseOutcome maps a webhook event onto a donation status. It reports
+	// false for events that don't change a donation.
+	ParseOutcome(e Event) (Outcome, bool, error)
+	// FetchOutcome asks the provider for the payment's current status. It reports
+	// false while the donor hasn't payed yet and returns ErrPaymentNotFound
+	// if the provider doesn't know the payment.
+	FetchOutcome(paymentID string) (Outcome, bool, error)
+	// ResumePayment returns the payment again, so an unpayed payment can be
+	// completed on a reloaded donation page.
+	ResumePayment(paymentID string) (Payment, error)
+	// CancelPayment cancels a payment the donor abandoned. It wraps
+	// ErrPaymentSettled if the payment can't be canceled anymore.
+	CancelPayment(paymentID string) error
+	// Refund refunds the payment in full and returns the refund's ID.
+	// Repeated calls with the same key refund the payment once.
+	Refund(p RefundParams) (string, error)
+	// Fees returns the provider's fee model, used to let donors cover the fees.
+	Fees() FeeModel
+}
+
+type PaymentParams struct {
+	// Amount is in the smallest currency unit.
+	Amount int64
+	// Currency is the ISO 4217 code in upper case.
+	Currency   string
+	StreamerID int
+	// Destination is the streamer's payout account the payment is transferred to,
+	// less ApplicationFee. The payment stays on the platform account if empty.
+	Destination    string
+	ApplicationFee int64
+}
+
+type Payment struct {
+	ID string
+	// ClientSecret lets the donation page complete the payment.
+	ClientSecret string
+}
+
+// Event is a webhook event received from a provider.
+type Event struct {
+	ID      string
+	Type    string
+	Payload []byte
+}
+
+// Outcome is a payment status change reported by a provider.
+type Outcome struct {
+	PaymentID string
+	// Status is the donation status the payment moved to.
+	Status string
+	// Reason explains a failed payment or a dispute.
+	Reason string
+	// Amount is the payed amount, it is checked against the donation when set.
+	Amount int64
+	// Donor identifies who payed, it's set for payed donations.
+	Donor Donor
+}
+
+// Donor is what the provider knows about who payed a donation.
+type Donor struct {
+	CustomerID string
+	// CardFingerprint is the same for every payment with the same card.
+	CardFingerprint string
+}
+
+// Connect is implemented by providers that pay donations out to
+// the streamer's own account.
+type Connect interface {
+	// CreateAccount creates a payout account for the streamer and returns its ID.
+	CreateAccount(streamerID int) (string, error)
+	// OnboardingLink returns the URL the streamer fills in the account's details at.
+	// The streamer is sent to refreshURL if the link expires and to returnURL when done.
+	OnboardingLink(accountID string, refreshURL string, returnURL string) (string, error)
+	// ParseAccount returns the account a webhook event updates. It reports
+	// false for events that don't update an account.
+	ParseAccount(e Event) (Account, bool, error)
+}
+
+// Account is a streamer's payout account.
+type Account struct {
+	ID string
+	// DetailsSubmitted is set once the streamer has finished onboarding.
+	DetailsSubmitted bool
+	// Enabled is set while the account can receive payments and payouts.
+	Enabled bool
+}
+
+// Subscriptions is implemented by providers that bill monthly donations.
+type Subscriptions interface {
+	// CreateSubscription starts a monthly subscription. It stays incomplete until
+	// the supporter pays the first invoice with the returned ClientSecret.
+	// It returns ErrUnsupported if subscriptions are not configured.
+	CreateSubscription(p SubscriptionParams) (Payment, error)
+	// ParseSubscription maps a webhook event onto a subscription. It reports
+	// false for events that don't change a subscription.
+	ParseSubscription(e Event) (SubscriptionOutcome, bool, error)
+	// CancelSubscription stops the subscription at once, its supporter isn't charged again.
+	CancelSubscription(subscriptionID string) error
+}
+
+type SubscriptionParams struct {
+	// PaymentParams are charged every month.
+	PaymentParams
+	// Name is the supporter's name.
+	Name string
+}
+
+// SubscriptionOutcome is a subscription change reported by a provider.
+type SubscriptionOutcome struct {
+	SubscriptionID string
+	// Status is the subscription status the subscription moved to.
+	Status string
+	// PaymentID and Amount are set when a monthly payment is payed.
+	PaymentID string
+	Amount    int64
+}
+
+type RefundParams struct {
+	PaymentID      string
+	DonationID     int
+	IdempotencyKey string
+}
+
+// Providers looks providers up by name.
+type Providers map[string]Provider
+
+func NewProviders(providers ...Provider) Providers {
+	res := Providers{}
+	for _, p := range providers {
+		res[p.Name()] = p
+	}
+	return res
+}
+
+func (ps Providers) Get(name string) (Provider, error) {
+	p, ok := ps[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
@@ -0,0 +1,96 @@
+package payments
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ProviderMock is a provider whose payments are looked up in Outcomes.
+type ProviderMock struct {
+	// Outcomes are returned by FetchOutcome by payment ID, a payment with an
+	// empty status isn't payed yet. Unknown payments are not found.
+	Outcomes map[string]Outcome
+	// Errors are returned by FetchOutcome and CancelPayment by payment ID.
+	Errors   map[string]error
+	Refunds  []RefundParams
+	Canceled []string
+	// CanceledSubscriptions are the IDs of the canceled subscriptions.
+	CanceledSubscriptions []string
+}
+
+func (pm *ProviderMock) Name() string {
+	return "mock"
+}
+
+func (pm *ProviderMock) CreatePayment(p PaymentParams) (Payment, error) {
+	id := fmt.Sprintf("mock_%d", len(pm.Outcomes)+1)
+	if pm.Outcomes == nil {
+		pm.Outcomes = map[string]Outcome{}
+	}
+	pm.Outcomes[id] = Outcome{PaymentID: id, Amount: p.Amount}
+	return Payment{ID: id, ClientSecret: id + "_secret"}, nil
+}
+
+func (pm *ProviderMock) VerifyWebhook(payload []byte, header http.Header) (Event, error) {
+	return Event{}, ErrUnsupported
+}
+
+func (pm *ProviderMock) ParseOutcome(e Event) (Outcome, bool, error) {
+	return Outcome{}, false, nil
+}
+
+func (pm *ProviderMock) FetchOutcome(paymentID string) (Outcome, bool, error) {
+	if err := pm.Errors[paymentID]; err != nil {
+		return Outcome{}, false, err
+	}
+	o, ok := pm.Outcomes[paymentID]
+	if !ok {
+		return Outcome{}, false, fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+	}
+	return o, o.Status != "", nil
+}
+
+func (pm *ProviderMock) ResumePayment(paymentID string) (Payment, error) {
+	if _, ok := pm.Outcomes[paymentID]; !ok {
+		return Payment{}, fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+	}
+	return Payment{ID: paymentID, ClientSecret: paymentID + "_secret"}, nil
+}
+
+// CancelPayment cancels payments that aren't payed yet.
+func (pm *ProviderMock) CancelPayment(paymentID string) error {
+	if err := pm.Errors[paymentID]; err != nil {
+		return err
+	}
+	o, ok := pm.Outcomes[paymentID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+	}
+	if o.Status != "" {
+		return fmt.Errorf("%w: %s", ErrPaymentSettled, paymentID)
+	}
+	pm.Canceled = append(pm.Canceled, paymentID)
+	return nil
+}
+
+func (pm *ProviderMock) Refund(p RefundParams) (string, error) {
+	pm.Refunds = append(pm.Refunds, p)
+	return fmt.Sprintf("mock_refund_%d", len(pm.Refunds)), nil
+}
+
+func (pm *ProviderMock) CreateSubscription(p SubscriptionParams) (Payment, error) {
+	return Payment{}, ErrUnsupported
+}
+
+func (pm *ProviderMock) ParseSubscription(e Event) (SubscriptionOutcome, bool, error) {
+	return SubscriptionOutcome{}, false, nil
+}
+
+func (pm *ProviderMock) CancelSubscription(subscriptionID string) error {
+	pm.CanceledSubscriptions = append(pm.CanceledSubscriptions, subscriptionID)
+	return nil
+}
+
+func (pm *ProviderMock) Fees() FeeModel {
+	return FeeModel{}
+}
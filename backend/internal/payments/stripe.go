@@ -0,0 +1,367 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/stripe/stripe-go/v75"
+	"github.com/stripe/stripe-go/v75/account"
+	"github.com/stripe/stripe-go/v75/accountlink"
+	"github.com/stripe/stripe-go/v75/customer"
+	"github.com/stripe/stripe-go/v75/paymentintent"
+	"github.com/stripe/stripe-go/v75/paymentmethod"
+	"github.com/stripe/stripe-go/v75/refund"
+	"github.com/stripe/stripe-go/v75/subscription"
+	"github.com/stripe/stripe-go/v75/webhook"
+)
+
+const ProviderStripe = "stripe"
+
+type StripeConfig struct {
+	Key           string
+	WebhookSecret string
+	// ConnectWebhookSecret signs the events of the streamers' connected accounts,
+	// they are sent to a separate webhook endpoint in the dashboard.
+	ConnectWebhookSecret string
+	Fees                 FeeModel
+	// SubscriptionProduct is the product monthly donations are billed for.
+	// Subscriptions are disabled if it is empty.
+	SubscriptionProduct string
+}
+
+type Stripe struct {
+	webhookSecrets []string
+	fees           FeeModel
+	paymentIntents paymentintent.Client
+	paymentMethods paymentmethod.Client
+	refunds        refund.Client
+	accounts       account.Client
+	accountLinks   accountlink.Client
+	customers      customer.Client
+	subscriptions  subscription.Client
+	// subscriptionProduct is the product monthly donations are billed for.
+	subscriptionProduct string
+}
+
+func NewStripe(c StripeConfig) Stripe {
+	backend := stripe.GetBackend(stripe.APIBackend)
+	secrets := []string{c.WebhookSecret}
+	if c.ConnectWebhookSecret != "" {
+		secrets = append(secrets, c.ConnectWebhookSecret)
+	}
+	return Stripe{
+		webhookSecrets:      secrets,
+		fees:                c.Fees,
+		paymentIntents:      paymentintent.Client{B: backend, Key: c.Key},
+		paymentMethods:      paymentmethod.Client{B: backend, Key: c.Key},
+		refunds:             refund.Client{B: backend, Key: c.Key},
+		accounts:            account.Client{B: backend, Key: c.Key},
+		accountLinks:        accountlink.Client{B: backend, Key: c.Key},
+		customers:           customer.Client{B: backend, Key: c.Key},
+		subscriptions:       subscription.Client{B: backend, Key: c.Key},
+		subscriptionProduct: c.SubscriptionProduct,
+	}
+}
+
+func (s Stripe) Name() string {
+	return ProviderStripe
+}
+
+func (s Stripe) Fees() FeeModel {
+	return s.fees
+}
+
+func (s Stripe) CreatePayment(p PaymentParams) (Payment, error) {
+	amount, err := toStripeAmount(p.Currency, p.Amount)
+	if err != nil {
+		return Payment{}, err
+	}
+	params := &stripe.PaymentIntentParams{
+		Amount:   stripe.Int64(amount),
+		Currency: stripe.String(strings.ToLower(p.Currency)),
+		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
+			Enabled: stripe.Bool(true),
+		},
+	}
+	params.AddMetadata("streamer_id", strconv.Itoa(p.StreamerID))
+	// a destination charge, Stripe's fee is taken from the platform's application fee
+	if p.Destination != "" {
+		params.TransferData = &stripe.PaymentIntentTransferDataParams{
+			Destination: stripe.String(p.Destination),
+		}
+		params.ApplicationFeeAmount = stripe.Int64(toStripeFee(p.Currency, p.ApplicationFee))
+	}
+	pi, err := s.paymentIntents.New(params)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	return Payment{ID: pi.ID, ClientSecret: pi.ClientSecret}, nil
+}
+
+func (s Stripe) VerifyWebhook(payload []byte, header http.Header) (Event, error) {
+	var (
+		event stripe.Event
+		err   error
+	)
+	for _, secret := range s.webhookSecrets {
+		// the webhook endpoint's API version is configured in the dashboard,
+		// only the fields used by ParseOutcome and ParseAccount are read
+		event, err = webhook.ConstructEventWithOptions(payload, header.Get("Stripe-Signature"), secret, webhook.ConstructEventOptions{
+			IgnoreAPIVersionMismatch: true,
+		})
+		if err == nil {
+			return Event{ID: event.ID, Type: string(event.Type), Payload: payload}, nil
+		}
+	}
+	return Event{}, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+}
+
+// paymentIntentStatuses maps PaymentIntent webhook types onto donation statuses.
+var paymentIntentStatuses = map[string]string{
+	"payment_intent.succeeded":      donation.DonationStatusPayed,
+	"payment_intent.processing":     donation.DonationStatusProcessing,
+	"payment_intent.payment_failed": donation.DonationStatusFailed,
+	"payment_intent.canceled":       donation.DonationStatusCanceled,
+}
+
+func (s Stripe) ParseOutcome(e Event) (Outcome, bool, error) {
+	var event stripe.Event
+	if err := json.Unmarshal(e.Payload, &event); err != nil {
+		return Outcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+	}
+
+	// Unmarshal the event data into an appropriate struct depending on its Type
+	switch e.Type {
+	case "payment_intent.succeeded", "payment_intent.processing", "payment_intent.payment_failed", "payment_intent.canceled":
+		var paymentIntent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &paymentIntent); err != nil {
+			return Outcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+		}
+		var donor Donor
+		if e.Type == "payment_intent.succeeded" {
+			log.Printf("successful payment for %d.", paymentIntent.Amount)
+			var err error
+			if donor, err = s.donor(paymentIntent); err != nil {
+				return Outcome{}, false, err
+			}
+		}
+		status := paymentIntentStatuses[e.Type]
+		if paymentIntent.CancellationReason == stripe.PaymentIntentCancellationReasonAbandoned {
+			// canceled by the sweeper
+			status = donation.DonationStatusExpired
+		}
+		return Outcome{
+			PaymentID: paymentIntent.ID,
+			Status:    status,
+			Reason:    failureReason(paymentIntent),
+			Amount:    fromStripeAmount(string(paymentIntent.Currency), paymentIntent.Amount),
+			Donor:     donor,
+		}, true, nil
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return Outcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+		}
+		// partial refunds keep the donation
+		if !charge.Refunded || charge.PaymentIntent == nil {
+			log.Printf("partial refund of %d. ChargeID: %s\n", charge.AmountRefunded, charge.ID)
+			return Outcome{}, false, nil
+		}
+		return Outcome{PaymentID: charge.PaymentIntent.ID, Status: donation.DonationStatusRefunded}, true, nil
+	case "charge.dispute.created", "charge.dispute.closed":
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return Outcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+		}
+		status, ok := disputeStatus(e.Type, dispute.Status)
+		if !ok || dispute.PaymentIntent == nil {
+			log.Printf("ignoring %s. DisputeID: %s, Status: %s\n", e.Type, dispute.ID, dispute.Status)
+			return Outcome{}, false, nil
+		}
+		return Outcome{PaymentID: dispute.PaymentIntent.ID, Status: status, Reason: string(dispute.Reason)}, true, nil
+	default:
+		log.Printf("Unhandled event type: %s\n", e.Type)
+		return Outcome{}, false, nil
+	}
+}
+
+func (s Stripe) FetchOutcome(paymentID string) (Outcome, bool, error) {
+	pi, err := s.paymentIntents.Get(paymentID, nil)
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+		return Outcome{}, false, fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+	}
+	if err != nil {
+		return Outcome{}, false, err
+	}
+
+	var status string
+	var donor Donor
+	switch pi.Status {
+	case stripe.PaymentIntentStatusSucceeded:
+		status = donation.DonationStatusPayed
+		if donor, err = s.donor(*pi); err != nil {
+			return Outcome{}, false, err
+		}
+	case stripe.PaymentIntentStatusProcessing:
+		status = donation.DonationStatusProcessing
+	case stripe.PaymentIntentStatusCanceled:
+		status = donation.DonationStatusCanceled
+		if pi.CancellationReason == stripe.PaymentIntentCancellationReasonAbandoned {
+			status = donation.DonationStatusExpired
+		}
+	case stripe.PaymentIntentStatusRequiresPaymentMethod:
+		// the intent goes back to requires_payment_method when a payment fails
+		if pi.LastPaymentError == nil {
+			return Outcome{}, false, nil
+		}
+		status = donation.DonationStatusFailed
+	default:
+		return Outcome{}, false, nil
+	}
+	return Outcome{
+		PaymentID: pi.ID,
+		Status:    status,
+		Reason:    failureReason(*pi),
+		Amount:    fromStripeAmount(string(pi.Currency), pi.Amount),
+		Donor:     donor,
+	}, true, nil
+}
+
+func (s Stripe) ResumePayment(paymentID string) (Payment, error) {
+	pi, err := s.paymentIntents.Get(paymentID, nil)
+	if err != nil {
+		return Payment{}, err
+	}
+	return Payment{ID: pi.ID, ClientSecret: pi.ClientSecret}, nil
+}
+
+func (s Stripe) CancelPayment(paymentID string) error {
+	params := &stripe.PaymentIntentCancelParams{
+		CancellationReason: stripe.String(string(stripe.PaymentIntentCancellationReasonAbandoned)),
+	}
+	_, err := s.paymentIntents.Cancel(paymentID, params)
+	var stripeErr *stripe.Error
+	// only intents waiting for the donor can be canceled
+	if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodePaymentIntentUnexpectedState {
+		return fmt.Errorf("%w: %s", ErrPaymentSettled, paymentID)
+	}
+	if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+		return fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+	}
+	return err
+}
+
+func (s Stripe) Refund(p RefundParams) (string, error) {
+	pi, err := s.paymentIntents.Get(p.PaymentID, nil)
+	if err != nil {
+		return "", err
+	}
+	re, err := s.refunds.New(refundParams(p, *pi))
+	if err != nil {
+		return "", err
+	}
+	return re.ID, nil
+}
+
+// refundParams refunds the intent pi. The transfer of a destination charge is
+// reversed with it, so the refund isn't payed from the platform's balance.
+func refundParams(p RefundParams, pi stripe.PaymentIntent) *stripe.RefundParams {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(p.PaymentID),
+		Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+	}
+	if pi.TransferData != nil {
+		params.ReverseTransfer = stripe.Bool(true)
+		params.RefundApplicationFee = stripe.Bool(true)
+	}
+	params.AddMetadata("donation_id", strconv.Itoa(p.DonationID))
+	params.SetIdempotencyKey(p.IdempotencyKey)
+	return params
+}
+
+// donor identifies who payed the intent. Webhooks only carry the payment
+// method's ID, so its card is looked up when it isn't expanded.
+func (s Stripe) donor(pi stripe.PaymentIntent) (Donor, error) {
+	var d Donor
+	if pi.Customer != nil {
+		d.CustomerID = pi.Customer.ID
+	}
+	pm := pi.PaymentMethod
+	if pm != nil && pm.Card == nil && pm.ID != "" {
+		var err error
+		if pm, err = s.paymentMethods.Get(pm.ID, nil); err != nil {
+			return Donor{}, err
+		}
+	}
+	if pm != nil && pm.Card != nil {
+		d.CardFingerprint = pm.Card.Fingerprint
+	}
+	return d, nil
+}
+
+// Stripe takes amounts in the ISO 4217 minor unit with two exceptions:
+// ISK is sent with two decimals and amounts of three-decimal currencies
+// must be multiples of 10. Amounts are converted when they cross the provider.
+func toStripeAmount(currency string, amount int64) (int64, error) {
+	if strings.EqualFold(currency, "ISK") {
+		return amount * 100, nil
+	}
+	if money.Exponent(strings.ToUpper(currency)) == 3 && amount%10 != 0 {
+		return 0, fmt.Errorf("%w: %s amounts must be multiples of 10, got %d", ErrUnsupported, currency, amount)
+	}
+	return amount, nil
+}
+
+// toStripeFee converts an application fee, rounding the fee of a
+// three-decimal currency down in the streamer's favor.
+func toStripeFee(currency string, fee int64) int64 {
+	if strings.EqualFold(currency, "ISK") {
+		return fee * 100
+	}
+	if money.Exponent(strings.ToUpper(currency)) == 3 {
+		return fee - fee%10
+	}
+	return fee
+}
+
+func fromStripeAmount(currency string, amount int64) int64 {
+	if strings.EqualFold(currency, "ISK") {
+		return amount / 100
+	}
+	return amount
+}
+
+// disputeStatus maps a dispute event onto the donation status.
+func disputeStatus(eventType string, status stripe.DisputeStatus) (string, bool) {
+	if eventType == "charge.dispute.created" {
+		return donation.DonationStatusDisputed, true
+	}
+
+	switch status {
+	case stripe.DisputeStatusWon:
+		return donation.DonationStatusPayed, true
+	case stripe.DisputeStatusLost:
+		return donation.DonationStatusDisputeLost, true
+	// sent by older API versions when an inquiry is closed with a refund
+	case "charge_refunded":
+		return donation.DonationStatusRefunded, true
+	default:
+		return "", false
+	}
+}
+
+func failureReason(paymentIntent stripe.PaymentIntent) string {
+	if paymentIntent.LastPaymentError != nil {
+		return paymentIntent.LastPaymentError.Msg
+	}
+	return string(paymentIntent.CancellationReason)
+}
@@ -0,0 +1,60 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/stripe/stripe-go/v75"
+)
+
+// CreateAccount creates an Express account, Stripe hosts its onboarding and dashboard.
+func (s Stripe) CreateAccount(streamerID int) (string, error) {
+	params := &stripe.AccountParams{
+		Type: stripe.String(string(stripe.AccountTypeExpress)),
+		Capabilities: &stripe.AccountCapabilitiesParams{
+			CardPayments: &stripe.AccountCapabilitiesCardPaymentsParams{Requested: stripe.Bool(true)},
+			Transfers:    &stripe.AccountCapabilitiesTransfersParams{Requested: stripe.Bool(true)},
+		},
+	}
+	params.AddMetadata("streamer_id", strconv.Itoa(streamerID))
+	params.SetIdempotencyKey("streamer-account-" + strconv.Itoa(streamerID))
+	acc, err := s.accounts.New(params)
+	if err != nil {
+		return "", err
+	}
+	return acc.ID, nil
+}
+
+func (s Stripe) OnboardingLink(accountID string, refreshURL string, returnURL string) (string, error) {
+	link, err := s.accountLinks.New(&stripe.AccountLinkParams{
+		Account:    stripe.String(accountID),
+		RefreshURL: stripe.String(refreshURL),
+		ReturnURL:  stripe.String(returnURL),
+		Type:       stripe.String(string(stripe.AccountLinkTypeAccountOnboarding)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return link.URL, nil
+}
+
+func (s Stripe) ParseAccount(e Event) (Account, bool, error) {
+	if e.Type != "account.updated" {
+		return Account{}, false, nil
+	}
+
+	var event stripe.Event
+	if err := json.Unmarshal(e.Payload, &event); err != nil {
+		return Account{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+	}
+	var acc stripe.Account
+	if err := json.Unmarshal(event.Data.Raw, &acc); err != nil {
+		return Account{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+	}
+	return Account{
+		ID:               acc.ID,
+		DetailsSubmitted: acc.DetailsSubmitted,
+		Enabled:          acc.ChargesEnabled && acc.PayoutsEnabled,
+	}, true, nil
+}
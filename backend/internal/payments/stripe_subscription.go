@@ -0,0 +1,132 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/stripe/stripe-go/v75"
+)
+
+func (s Stripe) CreateSubscription(p SubscriptionParams) (Payment, error) {
+	if s.subscriptionProduct == "" {
+		return Payment{}, ErrUnsupported
+	}
+
+	amount, err := toStripeAmount(p.Currency, p.Amount)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	customerParams := &stripe.CustomerParams{}
+	if p.Name != "" {
+		customerParams.Name = stripe.String(p.Name)
+	}
+	customerParams.AddMetadata("streamer_id", strconv.Itoa(p.StreamerID))
+	c, err := s.customers.New(customerParams)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	params := &stripe.SubscriptionParams{
+		Customer: stripe.String(c.ID),
+		Items: []*stripe.SubscriptionItemsParams{{
+			PriceData: &stripe.SubscriptionItemPriceDataParams{
+				Currency:   stripe.String(strings.ToLower(p.Currency)),
+				Product:    stripe.String(s.subscriptionProduct),
+				UnitAmount: stripe.Int64(amount),
+				Recurring: &stripe.SubscriptionItemPriceDataRecurringParams{
+					Interval: stripe.String(string(stripe.PriceRecurringIntervalMonth)),
+				},
+			},
+		}},
+		// the first invoice is payed on the donation page like a one-off donation
+		PaymentBehavior: stripe.String("default_incomplete"),
+		PaymentSettings: &stripe.SubscriptionPaymentSettingsParams{
+			SaveDefaultPaymentMethod: stripe.String("on_subscription"),
+		},
+	}
+	params.AddMetadata("streamer_id", strconv.Itoa(p.StreamerID))
+	params.AddExpand("latest_invoice.payment_intent")
+	if p.Destination != "" {
+		params.TransferData = &stripe.SubscriptionTransferDataParams{
+			Destination: stripe.String(p.Destination),
+		}
+		// subscriptions take the application fee as a percent with two decimals
+		percent := math.Ceil(float64(p.ApplicationFee)*10000/float64(p.Amount)) / 100
+		params.ApplicationFeePercent = stripe.Float64(percent)
+	}
+	sub, err := s.subscriptions.New(params)
+	if err != nil {
+		return Payment{}, err
+	}
+	if sub.LatestInvoice == nil || sub.LatestInvoice.PaymentIntent == nil {
+		return Payment{}, fmt.Errorf("subscription without a payment. SubscriptionID: %s", sub.ID)
+	}
+
+	return Payment{ID: sub.ID, ClientSecret: sub.LatestInvoice.PaymentIntent.ClientSecret}, nil
+}
+
+func (s Stripe) CancelSubscription(subscriptionID string) error {
+	_, err := s.subscriptions.Cancel(subscriptionID, nil)
+	return err
+}
+
+// subscriptionStatuses maps Stripe subscription statuses onto ours.
+var subscriptionStatuses = map[stripe.SubscriptionStatus]string{
+	stripe.SubscriptionStatusIncomplete:        subscription.StatusIncomplete,
+	stripe.SubscriptionStatusActive:            subscription.StatusActive,
+	stripe.SubscriptionStatusTrialing:          subscription.StatusActive,
+	stripe.SubscriptionStatusPastDue:           subscription.StatusPastDue,
+	stripe.SubscriptionStatusUnpaid:            subscription.StatusPastDue,
+	stripe.SubscriptionStatusCanceled:          subscription.StatusCanceled,
+	stripe.SubscriptionStatusIncompleteExpired: subscription.StatusCanceled,
+}
+
+func (s Stripe) ParseSubscription(e Event) (SubscriptionOutcome, bool, error) {
+	switch e.Type {
+	case "invoice.paid":
+		var event stripe.Event
+		if err := json.Unmarshal(e.Payload, &event); err != nil {
+			return SubscriptionOutcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+		}
+		var invoice stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+			return SubscriptionOutcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+		}
+		if invoice.Subscription == nil {
+			return SubscriptionOutcome{}, false, nil
+		}
+		outcome := SubscriptionOutcome{
+			SubscriptionID: invoice.Subscription.ID,
+			Status:         subscription.StatusActive,
+			Amount:         fromStripeAmount(string(invoice.Currency), invoice.AmountPaid),
+		}
+		// invoices of nothing, e.g. after a discount, are payed without a payment
+		if invoice.PaymentIntent != nil {
+			outcome.PaymentID = invoice.PaymentIntent.ID
+		}
+		return outcome, true, nil
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var event stripe.Event
+		if err := json.Unmarshal(e.Payload, &event); err != nil {
+			return SubscriptionOutcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+		}
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return SubscriptionOutcome{}, false, fmt.Errorf("error parsing webhook JSON: %w", err)
+		}
+		status, ok := subscriptionStatuses[sub.Status]
+		if !ok {
+			log.Printf("ignoring %s. SubscriptionID: %s, Status: %s\n", e.Type, sub.ID, sub.Status)
+			return SubscriptionOutcome{}, false, nil
+		}
+		return SubscriptionOutcome{SubscriptionID: sub.ID, Status: status}, true, nil
+	default:
+		return SubscriptionOutcome{}, false, nil
+	}
+}
@@ -0,0 +1,275 @@
+//go:build unit
+// +build unit
+
+package payments
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/stripe/stripe-go/v75"
+	"github.com/stripe/stripe-go/v75/paymentintent"
+	"github.com/stripe/stripe-go/v75/subscription"
+	"github.com/stripe/stripe-go/v75/webhook"
+)
+
+// loadEvent reads an event recorded from a Stripe webhook in testdata.
+func loadEvent(t *testing.T, name string) Event {
+	t.Helper()
+	payload, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	return Event{ID: event.ID, Type: string(event.Type), Payload: payload}
+}
+
+func TestStripeParseOutcome(t *testing.T) {
+	s := NewStripe(StripeConfig{})
+	cases := []struct {
+		file     string
+		expected Outcome
+		ok       bool
+	}{
+		{"payment_intent.succeeded.json", Outcome{
+			PaymentID: "pi_3NqSucceeded",
+			Status:    donation.DonationStatusPayed,
+			Amount:    545,
+			Donor:     Donor{CustomerID: "cus_OeDonor", CardFingerprint: "Xt5EWLLDS7FJjR1c"},
+		}, true},
+		{"payment_intent.processing.json", Outcome{PaymentID: "pi_3NqProcessing", Status: donation.DonationStatusProcessing, Amount: 1000}, true},
+		{"payment_intent.payment_failed.json", Outcome{
+			PaymentID: "pi_3NqFailed",
+			Status:    donation.DonationStatusFailed,
+			Reason:    "Your card has insufficient funds.",
+			Amount:    500,
+		}, true},
+		// canceled by the sweeper
+		{"payment_intent.canceled.json", Outcome{
+			PaymentID: "pi_3NqCanceled",
+			Status:    donation.DonationStatusExpired,
+			Reason:    "abandoned",
+			Amount:    500,
+		}, true},
+		{"charge.refunded.json", Outcome{PaymentID: "pi_3NqSucceeded", Status: donation.DonationStatusRefunded}, true},
+		{"charge.refunded.partial.json", Outcome{}, false},
+		{"charge.dispute.created.json", Outcome{PaymentID: "pi_3NqSucceeded", Status: donation.DonationStatusDisputed, Reason: "fraudulent"}, true},
+		{"charge.dispute.closed.json", Outcome{PaymentID: "pi_3NqSucceeded", Status: donation.DonationStatusPayed, Reason: "fraudulent"}, true},
+		{"customer.created.json", Outcome{}, false},
+	}
+
+	for _, tc := range cases {
+		o, ok, err := s.ParseOutcome(loadEvent(t, tc.file))
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tc.file, err)
+			continue
+		}
+		if ok != tc.ok || o != tc.expected {
+			t.Errorf("%s: expected %+v %v, got %+v %v", tc.file, tc.expected, tc.ok, o, ok)
+		}
+	}
+
+	// Test case: a malformed payload is an error
+	if _, _, err := s.ParseOutcome(Event{Type: "payment_intent.succeeded", Payload: []byte("{")}); err == nil {
+		t.Errorf("expected error for malformed payload, got nil")
+	}
+}
+
+func TestDisputeStatus(t *testing.T) {
+	cases := []struct {
+		eventType string
+		status    stripe.DisputeStatus
+		expected  string
+		ok        bool
+	}{
+		{"charge.dispute.created", stripe.DisputeStatusNeedsResponse, donation.DonationStatusDisputed, true},
+		{"charge.dispute.created", stripe.DisputeStatusWarningNeedsResponse, donation.DonationStatusDisputed, true},
+		{"charge.dispute.closed", stripe.DisputeStatusWon, donation.DonationStatusPayed, true},
+		{"charge.dispute.closed", stripe.DisputeStatusLost, donation.DonationStatusDisputeLost, true},
+		{"charge.dispute.closed", "charge_refunded", donation.DonationStatusRefunded, true},
+		{"charge.dispute.closed", stripe.DisputeStatusWarningClosed, "", false},
+	}
+
+	for _, tc := range cases {
+		status, ok := disputeStatus(tc.eventType, tc.status)
+		if status != tc.expected || ok != tc.ok {
+			t.Errorf("disputeStatus(%s, %s): expected %q %v, got %q %v", tc.eventType, tc.status, tc.expected, tc.ok, status, ok)
+		}
+	}
+}
+
+func TestRefundParams(t *testing.T) {
+	p := RefundParams{PaymentID: "pi_1", DonationID: 1, IdempotencyKey: "donation-refund-1"}
+
+	// Test case 1: a payment kept by the platform is refunded from its balance
+	params := refundParams(p, stripe.PaymentIntent{ID: "pi_1"})
+	if params.ReverseTransfer != nil || params.RefundApplicationFee != nil {
+		t.Errorf("expected a plain refund, got %+v", params)
+	}
+
+	// Test case 2: a destination charge takes the transfer and the application fee back
+	pi := stripe.PaymentIntent{ID: "pi_1", TransferData: &stripe.PaymentIntentTransferData{Destination: &stripe.Account{ID: "acct_1"}}}
+	params = refundParams(p, pi)
+	if params.ReverseTransfer == nil || !*params.ReverseTransfer || params.RefundApplicationFee == nil || !*params.RefundApplicationFee {
+		t.Errorf("expected the transfer and fee to be reversed, got %+v", params)
+	}
+	if *params.PaymentIntent != "pi_1" || *params.IdempotencyKey != "donation-refund-1" {
+		t.Errorf("expected the refund of pi_1, got %+v", params)
+	}
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	s := NewStripe(StripeConfig{WebhookSecret: "whsec_test", ConnectWebhookSecret: "whsec_connect"})
+	payload := loadEvent(t, "payment_intent.succeeded.json").Payload
+	sign := func(secret string, at time.Time) http.Header {
+		signature := hex.EncodeToString(webhook.ComputeSignature(at, payload, secret))
+		header := http.Header{}
+		header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", at.Unix(), signature))
+		return header
+	}
+
+	cases := []struct {
+		name   string
+		header http.Header
+		err    error
+	}{
+		{"platform secret", sign("whsec_test", time.Now()), nil},
+		{"connect secret", sign("whsec_connect", time.Now()), nil},
+		{"unknown secret", sign("whsec_other", time.Now()), ErrInvalidWebhook},
+		{"expired signature", sign("whsec_test", time.Now().Add(-time.Hour)), ErrInvalidWebhook},
+		{"missing signature", http.Header{}, ErrInvalidWebhook},
+	}
+
+	for _, tc := range cases {
+		e, err := s.VerifyWebhook(payload, tc.header)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.err, err)
+			continue
+		}
+		if tc.err == nil && (e.ID != "evt_3NqSucceeded" || e.Type != "payment_intent.succeeded") {
+			t.Errorf("%s: expected the succeeded event, got %+v", tc.name, e)
+		}
+	}
+}
+
+func TestStripeCancelSubscription(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.URL.Path != "/v1/subscriptions/sub_1" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"type":"invalid_request_error","code":"resource_missing"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"sub_1","object":"subscription","status":"canceled"}`)
+	}))
+	defer server.Close()
+
+	s := NewStripe(StripeConfig{Key: "sk_test"})
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(server.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+		LeveledLogger:     &stripe.LeveledLogger{Level: stripe.LevelNull},
+	})
+	s.subscriptions = subscription.Client{B: backend, Key: "sk_test"}
+
+	// Test case 1: the subscription is canceled at once
+	if err := s.CancelSubscription("sub_1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0] != "DELETE /v1/subscriptions/sub_1" {
+		t.Errorf("expected the subscription to be deleted, got %v", requests)
+	}
+
+	// Test case 2: errors of Stripe are returned
+	if err := s.CancelSubscription("sub_2"); err == nil {
+		t.Error("expected an error for an unknown subscription")
+	}
+}
+
+func TestStripeAmount(t *testing.T) {
+	cases := []struct {
+		name     string
+		currency string
+		amount   int64
+		expected int64
+		fee      int64
+		err      error
+	}{
+		{"two-decimal currencies are sent as is", "USD", 1234, 1234, 1234, nil},
+		{"zero-decimal currencies are sent as is", "JPY", 500, 500, 500, nil},
+		{"ISK is sent with two decimals", "ISK", 500, 50000, 50000, nil},
+		{"three-decimal multiples of 10 are sent as is", "BHD", 1230, 1230, 1230, nil},
+		{"other three-decimal amounts are refused", "KWD", 1234, 0, 1230, ErrUnsupported},
+		{"lower case codes are converted", "isk", 5, 500, 500, nil},
+	}
+	for _, tc := range cases {
+		amount, err := toStripeAmount(tc.currency, tc.amount)
+		if !errors.Is(err, tc.err) || amount != tc.expected {
+			t.Errorf("%s: expected %d and %v, got %d and %v", tc.name, tc.expected, tc.err, amount, err)
+		}
+		if fee := toStripeFee(tc.currency, tc.amount); fee != tc.fee {
+			t.Errorf("%s: expected a fee of %d, got %d", tc.name, tc.fee, fee)
+		}
+		// Stripe's amounts are converted back
+		if err == nil && fromStripeAmount(strings.ToLower(tc.currency), amount) != tc.amount {
+			t.Errorf("%s: expected %d back, got %d", tc.name, tc.amount, fromStripeAmount(tc.currency, amount))
+		}
+	}
+}
+
+func TestStripeCreatePayment(t *testing.T) {
+	var amounts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		amounts = append(amounts, r.Form.Get("amount")+" "+r.Form.Get("application_fee_amount"))
+		fmt.Fprint(w, `{"id":"pi_1","object":"payment_intent","client_secret":"pi_1_secret"}`)
+	}))
+	defer server.Close()
+
+	s := NewStripe(StripeConfig{Key: "sk_test"})
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(server.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+		LeveledLogger:     &stripe.LeveledLogger{Level: stripe.LevelNull},
+	})
+	s.paymentIntents = paymentintent.Client{B: backend, Key: "sk_test"}
+
+	// Test case 1: ISK amounts are sent with two decimals
+	_, err := s.CreatePayment(PaymentParams{StreamerID: 1, Amount: 500, Currency: "ISK", Destination: "acct_1", ApplicationFee: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 1 || amounts[0] != "50000 2500" {
+		t.Errorf("expected an amount of 50000 and a fee of 2500, got %v", amounts)
+	}
+
+	// Test case 2: three-decimal fees are rounded down to a multiple of 10
+	if _, err := s.CreatePayment(PaymentParams{StreamerID: 1, Amount: 5000, Currency: "BHD", Destination: "acct_1", ApplicationFee: 255}); err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 2 || amounts[1] != "5000 250" {
+		t.Errorf("expected an amount of 5000 and a fee of 250, got %v", amounts)
+	}
+
+	// Test case 3: three-decimal amounts Stripe can't charge are refused before the request
+	if _, err := s.CreatePayment(PaymentParams{StreamerID: 1, Amount: 5005, Currency: "BHD"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	if len(amounts) != 2 {
+		t.Errorf("expected no request for the refused amount, got %v", amounts)
+	}
+}
@@ -0,0 +1,162 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/mismatch"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
+)
+
+const (
+	defaultInterval  = 24 * time.Hour
+	defaultMinAge    = 30 * time.Minute
+	defaultMaxAge    = 30 * 24 * time.Hour
+	defaultBatchSize = 100
+)
+
+// Reconciler settles donations whose webhooks were lost. It asks the
+// provider for the payments of donations left unsettled and applies their
+// status like a webhook would, so missed events are emitted.
+type Reconciler struct {
+	Settler   settlement.Settler
+	Providers payments.Providers
+	Interval  time.Duration
+	// Donations younger than MinAge are left to their webhooks and
+	// older than MaxAge are not checked anymore.
+	MinAge    time.Duration
+	MaxAge    time.Duration
+	BatchSize int
+}
+
+// Report is the outcome of a reconciliation run.
+type Report struct {
+	Checked int
+	// Fixed counts the donations whose status was changed.
+	Fixed      int
+	Mismatches []mismatch.Mismatch
+}
+
+func (r Reconciler) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := r.Reconcile(time.Now())
+		if err != nil {
+			log.Printf("error reconciling donations: %v\n", err)
+		}
+		log.Printf("reconciled donations. Checked: %d, Fixed: %d, Mismatches: %d\n",
+			report.Checked, report.Fixed, len(report.Mismatches))
+		for _, m := range report.Mismatches {
+			log.Printf("payment mismatch. DonationID: %d, PaymentID: %s, Kind: %s, Expected: %s, Actual: %s\n",
+				m.DonationID, m.PaymentID, m.Kind, m.Expected, m.Actual)
+		}
+	}
+}
+
+// Reconcile checks every unsettled donation created between MaxAge and MinAge
+// before now. A donation that can't be checked is logged and checked again on
+// the next run. The report covers the donations checked until an error.
+func (r Reconciler) Reconcile(now time.Time) (Report, error) {
+	minAge, maxAge, batchSize := r.MinAge, r.MaxAge, r.BatchSize
+	if minAge <= 0 {
+		minAge = defaultMinAge
+	}
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	var report Report
+	afterID := 0
+	for {
+		donations, err := r.Settler.Donations.GetUnsettled(now.Add(-maxAge), now.Add(-minAge), afterID, batchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for _, d := range donations {
+			// one failing payment doesn't hold up the ones after it
+			if err := r.reconcile(d, &report); err != nil {
+				log.Printf("can't reconcile donation. DonationID: %d, Error: %v\n", d.ID, err)
+			}
+			afterID = d.ID
+		}
+
+		if len(donations) < batchSize {
+			return report, nil
+		}
+	}
+}
+
+func (r Reconciler) reconcile(d donation.Donation, report *Report) error {
+	report.Checked++
+	provider, err := r.Providers.Get(d.Provider)
+	if err != nil {
+		log.Printf("can't reconcile donation. DonationID: %d, Error: %v\n", d.ID, err)
+		return nil
+	}
+
+	outcome, ok, err := provider.FetchOutcome(d.PaymentID)
+	if errors.Is(err, payments.ErrPaymentNotFound) {
+		return r.record(d, mismatch.KindMissing, d.Status, "", report)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	// Apply records amount mismatches itself
+	if outcome.Amount != 0 && outcome.Amount != d.Amount {
+		report.Mismatches = append(report.Mismatches, r.newMismatch(d, mismatch.KindAmount,
+			strconv.FormatInt(d.Amount, 10), strconv.FormatInt(outcome.Amount, 10)))
+	}
+	changed, err := r.Settler.Apply(outcome)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	report.Fixed++
+	return r.record(d, mismatch.KindStatus, d.Status, outcome.Status, report)
+}
+
+func (r Reconciler) record(d donation.Donation, kind string, expected string, actual string, report *Report) error {
+	if err := r.Settler.Record(d, kind, expected, actual); err != nil {
+		return err
+	}
+	report.Mismatches = append(report.Mismatches, r.newMismatch(d, kind, expected, actual))
+	return nil
+}
+
+func (r Reconciler) newMismatch(d donation.Donation, kind string, expected string, actual string) mismatch.Mismatch {
+	return mismatch.Mismatch{
+		DonationID: d.ID,
+		PaymentID:  d.PaymentID,
+		Kind:       kind,
+		Expected:   expected,
+		Actual:     actual,
+		Source:     r.Settler.Source,
+	}
+}
@@ -0,0 +1,171 @@
+//go:build unit
+// +build unit
+
+package reconciler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/mismatch"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
+)
+
+func TestReconcile(t *testing.T) {
+	now := time.Now()
+	donations := donation.NewDonationMock()
+	mismatches := &mismatch.MismatchMock{}
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	provider := &payments.ProviderMock{Outcomes: map[string]payments.Outcome{
+		"pay_lost":    {PaymentID: "pay_lost", Status: donation.DonationStatusPayed, Amount: 500},
+		"pay_amount":  {PaymentID: "pay_amount", Status: donation.DonationStatusPayed, Amount: 400},
+		"pay_pending": {PaymentID: "pay_pending", Amount: 500},
+		"pay_recent":  {PaymentID: "pay_recent", Status: donation.DonationStatusPayed, Amount: 500},
+	}}
+
+	create := func(paymentID string, age time.Duration) donation.Donation {
+		d := donation.Donation{
+			PaymentID:  paymentID,
+			Provider:   provider.Name(),
+			StreamerID: s.ID,
+			Amount:     500,
+			NetAmount:  500,
+			Currency:   "USD",
+			Status:     donation.DonationStatusCreated,
+			CreatedAt:  now.Add(-age),
+		}
+		donations.Create(&d)
+		return d
+	}
+	lost := create("pay_lost", time.Hour)
+	amount := create("pay_amount", time.Hour)
+	pending := create("pay_pending", time.Hour)
+	unknown := create("pay_unknown", time.Hour)
+	recent := create("pay_recent", time.Minute)
+
+	r := Reconciler{
+		Settler: settlement.Settler{
+			Donations:  donations,
+			Streamers:  streamers,
+			Mismatches: mismatches,
+			Rates:      money.StaticRates{Base: "USD"},
+			Source:     mismatch.SourceReconciler,
+		},
+		Providers: payments.NewProviders(provider),
+		MinAge:    30 * time.Minute,
+		BatchSize: 2,
+	}
+	report, err := r.Reconcile(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case 1: every unsettled donation older than MinAge is checked
+	if report.Checked != 4 || report.Fixed != 2 {
+		t.Errorf("expected 4 donations checked and 2 fixed, got %+v", report)
+	}
+	for _, tc := range []struct {
+		d      donation.Donation
+		status string
+	}{
+		{lost, donation.DonationStatusPayed},
+		{amount, donation.DonationStatusPayed},
+		{pending, donation.DonationStatusCreated},
+		{unknown, donation.DonationStatusCreated},
+		{recent, donation.DonationStatusCreated},
+	} {
+		got, _ := donations.GetDonation(tc.d.ID)
+		if got.Status != tc.status {
+			t.Errorf("expected donation %s to be %s, got %s", tc.d.PaymentID, tc.status, got.Status)
+		}
+	}
+
+	// Test case 2: the missed events are emitted
+	if len(donations.Outbox.Messages) != 2 || donations.Outbox.Messages[0].EventName != events.DonationPayedName {
+		t.Errorf("expected 2 DonationPayed messages, got %+v", donations.Outbox.Messages)
+	}
+
+	// Test case 3: the differences are recorded
+	kinds := map[string]int{}
+	for _, m := range mismatches.Mismatches {
+		kinds[m.Kind]++
+		if m.Source != mismatch.SourceReconciler {
+			t.Errorf("expected the reconciler as source, got %s", m.Source)
+		}
+	}
+	if kinds[mismatch.KindStatus] != 2 || kinds[mismatch.KindAmount] != 1 || kinds[mismatch.KindMissing] != 1 {
+		t.Errorf("expected 2 status, 1 amount and 1 missing mismatch, got %+v", mismatches.Mismatches)
+	}
+	if len(report.Mismatches) != len(mismatches.Mismatches) {
+		t.Errorf("expected the report to list %d mismatches, got %d", len(mismatches.Mismatches), len(report.Mismatches))
+	}
+
+	// Test case 4: a second run only reports what is still unsettled
+	if report, err = r.Reconcile(now); err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 2 || report.Fixed != 0 || len(mismatches.Mismatches) != 4 {
+		t.Errorf("expected 2 donations checked and no new mismatches, got %+v", report)
+	}
+}
+
+func TestReconcileFailedPayment(t *testing.T) {
+	now := time.Now()
+	donations := donation.NewDonationMock()
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	provider := &payments.ProviderMock{
+		Outcomes: map[string]payments.Outcome{
+			"pay_1": {PaymentID: "pay_1", Status: donation.DonationStatusPayed, Amount: 500},
+			"pay_2": {PaymentID: "pay_2", Status: donation.DonationStatusPayed, Amount: 500},
+			"pay_3": {PaymentID: "pay_3", Status: donation.DonationStatusPayed, Amount: 500},
+		},
+		Errors: map[string]error{"pay_2": errors.New("connection reset")},
+	}
+	for _, paymentID := range []string{"pay_1", "pay_2", "pay_3"} {
+		donations.Create(&donation.Donation{
+			PaymentID:  paymentID,
+			Provider:   provider.Name(),
+			StreamerID: s.ID,
+			Amount:     500,
+			NetAmount:  500,
+			Currency:   "USD",
+			Status:     donation.DonationStatusCreated,
+			CreatedAt:  now.Add(-time.Hour),
+		})
+	}
+
+	r := Reconciler{
+		Settler: settlement.Settler{
+			Donations: donations,
+			Streamers: streamers,
+			Rates:     money.StaticRates{Base: "USD"},
+			Source:    mismatch.SourceReconciler,
+		},
+		Providers: payments.NewProviders(provider),
+		BatchSize: 2,
+	}
+	report, err := r.Reconcile(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case 1: the payments after the failing one are still settled
+	if report.Checked != 3 || report.Fixed != 2 {
+		t.Errorf("expected 3 donations checked and 2 fixed, got %+v", report)
+	}
+	for id, status := range map[int]string{1: donation.DonationStatusPayed, 2: donation.DonationStatusCreated, 3: donation.DonationStatusPayed} {
+		if got, _ := donations.GetDonation(id); got.Status != status {
+			t.Errorf("expected donation %d to be %s, got %s", id, status, got.Status)
+		}
+	}
+}
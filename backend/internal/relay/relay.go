@@ -0,0 +1,170 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+)
+
+const (
+	defaultInterval    = time.Second
+	defaultBatchSize   = 100
+	defaultMaxAttempts = 10
+	// lease is how long a claimed message stays invisible to other relays.
+	lease = 30 * time.Second
+	// a failed message is retried after minBackoff, doubling with every attempt up to maxBackoff
+	minBackoff = 5 * time.Second
+	maxBackoff = time.Hour
+)
+
+// ErrNotHandled is returned when published events weren't handled within the AckTimeout.
+var ErrNotHandled = errors.New("events not handled in time")
+
+// Relay drains the outbox into the event bus. Delivery is at-least-once:
+// a message is marked delivered only after its handlers have succeeded, so
+// a failed handler or a crash in between publishes it again. A failed message
+// is retried with backoff and only reaches the handlers that failed, after
+// MaxAttempts it's parked.
+type Relay struct {
+	Outbox       outbox.OutboxRepo
+	EventEmitter events.EventEmitter
+	Interval     time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	// AckTimeout is how long the relay waits for a batch to be handled,
+	// the lease of the claimed messages by default.
+	AckTimeout time.Duration
+}
+
+func (r Relay) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Drain(); err != nil {
+			log.Printf("error draining outbox: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain publishes every pending message and returns when the outbox is empty.
+func (r Relay) Drain() error {
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	for {
+		messages, err := r.Outbox.Claim(batchSize, lease)
+		if err != nil {
+			return err
+		}
+
+		if err := r.deliver(messages); err != nil {
+			return err
+		}
+
+		if len(messages) < batchSize {
+			return nil
+		}
+	}
+}
+
+// ack is a message's outcome reported by the event emitter.
+type ack struct {
+	message outbox.Message
+	events.Ack
+}
+
+// deliver publishes the messages in order and records the outcome of each once it's handled.
+func (r Relay) deliver(messages []outbox.Message) error {
+	ackTimeout := r.AckTimeout
+	if ackTimeout <= 0 {
+		ackTimeout = lease
+	}
+
+	handled := make(chan ack, len(messages))
+	published := 0
+	var publishErr error
+	for _, m := range messages {
+		payload, err := events.Decode(m.EventName, m.Payload)
+		if err != nil {
+			// an undecodable message will never succeed, don't block the rest of the outbox
+			log.Printf("error decoding outbox message. ID: %d, Error: %v\n", m.ID, err)
+			if err := r.Outbox.MarkDelivered(m.ID); err != nil {
+				publishErr = err
+				break
+			}
+			continue
+		}
+
+		m := m
+		if err := r.EventEmitter.Publish(payload, m.EventName, m.HandledBy, func(a events.Ack) { handled <- ack{message: m, Ack: a} }); err != nil {
+			publishErr = err
+			break
+		}
+		published++
+	}
+
+	// the published messages are recorded even if a later one failed,
+	// unhandled ones are published again once their lease expires
+	timeout := time.NewTimer(ackTimeout)
+	defer timeout.Stop()
+	for ; published > 0; published-- {
+		select {
+		case a := <-handled:
+			if err := r.record(a); err != nil {
+				return err
+			}
+		case <-timeout.C:
+			return ErrNotHandled
+		}
+	}
+	return publishErr
+}
+
+// record marks the message of a delivered, or schedules it for the handlers that failed.
+func (r Relay) record(a ack) error {
+	m := a.message
+	if a.OK() {
+		return r.Outbox.MarkDelivered(m.ID)
+	}
+
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	handledBy := append(append([]string{}, m.HandledBy...), a.Handled...)
+	attempts := m.Attempts + 1
+	if attempts >= maxAttempts {
+		log.Printf("parking outbox message after %d attempts. ID: %d, Failed: %v\n", attempts, m.ID, a.Failed)
+		return r.Outbox.Park(m.ID, handledBy)
+	}
+	return r.Outbox.Retry(m.ID, handledBy, backoff(attempts))
+}
+
+// backoff returns how long to wait before the next attempt after the failed ones.
+func backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,219 @@
+//go:build unit
+// +build unit
+
+package relay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events/cevents"
+)
+
+type emitterMock struct {
+	published []any
+	err       error
+	// unhandled publishes events without running their handlers
+	unhandled bool
+}
+
+func (em *emitterMock) Publish(event any, name string, skip []string, handled func(events.Ack)) error {
+	if em.err != nil {
+		return em.err
+	}
+	em.published = append(em.published, event)
+	if !em.unhandled {
+		handled(events.Ack{Handled: []string{"overlay"}})
+	}
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	outboxMock := &outbox.OutboxMock{}
+	for i := 1; i <= 3; i++ {
+		m, _ := outbox.NewMessage(events.DonationPayedName, events.DonationPayed{DonationID: i})
+		outboxMock.Add(m)
+	}
+	emitter := &emitterMock{err: errors.New("bus is down")}
+	r := Relay{Outbox: outboxMock, EventEmitter: emitter, BatchSize: 2, AckTimeout: 10 * time.Millisecond}
+
+	// Test case 1: failed publish leaves the message undelivered
+	if err := r.Drain(); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	for _, m := range outboxMock.Messages {
+		if m.DeliveredAt.Valid {
+			t.Fatalf("expected message %d to stay undelivered", m.ID)
+		}
+	}
+
+	// Test case 2: published events are not delivered until they are handled
+	for i := range outboxMock.Messages {
+		outboxMock.Messages[i].LockedUntil.Valid = false
+	}
+	emitter.err = nil
+	emitter.unhandled = true
+	if err := r.Drain(); !errors.Is(err, ErrNotHandled) {
+		t.Fatalf("expected ErrNotHandled, got %v", err)
+	}
+	for _, m := range outboxMock.Messages {
+		if m.DeliveredAt.Valid {
+			t.Fatalf("expected message %d to stay undelivered", m.ID)
+		}
+	}
+
+	// Test case 3: messages are redelivered in order once the lease expires
+	for i := range outboxMock.Messages {
+		outboxMock.Messages[i].LockedUntil.Valid = false
+	}
+	emitter.published = nil
+	emitter.unhandled = false
+	if err := r.Drain(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(emitter.published) != 3 {
+		t.Fatalf("expected 3 published events, got %d", len(emitter.published))
+	}
+	for i, e := range emitter.published {
+		dp, ok := e.(events.DonationPayed)
+		if !ok {
+			t.Fatalf("expected events.DonationPayed, got %T", e)
+		}
+		if dp.DonationID != i+1 {
+			t.Fatalf("expected DonationID %d, got %d", i+1, dp.DonationID)
+		}
+	}
+	for _, m := range outboxMock.Messages {
+		if !m.DeliveredAt.Valid {
+			t.Fatalf("expected message %d to be delivered", m.ID)
+		}
+	}
+}
+
+type handlerFunc func(event any) error
+
+func (f handlerFunc) Handle(event any) error {
+	return f(event)
+}
+
+func TestDrainFailedHandler(t *testing.T) {
+	outboxMock := &outbox.OutboxMock{}
+	m, _ := outbox.NewMessage(events.DonationPayedName, events.DonationPayed{DonationID: 1})
+	outboxMock.Add(m)
+
+	bus := cevents.New(make(chan events.Event))
+	var mu sync.Mutex
+	calls := map[string]int{}
+	failing := true
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls["overlay"]++
+		return nil
+	}), events.DonationPayedName)
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls["analytics"]++
+		if failing {
+			return errors.New("analytics is down")
+		}
+		return nil
+	}), events.DonationPayedName)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bus.Run(ctx)
+	r := Relay{Outbox: outboxMock, EventEmitter: &bus, MaxAttempts: 3, AckTimeout: time.Second}
+	expire := func() {
+		outboxMock.Messages[0].LockedUntil.Valid = false
+	}
+
+	// Test case 1: a message whose handler failed stays undelivered and is retried later
+	if err := r.Drain(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got := outboxMock.Messages[0]
+	if got.DeliveredAt.Valid || got.Attempts != 1 || len(got.HandledBy) != 1 {
+		t.Fatalf("expected 1 failed attempt handled by 1 subscriber, got %+v", got)
+	}
+	if until := time.Until(got.LockedUntil.Time); until < minBackoff-time.Second {
+		t.Fatalf("expected the retry to back off, got %s", until)
+	}
+
+	// Test case 2: it's redelivered only to the failed handler
+	expire()
+	if err := r.Drain(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls["overlay"] != 1 || calls["analytics"] != 2 {
+		t.Fatalf("expected only the failed handler to run again, got %v", calls)
+	}
+
+	// Test case 3: it's parked after MaxAttempts
+	expire()
+	if err := r.Drain(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := outboxMock.Messages[0]; !got.ParkedAt.Valid || got.Attempts != 3 {
+		t.Fatalf("expected the message to be parked after 3 attempts, got %+v", got)
+	}
+	expire()
+	if messages, _ := outboxMock.Claim(10, lease); len(messages) != 0 {
+		t.Fatalf("expected the parked message not to be claimed, got %+v", messages)
+	}
+}
+
+func TestDrainRecoveredHandler(t *testing.T) {
+	outboxMock := &outbox.OutboxMock{}
+	m, _ := outbox.NewMessage(events.DonationPayedName, events.DonationPayed{DonationID: 1})
+	outboxMock.Add(m)
+
+	bus := cevents.New(make(chan events.Event))
+	calls := 0
+	bus.RegisterHandler(handlerFunc(func(event any) error {
+		calls++
+		if calls == 1 {
+			return errors.New("overlay is down")
+		}
+		return nil
+	}), events.DonationPayedName)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bus.Run(ctx)
+	r := Relay{Outbox: outboxMock, EventEmitter: &bus, AckTimeout: time.Second}
+
+	// Test case 1: a redelivered message is marked delivered once its handler succeeds
+	if err := r.Drain(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	outboxMock.Messages[0].LockedUntil.Valid = false
+	if err := r.Drain(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls != 2 || !outboxMock.Messages[0].DeliveredAt.Valid {
+		t.Fatalf("expected the message to be handled again and delivered, got %d calls", calls)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, minBackoff},
+		{2, 2 * minBackoff},
+		{3, 4 * minBackoff},
+		{100, maxBackoff},
+	}
+
+	for _, tc := range cases {
+		if d := backoff(tc.attempts); d != tc.expected {
+			t.Errorf("backoff(%d): expected %s, got %s", tc.attempts, tc.expected, d)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package settlement
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/blocklist"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/mismatch"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/filter"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+)
+
+// Settler applies the payment outcomes reported by providers to donations.
+type Settler struct {
+	Donations donation.DonationRepo
+	Streamers streamer.StreamerRepo
+	// Mismatches records payments of another amount than their donation,
+	// they are only logged if it is nil.
+	Mismatches mismatch.MismatchRepo
+	Rates      money.Rates
+	// Blocklist refunds payments of donors the streamer blocked through Providers,
+	// donors are not checked if it is nil.
+	Blocklist blocklist.BlocklistRepo
+	// Subscriptions are canceled through Providers once their donor is blocked,
+	// they keep charging the donor if it is nil.
+	Subscriptions subscription.SubscriptionRepo
+	Providers     payments.Providers
+	// Source tells which part of the server found a mismatch.
+	Source string
+}
+
+// WithSource returns a copy of s that records its mismatches as found by source.
+func (s Settler) WithSource(source string) Settler {
+	s.Source = source
+	return s
+}
+
+// maxApplyAttempts is how often an outcome is applied to a donation that keeps
+// being changed concurrently, e.g. by the webhook and the reconciler at once.
+const maxApplyAttempts = 3
+
+// Apply moves the donation to the reported status. The matching event
+// is written to the outbox with the donation. Outcomes that don't apply to
+// the donation are ignored. It reports whether the donation changed.
+func (s Settler) Apply(o payments.Outcome) (bool, error) {
+	paymentID := o.PaymentID
+	donations, err := s.Donations.GetDonations(&donation.Donation{PaymentID: paymentID})
+	if err != nil {
+		return false, fmt.Errorf("error getting donation with PaymentID: %s: %w", paymentID, err)
+	}
+	if len(donations) < 1 {
+		log.Printf("Donation not found. PaymentID: %s\n", paymentID)
+		return false, nil
+	}
+	if len(donations) > 1 {
+		return false, fmt.Errorf("more than one donation found. PaymentID: %s", paymentID)
+	}
+	d := donations[0]
+
+	if o.Amount != 0 && o.Amount != d.Amount {
+		log.Printf("wrong amount. expected: %d, got: %d. PaymentID: %s\n", d.Amount, o.Amount, paymentID)
+		if err := s.Record(d, mismatch.KindAmount, strconv.FormatInt(d.Amount, 10), strconv.FormatInt(o.Amount, 10)); err != nil {
+			return false, err
+		}
+	}
+
+	// a donation changed since it was read is read again, the outcome
+	// may no longer apply to it
+	for attempt := 1; ; attempt++ {
+		changed, updated, err := s.apply(d, o)
+		if err != nil || updated {
+			return changed, err
+		}
+		if attempt == maxApplyAttempts {
+			return false, fmt.Errorf("donation keeps changing concurrently. DonationID: %d", d.ID)
+		}
+		id := d.ID
+		if d, err = s.Donations.GetDonation(id); err != nil {
+			return false, fmt.Errorf("error getting donation. DonationID: %d: %w", id, err)
+		}
+	}
+}
+
+// apply moves d to the status of o, unless d was changed since it was read.
+// It reports whether d changed and false for updated if d was changed concurrently.
+func (s Settler) apply(d donation.Donation, o payments.Outcome) (changed bool, updated bool, err error) {
+	from := d.Status
+	changed, err = d.Transition(o.Status)
+	if err != nil {
+		// providers don't guarantee the order of events, a late event must not
+		// move the donation back, so it is acknowledged and ignored
+		log.Printf("ignoring status change. DonationID: %d, Error: %v\n", d.ID, err)
+		return false, true, nil
+	}
+	if !changed {
+		return false, true, nil
+	}
+
+	if d.Status == donation.DonationStatusPayed && !d.HomeCurrency.Valid {
+		// without a snapshot totals convert the donation at the current rate
+		if err := s.snapshotRate(&d); err != nil {
+			log.Printf("can't convert donation to home currency. DonationID: %d, Error: %v\n", d.ID, err)
+		}
+	}
+
+	// a restored donation keeps its moderation
+	if d.Status == donation.DonationStatusPayed && from != donation.DonationStatusDisputed {
+		d.CustomerID = o.Donor.CustomerID
+		d.CardFingerprint = o.Donor.CardFingerprint
+		blocked, err := s.refundBlocked(&d)
+		if err != nil {
+			return false, false, fmt.Errorf("can't refund blocked donor. DonationID: %d: %w", d.ID, err)
+		}
+		if blocked {
+			// the alert was never shown, so nobody is told about the donation
+			updated, err := s.Donations.UpdateFrom(d, from)
+			if err != nil {
+				return false, false, fmt.Errorf("can't update donation status. DonationID: %d: %w", d.ID, err)
+			}
+			return updated, updated, nil
+		}
+		if err := s.holdForReview(&d, time.Now()); err != nil {
+			return false, false, fmt.Errorf("can't hold donation for review. DonationID: %d: %w", d.ID, err)
+		}
+	}
+
+	messages, err := statusMessages(from, d, o.Reason)
+	if err != nil {
+		return false, false, fmt.Errorf("error creating outbox message. DonationID: %d: %w", d.ID, err)
+	}
+
+	// the event is stored with the status change, so the change is retried
+	// until both are committed. Of concurrent outcomes only the first is stored.
+	updated, err = s.Donations.UpdateFrom(d, from, messages...)
+	if err != nil {
+		return false, false, fmt.Errorf("can't update donation status. DonationID: %d: %w", d.ID, err)
+	}
+	return updated, updated, nil
+}
+
+// Record saves a mismatch between d and its payment, if Mismatches is set.
+func (s Settler) Record(d donation.Donation, kind string, expected string, actual string) error {
+	if s.Mismatches == nil {
+		return nil
+	}
+	_, err := s.Mismatches.Create(&mismatch.Mismatch{
+		DonationID: d.ID,
+		PaymentID:  d.PaymentID,
+		Kind:       kind,
+		Expected:   expected,
+		Actual:     actual,
+		Source:     s.Source,
+	})
+	if err != nil {
+		return fmt.Errorf("can't record mismatch. DonationID: %d: %w", d.ID, err)
+	}
+	return nil
+}
+
+// refundBlocked refunds d if the streamer blocked its donor. It reports whether d was refunded.
+func (s Settler) refundBlocked(d *donation.Donation) (bool, error) {
+	if s.Blocklist == nil {
+		return false, nil
+	}
+	entries, err := s.Blocklist.Match(d.StreamerID, blocklist.DonorKeys(*d))
+	if err != nil || len(entries) == 0 {
+		return false, err
+	}
+
+	provider, err := s.Providers.Get(d.Provider)
+	if err != nil {
+		return false, err
+	}
+	// a redelivered event gets the same refund
+	refundID, err := provider.Refund(payments.RefundParams{
+		PaymentID:      d.PaymentID,
+		DonationID:     d.ID,
+		IdempotencyKey: "donation-blocked-" + strconv.Itoa(d.ID),
+	})
+	if err != nil {
+		return false, err
+	}
+	log.Printf("donation of blocked donor refunded. DonationID: %d, EntryID: %d, RefundID: %s\n", d.ID, entries[0].ID, refundID)
+	if d.SubscriptionID.Valid {
+		if err := s.cancelSubscription(int(d.SubscriptionID.Int64), provider); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := d.Transition(donation.DonationStatusRefunded); err != nil {
+		return false, err
+	}
+	d.RefundID = sql.NullString{String: refundID, Valid: true}
+	d.RefundReason = sql.NullString{String: "blocked donor", Valid: true}
+	return true, nil
+}
+
+// cancelSubscription cancels the subscription with id, so its blocked donor isn't charged again.
+func (s Settler) cancelSubscription(id int, provider payments.Provider) error {
+	if s.Subscriptions == nil {
+		return nil
+	}
+	sub, err := s.Subscriptions.GetSubscriptionById(id)
+	if err != nil {
+		return fmt.Errorf("error getting subscription. ID: %d: %w", id, err)
+	}
+	if sub.Status == subscription.StatusCanceled {
+		return nil
+	}
+	subscriptions, ok := provider.(payments.Subscriptions)
+	if !ok {
+		return fmt.Errorf("%w: subscriptions of %s", payments.ErrUnsupported, provider.Name())
+	}
+	if err := subscriptions.CancelSubscription(sub.SubscriptionID); err != nil {
+		return fmt.Errorf("can't cancel subscription. SubscriptionID: %s: %w", sub.SubscriptionID, err)
+	}
+	log.Printf("subscription of blocked donor canceled. SubscriptionID: %s\n", sub.SubscriptionID)
+	return s.Subscriptions.UpdateStatus(sub.ID, subscription.StatusCanceled)
+}
+
+// holdForReview keeps the alert of d off the overlay until it's approved,
+// if the streamer reviews donations or the message filter sent d to moderation.
+// Donations sent by the filter are never approved automatically.
+func (s Settler) holdForReview(d *donation.Donation, now time.Time) error {
+	if d.AlertSeq.Valid || (d.ModerationStatus != "" && d.ModerationStatus != donation.ModerationStatusNone) {
+		return nil
+	}
+	st, err := s.Streamers.GetStreamerById(d.StreamerID)
+	if err != nil {
+		return err
+	}
+	if st == nil || (!st.HoldForReview && d.FilterAction != filter.ActionModerate) {
+		return nil
+	}
+
+	d.ModerationStatus = donation.ModerationStatusPending
+	if st.AutoApproveSeconds > 0 && d.FilterAction != filter.ActionModerate {
+		deadline := now.Add(time.Duration(st.AutoApproveSeconds) * time.Second)
+		d.ReviewDeadline = sql.NullTime{Time: deadline, Valid: true}
+	}
+	return nil
+}
+
+// snapshotRate converts d to the streamer's home currency at the current exchange rate.
+func (s Settler) snapshotRate(d *donation.Donation) error {
+	st, err := s.Streamers.GetStreamerById(d.StreamerID)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return fmt.Errorf("streamer not found. StreamerID: %d", d.StreamerID)
+	}
+
+	rate, err := s.Rates.Rate(d.Currency, st.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	d.HomeCurrency = sql.NullString{String: st.DefaultCurrency, Valid: true}
+	d.HomeAmount = sql.NullInt64{Int64: money.Convert(d.Amount, d.Currency, st.DefaultCurrency, rate), Valid: true}
+	d.HomeNetAmount = sql.NullInt64{Int64: money.Convert(d.NetAmount, d.Currency, st.DefaultCurrency, rate), Valid: true}
+	d.ExchangeRate = sql.NullFloat64{Float64: rate, Valid: true}
+	return nil
+}
+
+// statusMessages builds the events of d moving from status from to d.Status.
+func statusMessages(from string, d donation.Donation, reason string) ([]outbox.Message, error) {
+	var (
+		message outbox.Message
+		err     error
+	)
+	switch d.Status {
+	case donation.DonationStatusPayed:
+		// a won dispute restores the donation, but its alert is not shown again
+		if from == donation.DonationStatusDisputed {
+			return nil, nil
+		}
+		message, err = outbox.NewMessage(events.DonationPayedName, events.DonationPayed{
+			PaymentID:   d.PaymentID,
+			Message:     d.Message,
+			Name:        d.Name,
+			Status:      d.Status,
+			DonationID:  d.ID,
+			StreamerID:  d.StreamerID,
+			Amount:      d.Amount,
+			Currency:    d.Currency,
+			Fee:         d.Fee,
+			NetAmount:   d.NetAmount,
+			FeesCovered: d.FeesCovered,
+			Recurring:   d.Recurring(),
+			Month:       d.Month,
+			// the alert is shown when the donation is approved
+			HeldForReview: d.ModerationStatus == donation.ModerationStatusPending,
+		})
+	case donation.DonationStatusProcessing:
+		message, err = outbox.NewMessage(events.DonationProcessingName, events.DonationProcessing{
+			PaymentID:  d.PaymentID,
+			DonationID: d.ID,
+			StreamerID: d.StreamerID,
+		})
+	case donation.DonationStatusExpired:
+		// nobody waits for an abandoned donation
+		return nil, nil
+	case donation.DonationStatusFailed, donation.DonationStatusCanceled:
+		message, err = outbox.NewMessage(events.DonationFailedName, events.DonationFailed{
+			PaymentID:  d.PaymentID,
+			Status:     d.Status,
+			Reason:     reason,
+			DonationID: d.ID,
+			StreamerID: d.StreamerID,
+		})
+	default:
+		// the alert was already retracted when the dispute was opened
+		if from == donation.DonationStatusDisputed {
+			return nil, nil
+		}
+		message, err = outbox.NewMessage(events.DonationRetractedName, events.DonationRetracted{
+			PaymentID:  d.PaymentID,
+			Status:     d.Status,
+			AlertSeq:   d.AlertSeq.Int64,
+			DonationID: d.ID,
+			StreamerID: d.StreamerID,
+			Amount:     d.Amount,
+			Currency:   d.Currency,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []outbox.Message{message}, nil
+}
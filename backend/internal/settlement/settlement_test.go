@@ -0,0 +1,148 @@
+//go:build unit
+// +build unit
+
+package settlement
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/blocklist"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+)
+
+func TestApplyBlockedDonor(t *testing.T) {
+	donations := donation.NewDonationMock()
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	entries := &blocklist.BlocklistMock{}
+	entries.Create(&blocklist.Entry{StreamerID: s.ID, Kind: blocklist.KindCard, Value: "fp_troll"})
+	entries.Create(&blocklist.Entry{StreamerID: s.ID + 1, Kind: blocklist.KindName, Value: "friend"})
+	provider := &payments.ProviderMock{}
+	subscriptions := subscription.NewSubscriptionMock()
+	sub := subscription.Subscription{Provider: provider.Name(), SubscriptionID: "sub_1", StreamerID: s.ID, Status: subscription.StatusActive}
+	subscriptions.Create(&sub)
+
+	settler := Settler{
+		Donations:     donations,
+		Streamers:     streamers,
+		Rates:         money.StaticRates{Base: "USD"},
+		Blocklist:     entries,
+		Subscriptions: subscriptions,
+		Providers:     payments.NewProviders(provider),
+	}
+	pay := func(paymentID string, name string, subscriptionID int, donor payments.Donor) donation.Donation {
+		d := donation.Donation{
+			PaymentID:      paymentID,
+			Provider:       provider.Name(),
+			StreamerID:     s.ID,
+			Name:           name,
+			Amount:         500,
+			NetAmount:      500,
+			Currency:       "USD",
+			Status:         donation.DonationStatusCreated,
+			SubscriptionID: sql.NullInt64{Int64: int64(subscriptionID), Valid: subscriptionID != 0},
+		}
+		donations.Create(&d)
+		o := payments.Outcome{PaymentID: paymentID, Status: donation.DonationStatusPayed, Amount: 500, Donor: donor}
+		// a redelivered event changes nothing
+		for i := 0; i < 2; i++ {
+			if _, err := settler.Apply(o); err != nil {
+				t.Fatal(err)
+			}
+		}
+		d, _ = donations.GetDonation(d.ID)
+		return d
+	}
+	blocked := pay("pay_blocked", "someone", 0, payments.Donor{CustomerID: "cus_1", CardFingerprint: "fp_troll"})
+	friend := pay("pay_friend", "Friend", 0, payments.Donor{CustomerID: "cus_2", CardFingerprint: "fp_friend"})
+
+	// Test case 1: the payment of a blocked donor is refunded without an alert
+	if blocked.Status != donation.DonationStatusRefunded || blocked.AlertSeq.Valid || !blocked.RefundID.Valid {
+		t.Errorf("expected the blocked donor's donation to be refunded, got %+v", blocked)
+	}
+	if len(provider.Refunds) != 1 || provider.Refunds[0].PaymentID != "pay_blocked" {
+		t.Errorf("expected 1 refund of pay_blocked, got %+v", provider.Refunds)
+	}
+	if blocked.CardFingerprint != "fp_troll" || blocked.CustomerID != "cus_1" {
+		t.Errorf("expected the donor to be stored, got %+v", blocked)
+	}
+
+	// Test case 2: another streamer's blocklist doesn't apply
+	if friend.Status != donation.DonationStatusPayed || !friend.AlertSeq.Valid {
+		t.Errorf("expected the donation to be payed, got %+v", friend)
+	}
+	if len(donations.Outbox.Messages) != 1 || donations.Outbox.Messages[0].EventName != events.DonationPayedName {
+		t.Errorf("expected only the DonationPayed message of pay_friend, got %+v", donations.Outbox.Messages)
+	}
+
+	// Test case 3: the subscription of a blocked donor is canceled once
+	monthly := pay("pay_monthly", "someone", sub.ID, payments.Donor{CustomerID: "cus_1", CardFingerprint: "fp_troll"})
+	if monthly.Status != donation.DonationStatusRefunded {
+		t.Errorf("expected the monthly donation to be refunded, got %+v", monthly)
+	}
+	if len(provider.CanceledSubscriptions) != 1 || provider.CanceledSubscriptions[0] != "sub_1" {
+		t.Errorf("expected sub_1 to be canceled, got %v", provider.CanceledSubscriptions)
+	}
+	if got, _ := subscriptions.GetSubscriptionById(sub.ID); got.Status != subscription.StatusCanceled {
+		t.Errorf("expected status %s, got %s", subscription.StatusCanceled, got.Status)
+	}
+}
+
+// staleDonations returns the donations as they were before the outcome
+// of another settler was stored.
+type staleDonations struct {
+	*donation.DonationMock
+	snapshot []donation.Donation
+}
+
+func (r staleDonations) GetDonations(d *donation.Donation) ([]donation.Donation, error) {
+	return r.snapshot, nil
+}
+
+func TestApplyConcurrent(t *testing.T) {
+	donations := donation.NewDonationMock()
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	d := donation.Donation{PaymentID: "pay_1", StreamerID: s.ID, Amount: 500, NetAmount: 500, Currency: "USD", Status: donation.DonationStatusCreated}
+	donations.Create(&d)
+	settler := Settler{Donations: donations, Streamers: streamers, Rates: money.StaticRates{Base: "USD"}}
+	// the reconciler read the donation before the webhook payed it and it was refunded
+	late := settler.WithSource("reconciler")
+	late.Donations = staleDonations{DonationMock: donations, snapshot: []donation.Donation{d}}
+
+	if _, err := settler.Apply(payments.Outcome{PaymentID: "pay_1", Status: donation.DonationStatusPayed}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := settler.Apply(payments.Outcome{PaymentID: "pay_1", Status: donation.DonationStatusRefunded}); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := late.Apply(payments.Outcome{PaymentID: "pay_1", Status: donation.DonationStatusPayed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case 1: the late success doesn't restore the refunded donation
+	got, _ := donations.GetDonation(d.ID)
+	if changed || got.Status != donation.DonationStatusRefunded {
+		t.Errorf("expected the donation to stay refunded, got %v %s", changed, got.Status)
+	}
+
+	// Test case 2: the donation is announced once
+	payed := 0
+	for _, m := range donations.Outbox.Messages {
+		if m.EventName == events.DonationPayedName {
+			payed++
+		}
+	}
+	if payed != 1 {
+		t.Errorf("expected 1 DonationPayed message, got %+v", donations.Outbox.Messages)
+	}
+}
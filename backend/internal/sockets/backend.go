@@ -0,0 +1,34 @@
+package sockets
+
+import (
+	"context"
+)
+
+// Backend message types.
+const (
+	backendDonation = "donation"
+	backendAck      = "ack"
+	backendControl  = "control"
+	backendRetract  = "retract"
+	// backendResync is delivered by a backend that may have missed messages.
+	backendResync = "resync"
+)
+
+// BackendMessage is hub traffic shared between instances.
+type BackendMessage struct {
+	Type       string         `json:"type"`
+	StreamerID int            `json:"streamerId"`
+	Donation   *DonationEvent `json:"donation,omitempty"`
+	Command    *Command       `json:"command,omitempty"`
+	Seq        int64          `json:"seq,omitempty"`
+}
+
+// Backend fans hub traffic out to the hubs of every instance, so an alert
+// reaches the overlay whichever instance it is connected to. A hub without
+// a backend only serves its own instance.
+type Backend interface {
+	// Publish sends m to every instance, including this one.
+	Publish(m BackendMessage) error
+	// Listen calls deliver for every published message until ctx is cancelled.
+	Listen(ctx context.Context, deliver func(BackendMessage)) error
+}
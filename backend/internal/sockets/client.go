@@ -0,0 +1,39 @@
+package sockets
+
+// Messages buffered for a client before it is considered stuck.
+const sendBufferSize = 16
+
+// FrameAcked frames carry no message, they tell transports that resume
+// from a sequence number that the overlays have shown alert Seq.
+const FrameAcked = "acked"
+
+// Frame is an encoded message queued for an overlay.
+type Frame struct {
+	Type string
+	// Seq is the alert sequence number of alert and acked frames.
+	Seq  int64
+	Data []byte
+}
+
+// Client is a single overlay connection of a streamer, independent of the transport.
+type Client struct {
+	hub        *Hub
+	send       chan Frame
+	lastSeq    int64
+	StreamerID int
+}
+
+func newClient(hub *Hub, streamerID int, lastSeq int64) *Client {
+	return &Client{
+		hub:        hub,
+		send:       make(chan Frame, sendBufferSize),
+		lastSeq:    lastSeq,
+		StreamerID: streamerID,
+	}
+}
+
+// Frames returns the messages to deliver to the overlay.
+// The channel is closed when the hub drops the client.
+func (c *Client) Frames() <-chan Frame {
+	return c.send
+}
@@ -1,71 +1,487 @@
 package sockets
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
 )
 
+// defaultAckTimeout is how long the hub waits for an overlay to finish an alert.
+const defaultAckTimeout = 30 * time.Second
+
 type Hub struct {
-	clients       map[int]*websocket.Conn
-	connClientMap map[*websocket.Conn]int
+	store         AlertStore
+	backend       Backend
+	ackTimeout    time.Duration
+	clients       map[int]map[*Client]struct{}
+	queues        map[int]*alertQueue
+	states        map[int]StatePayload
 	donationsC    chan DonationEvent
-	registrationC chan RegistrationRequest
+	registrationC chan *Client
+	unregisterC   chan *Client
+	ackC          chan ackRequest
+	timeoutC      chan ackRequest
+	controlC      chan controlRequest
+	retractC      chan ackRequest
+	resyncC       chan struct{}
+	done          chan struct{}
+}
+
+type ackRequest struct {
+	streamerID int
+	seq        int64
 }
 
-type RegistrationRequest struct {
-	Conn       *websocket.Conn
-	StreamerID int
+type controlRequest struct {
+	streamerID int
+	command    Command
 }
 
 type DonationEvent struct {
-	Name       string `json:"name"`
-	Text       string `json:"text"`
-	Amount     int    `json:"amount"`
-	StreamerID int    `json:"-"`
+	Name string `json:"name"`
+	Text string `json:"text"`
+	// Amount is in the minor unit of Currency.
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	// Display is the amount formatted in the streamer's locale, e.g. "$ 4.99".
+	Display string `json:"display"`
+	// Net is what the streamer receives after the provider's fee.
+	// FeesCovered is set when the donor paid the fee on top.
+	Net         int64  `json:"net"`
+	NetDisplay  string `json:"netDisplay"`
+	FeesCovered bool   `json:"feesCovered,omitempty"`
+	// Recurring is set for a supporter's monthly donation, Month counts them from 1.
+	Recurring  bool  `json:"recurring,omitempty"`
+	Month      int   `json:"month,omitempty"`
+	Seq        int64 `json:"seq"`
+	Replay     bool  `json:"replay,omitempty"`
+	StreamerID int   `json:"-"`
+}
+
+// NewDonationEvent builds the alert shown for a payed donation,
+// formatting the amount in locale.
+func NewDonationEvent(d donation.Donation, locale string) DonationEvent {
+	return DonationEvent{
+		Name:        d.Name,
+		Text:        d.Message,
+		Amount:      d.Amount,
+		Currency:    d.Currency,
+		Display:     d.Money().Format(locale),
+		Net:         d.NetAmount,
+		NetDisplay:  d.Net().Format(locale),
+		FeesCovered: d.FeesCovered,
+		Recurring:   d.Recurring(),
+		Month:       d.Month,
+		Seq:         d.AlertSeq.Int64,
+		StreamerID:  d.StreamerID,
+	}
 }
 
-func CreateNew() Hub {
+// CreateNew creates a hub. backend may be nil when only one instance is running.
+func CreateNew(store AlertStore, backend Backend) Hub {
 	return Hub{
-		clients:       map[int]*websocket.Conn{},
-		connClientMap: map[*websocket.Conn]int{},
+		store:         store,
+		backend:       backend,
+		ackTimeout:    defaultAckTimeout,
+		clients:       map[int]map[*Client]struct{}{},
+		queues:        map[int]*alertQueue{},
+		states:        map[int]StatePayload{},
 		donationsC:    make(chan DonationEvent),
-		registrationC: make(chan RegistrationRequest),
+		registrationC: make(chan *Client),
+		unregisterC:   make(chan *Client),
+		ackC:          make(chan ackRequest),
+		timeoutC:      make(chan ackRequest),
+		controlC:      make(chan controlRequest),
+		retractC:      make(chan ackRequest),
+		resyncC:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Subscribe adds an overlay of the streamer to the hub. lastSeq is the last
+// alert the overlay has shown; pending alerts up to it are treated as
+// acknowledged. It reports false if the hub is stopped.
+func (hub *Hub) Subscribe(streamerID int, lastSeq int64) (*Client, bool) {
+	c := newClient(hub, streamerID, lastSeq)
+	select {
+	case hub.registrationC <- c:
+		return c, true
+	case <-hub.done:
+		return nil, false
+	}
+}
+
+func (hub *Hub) UnregisterClient(c *Client) {
+	select {
+	case hub.unregisterC <- c:
+	case <-hub.done:
+	}
+}
+
+// Ack tells the hub the streamer's overlay has finished showing alert seq.
+func (hub *Hub) Ack(streamerID int, seq int64) {
+	hub.publish(BackendMessage{Type: backendAck, StreamerID: streamerID, Seq: seq})
+}
+
+// HandleMessage processes a message sent by an overlay of the streamer.
+func (hub *Hub) HandleMessage(streamerID int, data []byte) error {
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m.Version < minProtocolVersion || m.Version > ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version: %d", m.Version)
+	}
+
+	switch m.Type {
+	case MessageAck, MessageDone:
+		var ack AckPayload
+		if err := json.Unmarshal(m.Payload, &ack); err != nil {
+			return err
+		}
+		hub.Ack(streamerID, ack.Seq)
+		return nil
+	default:
+		return fmt.Errorf("unknown message type: %s", m.Type)
+	}
+}
+
+// Control applies a moderator command to every overlay of the streamer.
+func (hub *Hub) Control(streamerID int, command Command) error {
+	if err := command.Validate(); err != nil {
+		return err
+	}
+
+	hub.publish(BackendMessage{Type: backendControl, StreamerID: streamerID, Command: &command})
+	return nil
+}
+
+// Retract takes the streamer's alert seq off the queue and the overlays,
+// e.g. when the donation is refunded.
+func (hub *Hub) Retract(streamerID int, seq int64) {
+	hub.publish(BackendMessage{Type: backendRetract, StreamerID: streamerID, Seq: seq})
+}
+
+func (hub *Hub) Donate(donation DonationEvent) {
+	hub.publish(BackendMessage{Type: backendDonation, StreamerID: donation.StreamerID, Donation: &donation})
+}
+
+// publish shares m with the hubs of all instances. If the backend fails,
+// m is still delivered to this instance.
+func (hub *Hub) publish(m BackendMessage) {
+	if hub.backend != nil {
+		err := hub.backend.Publish(m)
+		if err == nil {
+			return
+		}
+		log.Printf("error publishing to hub backend. Type: %s, StreamerID: %d, Error: %v", m.Type, m.StreamerID, err)
 	}
+	hub.deliver(m)
 }
 
-func (hub *Hub) RegisterClient(conn *websocket.Conn, streamerID int) {
-	hub.registrationC <- RegistrationRequest{
-		Conn:       conn,
-		StreamerID: streamerID,
+// deliver hands m published by any instance to the hub goroutine.
+func (hub *Hub) deliver(m BackendMessage) {
+	switch m.Type {
+	case backendDonation:
+		if m.Donation == nil {
+			return
+		}
+		// StreamerID of the donation is not encoded, it travels with the message
+		d := *m.Donation
+		d.StreamerID = m.StreamerID
+		select {
+		case hub.donationsC <- d:
+		case <-hub.done:
+		}
+	case backendAck:
+		select {
+		case hub.ackC <- ackRequest{streamerID: m.StreamerID, seq: m.Seq}:
+		case <-hub.done:
+		}
+	case backendControl:
+		if m.Command == nil {
+			return
+		}
+		select {
+		case hub.controlC <- controlRequest{streamerID: m.StreamerID, command: *m.Command}:
+		case <-hub.done:
+		}
+	case backendRetract:
+		select {
+		case hub.retractC <- ackRequest{streamerID: m.StreamerID, seq: m.Seq}:
+		case <-hub.done:
+		}
+	case backendResync:
+		select {
+		case hub.resyncC <- struct{}{}:
+		case <-hub.done:
+		}
 	}
 }
 
-func (hub *Hub) Run() {
+// Run serves the hub until ctx is cancelled, then closes every connection.
+func (hub *Hub) Run(ctx context.Context) {
+	if hub.backend != nil {
+		go func() {
+			for {
+				err := hub.backend.Listen(ctx, hub.deliver)
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("hub backend stopped listening, restarting. Error: %v", err)
+				hub.deliver(BackendMessage{Type: backendResync})
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
 	for {
 		select {
-		case rr := <-hub.registrationC:
-			hub.clients[rr.StreamerID] = rr.Conn
-			hub.connClientMap[rr.Conn] = rr.StreamerID
+		case c := <-hub.registrationC:
+			hub.addClient(c)
+		case c := <-hub.unregisterC:
+			hub.removeClient(c)
 		case d := <-hub.donationsC:
-			hub.sendDonation(d)
+			hub.enqueue(d)
+		case a := <-hub.ackC:
+			hub.ack(a)
+		case a := <-hub.timeoutC:
+			log.Printf("alert was not acknowledged in time. StreamerID: %d, Seq: %d", a.streamerID, a.seq)
+			hub.ack(a)
+		case cr := <-hub.controlC:
+			hub.control(cr)
+		case r := <-hub.retractC:
+			hub.retract(r)
+		case <-hub.resyncC:
+			hub.resync()
+		case <-ctx.Done():
+			close(hub.done)
+			for _, clients := range hub.clients {
+				for c := range clients {
+					hub.removeClient(c)
+				}
+			}
+			return
 		}
 	}
 }
 
-func (hub *Hub) Donate(donation DonationEvent) {
-	hub.donationsC <- donation
+func (hub *Hub) addClient(c *Client) {
+	clients, ok := hub.clients[c.StreamerID]
+	if !ok {
+		clients = map[*Client]struct{}{}
+		hub.clients[c.StreamerID] = clients
+	}
+	clients[c] = struct{}{}
+
+	q, ok := hub.queues[c.StreamerID]
+	if !ok {
+		pending, err := hub.store.PendingAlerts(c.StreamerID)
+		if err != nil {
+			log.Printf("error loading pending alerts. StreamerID: %d, Error: %v", c.StreamerID, err)
+		}
+		q = newAlertQueue(pending)
+		hub.queues[c.StreamerID] = q
+	}
+
+	for _, seq := range q.ackUpTo(c.lastSeq) {
+		hub.persistAck(c.StreamerID, seq)
+	}
+
+	hub.sendTo(c, MessageState, hub.states[c.StreamerID])
+
+	// the new overlay joins the alert that is already on screen
+	if q.current != nil {
+		hub.sendTo(c, MessageAlert, *q.current)
+		return
+	}
+	hub.sendNext(c.StreamerID)
+}
+
+// enqueue adds d to the streamer's queue. Alerts of streamers without
+// an overlay are skipped, they are loaded from the store on connect.
+func (hub *Hub) enqueue(d DonationEvent) {
+	q, ok := hub.queues[d.StreamerID]
+	if !ok {
+		return
+	}
+
+	if q.push(d) {
+		hub.sendNext(d.StreamerID)
+	}
+}
+
+// resync reloads pending alerts of every connected streamer,
+// picking up alerts whose messages were lost by the backend.
+func (hub *Hub) resync() {
+	for streamerID, q := range hub.queues {
+		pending, err := hub.store.PendingAlerts(streamerID)
+		if err != nil {
+			log.Printf("error loading pending alerts. StreamerID: %d, Error: %v", streamerID, err)
+			continue
+		}
+		for _, d := range pending {
+			q.push(d)
+		}
+		hub.sendNext(streamerID)
+	}
+}
+
+func (hub *Hub) ack(a ackRequest) {
+	q, ok := hub.queues[a.streamerID]
+	if !ok || !q.ack(a.seq) {
+		return
+	}
+
+	hub.persistAck(a.streamerID, a.seq)
+	for c := range hub.clients[a.streamerID] {
+		hub.sendFrame(c, Frame{Type: FrameAcked, Seq: a.seq})
+	}
+	hub.sendNext(a.streamerID)
+}
+
+// retract removes the alert from the queue. Overlays are told even if the alert
+// is not on screen, so they can drop it from lists of recent donations.
+func (hub *Hub) retract(r ackRequest) {
+	hub.broadcast(r.streamerID, MessageRetract, AckPayload{Seq: r.seq})
+
+	q, ok := hub.queues[r.streamerID]
+	if ok && q.remove(r.seq) {
+		hub.sendNext(r.streamerID)
+	}
+}
+
+func (hub *Hub) control(cr controlRequest) {
+	state := hub.states[cr.streamerID]
+	q, hasQueue := hub.queues[cr.streamerID]
+
+	switch cr.command.Type {
+	case CommandSkip:
+		if !hasQueue || q.current == nil {
+			return
+		}
+		seq := q.current.Seq
+		hub.broadcast(cr.streamerID, MessageSkip, AckPayload{Seq: seq})
+		hub.ack(ackRequest{streamerID: cr.streamerID, seq: seq})
+		return
+	case CommandReplay:
+		if !hasQueue {
+			return
+		}
+		alerts, err := hub.store.RecentAlerts(cr.streamerID, cr.command.Count)
+		if err != nil {
+			log.Printf("error loading recent alerts. StreamerID: %d, Error: %v", cr.streamerID, err)
+			return
+		}
+		for i := range alerts {
+			alerts[i].Replay = true
+		}
+		q.replay(alerts)
+		hub.sendNext(cr.streamerID)
+		return
+	case CommandPause:
+		state.Paused = true
+		hub.broadcast(cr.streamerID, MessagePause, nil)
+	case CommandResume:
+		state.Paused = false
+		hub.broadcast(cr.streamerID, MessageResume, nil)
+	case CommandMute:
+		state.Muted = true
+		hub.broadcast(cr.streamerID, MessageMute, nil)
+	case CommandUnmute:
+		state.Muted = false
+		hub.broadcast(cr.streamerID, MessageUnmute, nil)
+	}
+
+	hub.states[cr.streamerID] = state
+	if hasQueue {
+		hub.sendNext(cr.streamerID)
+	}
+}
+
+func (hub *Hub) persistAck(streamerID int, seq int64) {
+	if err := hub.store.AckAlert(streamerID, seq); err != nil {
+		log.Printf("error saving alert ack. StreamerID: %d, Seq: %d, Error: %v", streamerID, seq, err)
+	}
 }
 
-func (hub *Hub) sendDonation(donation DonationEvent) {
-	conn, ok := hub.clients[donation.StreamerID]
+// sendNext shows the next alert if nothing is on screen and the queue is not paused.
+func (hub *Hub) sendNext(streamerID int) {
+	if hub.states[streamerID].Paused {
+		return
+	}
+
+	q := hub.queues[streamerID]
+	d, ok := q.next()
 	if !ok {
 		return
 	}
 
-	err := conn.WriteJSON(donation)
+	q.timer = time.AfterFunc(hub.ackTimeout, func() {
+		select {
+		case hub.timeoutC <- ackRequest{streamerID: streamerID, seq: d.Seq}:
+		case <-hub.done:
+		}
+	})
+
+	hub.broadcast(streamerID, MessageAlert, d)
+}
+
+func (hub *Hub) broadcast(streamerID int, messageType string, payload any) {
+	for c := range hub.clients[streamerID] {
+		hub.sendTo(c, messageType, payload)
+	}
+}
+
+func (hub *Hub) sendTo(c *Client, messageType string, payload any) {
+	data, err := encodeMessage(messageType, payload)
 	if err != nil {
-		log.Printf("can't send message through websocket. StreamerID: %d, Error: %v", donation.StreamerID, err)
+		log.Printf("can't marshal message. StreamerID: %d, Type: %s, Error: %v", c.StreamerID, messageType, err)
 		return
 	}
+
+	frame := Frame{Type: messageType, Data: data}
+	if d, ok := payload.(DonationEvent); ok {
+		frame.Seq = d.Seq
+	}
+	hub.sendFrame(c, frame)
+}
+
+func (hub *Hub) sendFrame(c *Client, frame Frame) {
+	select {
+	case c.send <- frame:
+	default:
+		log.Printf("overlay is not reading, dropping connection. StreamerID: %d", c.StreamerID)
+		hub.removeClient(c)
+	}
+}
+
+// removeClient forgets c and stops its writer, leaving the streamer's other connections intact.
+// The queue of a streamer without overlays is dropped, it is reloaded from the store on connect.
+func (hub *Hub) removeClient(c *Client) {
+	clients, ok := hub.clients[c.StreamerID]
+	if !ok {
+		return
+	}
+	if _, ok := clients[c]; !ok {
+		return
+	}
+
+	delete(clients, c)
+	if len(clients) == 0 {
+		delete(hub.clients, c.StreamerID)
+		if q, ok := hub.queues[c.StreamerID]; ok {
+			q.stopTimer()
+			delete(hub.queues, c.StreamerID)
+		}
+	}
+	close(c.send)
 }
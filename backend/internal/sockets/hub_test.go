@@ -0,0 +1,488 @@
+//go:build unit
+// +build unit
+
+package sockets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/gorilla/websocket"
+)
+
+type storeMock struct {
+	mu      sync.Mutex
+	pending map[int][]DonationEvent
+	acked   []int64
+}
+
+func (sm *storeMock) PendingAlerts(streamerID int) ([]DonationEvent, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.pending[streamerID], nil
+}
+
+func (sm *storeMock) AckAlert(streamerID int, seq int64) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.acked = append(sm.acked, seq)
+	return nil
+}
+
+func (sm *storeMock) RecentAlerts(streamerID int, limit int) ([]DonationEvent, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	alerts := sm.pending[streamerID]
+	if len(alerts) > limit {
+		alerts = alerts[len(alerts)-limit:]
+	}
+	return alerts, nil
+}
+
+func (sm *storeMock) ackedSeqs() []int64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return append([]int64{}, sm.acked...)
+}
+
+func startHub(t *testing.T, hub *Hub) (*httptest.Server, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(stopped)
+	}()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamerID, _ := strconv.Atoi(r.URL.Query().Get("streamer"))
+		lastSeq, _ := strconv.ParseInt(r.URL.Query().Get("lastSeq"), 10, 64)
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		hub.RegisterClient(c, streamerID, lastSeq)
+	}))
+	return server, func() {
+		server.Close()
+		cancel()
+		<-stopped
+	}
+}
+
+// overlay reads messages in the background, a timed out websocket read can't be retried.
+type overlay struct {
+	*websocket.Conn
+	messages chan Message
+	state    StatePayload
+}
+
+func dial(t *testing.T, server *httptest.Server, streamerID int, query string) *overlay {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?streamer=" + strconv.Itoa(streamerID) + query
+	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+
+	o := &overlay{Conn: c, messages: make(chan Message, 16)}
+	go func() {
+		defer close(o.messages)
+		for {
+			var m Message
+			if err := c.ReadJSON(&m); err != nil {
+				return
+			}
+			o.messages <- m
+		}
+	}()
+
+	// every overlay is told the current state first
+	m := expectMessage(t, o, MessageState)
+	json.Unmarshal(m.Payload, &o.state)
+	return o
+}
+
+func (o *overlay) ack(seq int64) {
+	payload, _ := json.Marshal(AckPayload{Seq: seq})
+	o.WriteJSON(Message{Version: ProtocolVersion, Type: MessageAck, Payload: payload})
+}
+
+func expectMessage(t *testing.T, o *overlay, messageType string) Message {
+	t.Helper()
+	select {
+	case m, ok := <-o.messages:
+		if !ok {
+			t.Fatalf("expected %s message, connection is closed", messageType)
+		}
+		if m.Version != ProtocolVersion || m.Type != messageType {
+			t.Fatalf("expected %s message, got %+v", messageType, m)
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatalf("expected %s message, got nothing", messageType)
+	}
+	return Message{}
+}
+
+func expectAlert(t *testing.T, o *overlay, seq int64) DonationEvent {
+	t.Helper()
+	var d DonationEvent
+	m := expectMessage(t, o, MessageAlert)
+	if err := json.Unmarshal(m.Payload, &d); err != nil {
+		t.Fatalf("malformed alert: %v", err)
+	}
+	if d.Seq != seq {
+		t.Fatalf("expected alert %d, got %d", seq, d.Seq)
+	}
+	return d
+}
+
+func expectNothing(t *testing.T, o *overlay) {
+	t.Helper()
+	select {
+	case m, ok := <-o.messages:
+		if ok {
+			t.Fatalf("expected no message, got %+v", m)
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNewDonationEvent(t *testing.T) {
+	cases := []struct {
+		amount   int64
+		currency string
+		locale   string
+		display  string
+	}{
+		{499, "USD", "en-US", "$ 4.99"},
+		{500, "JPY", "en-US", "¥ 500"},
+		{123450, "EUR", "de-DE", "€ 1.234,50"},
+	}
+
+	for _, tc := range cases {
+		d := NewDonationEvent(donation.Donation{Amount: tc.amount, Currency: tc.currency}, tc.locale)
+		if d.Amount != tc.amount || d.Currency != tc.currency || d.Display != tc.display {
+			t.Errorf("expected %d %s shown as %q, got %d %s shown as %q", tc.amount, tc.currency, tc.display, d.Amount, d.Currency, d.Display)
+		}
+	}
+
+	// the alert shows what the streamer receives apart from what the donor paid
+	d := NewDonationEvent(donation.Donation{Amount: 545, Fee: 46, NetAmount: 499, FeesCovered: true, Currency: "USD"}, "en-US")
+	if d.Display != "$ 5.45" || d.Net != 499 || d.NetDisplay != "$ 4.99" || !d.FeesCovered {
+		t.Errorf("expected $ 5.45 paid and $ 4.99 received with fees covered, got %+v", d)
+	}
+}
+
+func TestHubBroadcast(t *testing.T) {
+	hub := CreateNew(&storeMock{}, nil)
+	server, stop := startHub(t, &hub)
+	defer stop()
+
+	obs := dial(t, server, 1, "")
+	defer obs.Close()
+	preview := dial(t, server, 1, "")
+	defer preview.Close()
+	other := dial(t, server, 2, "")
+	defer other.Close()
+
+	hub.Donate(DonationEvent{Name: "donor", Text: "hi", Amount: 5, Seq: 1, StreamerID: 1})
+
+	expectAlert(t, obs, 1)
+	expectAlert(t, preview, 1)
+	expectNothing(t, other)
+}
+
+func TestHubQueue(t *testing.T) {
+	store := &storeMock{pending: map[int][]DonationEvent{
+		1: {{Seq: 2, StreamerID: 1}, {Seq: 1, StreamerID: 1}},
+	}}
+	hub := CreateNew(store, nil)
+	server, stop := startHub(t, &hub)
+	defer stop()
+
+	// Test case 1: pending alerts are loaded and shown one at a time in order
+	obs := dial(t, server, 1, "")
+	defer obs.Close()
+	expectAlert(t, obs, 1)
+	expectNothing(t, obs)
+
+	// Test case 2: redelivered alerts and stale acks are ignored
+	hub.Donate(DonationEvent{Seq: 2, StreamerID: 1})
+	hub.Donate(DonationEvent{Seq: 3, StreamerID: 1})
+	obs.ack(2)
+	expectNothing(t, obs)
+
+	// Test case 3: ack shows the next alert
+	obs.ack(1)
+	expectAlert(t, obs, 2)
+	obs.ack(2)
+	expectAlert(t, obs, 3)
+	obs.ack(3)
+	expectNothing(t, obs)
+
+	acked := store.ackedSeqs()
+	if len(acked) != 3 || acked[0] != 1 || acked[1] != 2 || acked[2] != 3 {
+		t.Fatalf("expected acks [1 2 3], got %v", acked)
+	}
+
+	// Test case 4: an acknowledged alert is not shown again
+	hub.Donate(DonationEvent{Seq: 3, StreamerID: 1})
+	expectNothing(t, obs)
+}
+
+func TestHubRetract(t *testing.T) {
+	store := &storeMock{pending: map[int][]DonationEvent{
+		1: {{Seq: 1, StreamerID: 1}, {Seq: 2, StreamerID: 1}, {Seq: 3, StreamerID: 1}},
+	}}
+	hub := CreateNew(store, nil)
+	server, stop := startHub(t, &hub)
+	defer stop()
+
+	obs := dial(t, server, 1, "")
+	defer obs.Close()
+	expectAlert(t, obs, 1)
+
+	// Test case 1: a queued alert is dropped before it is shown
+	hub.Retract(1, 2)
+	expectMessage(t, obs, MessageRetract)
+	expectNothing(t, obs)
+
+	// Test case 2: retracting the alert on screen shows the next one
+	hub.Retract(1, 1)
+	expectMessage(t, obs, MessageRetract)
+	expectAlert(t, obs, 3)
+
+	// Test case 3: a retracted alert is not queued again
+	hub.Donate(DonationEvent{Seq: 2, StreamerID: 1})
+	obs.ack(3)
+	expectNothing(t, obs)
+}
+
+func TestHubAckTimeout(t *testing.T) {
+	hub := CreateNew(&storeMock{}, nil)
+	hub.ackTimeout = 50 * time.Millisecond
+	server, stop := startHub(t, &hub)
+	defer stop()
+
+	obs := dial(t, server, 1, "")
+	defer obs.Close()
+	hub.Donate(DonationEvent{Seq: 1, StreamerID: 1})
+	hub.Donate(DonationEvent{Seq: 2, StreamerID: 1})
+
+	expectAlert(t, obs, 1)
+	expectAlert(t, obs, 2)
+}
+
+func TestHubLastSeq(t *testing.T) {
+	store := &storeMock{pending: map[int][]DonationEvent{
+		1: {{Seq: 1, StreamerID: 1}, {Seq: 2, StreamerID: 1}, {Seq: 3, StreamerID: 1}},
+	}}
+	hub := CreateNew(store, nil)
+	server, stop := startHub(t, &hub)
+	defer stop()
+
+	obs := dial(t, server, 1, "&lastSeq=2")
+	defer obs.Close()
+	expectAlert(t, obs, 3)
+
+	if acked := store.ackedSeqs(); len(acked) != 2 {
+		t.Fatalf("expected alerts up to lastSeq to be acknowledged, got %v", acked)
+	}
+}
+
+func TestHubUnregister(t *testing.T) {
+	hub := CreateNew(&storeMock{}, nil)
+	server, stop := startHub(t, &hub)
+
+	obs := dial(t, server, 1, "")
+	defer obs.Close()
+	preview := dial(t, server, 1, "")
+
+	// closing one overlay removes only that connection
+	preview.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	preview.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	hub.Donate(DonationEvent{Seq: 1, StreamerID: 1})
+	expectAlert(t, obs, 1)
+
+	stop()
+	if len(hub.clients) != 0 {
+		t.Fatalf("expected no clients after shutdown, got %d", len(hub.clients))
+	}
+}
+
+func TestHubControl(t *testing.T) {
+	store := &storeMock{pending: map[int][]DonationEvent{
+		1: {{Seq: 1, StreamerID: 1}, {Seq: 2, StreamerID: 1}},
+	}}
+	hub := CreateNew(store, nil)
+	server, stop := startHub(t, &hub)
+	defer stop()
+
+	obs := dial(t, server, 1, "")
+	defer obs.Close()
+	expectAlert(t, obs, 1)
+
+	// Test case 1: invalid commands are rejected
+	if err := hub.Control(1, Command{Type: "explode"}); err != ErrInvalidCommand {
+		t.Fatalf("expected ErrInvalidCommand, got %v", err)
+	}
+	if err := hub.Control(1, Command{Type: CommandReplay}); err != ErrInvalidCommand {
+		t.Fatalf("expected ErrInvalidCommand for replay without count, got %v", err)
+	}
+
+	// Test case 2: pause holds the queue
+	hub.Control(1, Command{Type: CommandPause})
+	expectMessage(t, obs, MessagePause)
+	obs.ack(1)
+	expectNothing(t, obs)
+
+	// Test case 3: a new overlay gets the paused state
+	preview := dial(t, server, 1, "")
+	defer preview.Close()
+	if !preview.state.Paused {
+		t.Fatalf("expected new overlay to be told the queue is paused")
+	}
+	if !preview.state.Paused {
+		t.Fatalf("expected new overlay to be told the queue is paused")
+	}
+
+	// Test case 4: resume continues with the next alert
+	hub.Control(1, Command{Type: CommandResume})
+	expectMessage(t, obs, MessageResume)
+	expectAlert(t, obs, 2)
+
+	// Test case 5: skip finishes the current alert
+	hub.Control(1, Command{Type: CommandSkip})
+	expectMessage(t, obs, MessageSkip)
+	expectNothing(t, obs)
+
+	// Test case 6: replay shows recent alerts again
+	hub.Control(1, Command{Type: CommandReplay, Count: 1})
+	if d := expectAlert(t, obs, 2); !d.Replay {
+		t.Fatalf("expected replayed alert to be marked")
+	}
+
+	// Test case 7: mute is forwarded to overlays
+	hub.Control(1, Command{Type: CommandMute})
+	expectMessage(t, obs, MessageMute)
+}
+
+// sharedBackend connects hubs as if they were running on different instances.
+type sharedBackend struct {
+	mu        sync.Mutex
+	listeners []func(BackendMessage)
+}
+
+func (sb *sharedBackend) Publish(m BackendMessage) error {
+	sb.mu.Lock()
+	listeners := append([]func(BackendMessage){}, sb.listeners...)
+	sb.mu.Unlock()
+	for _, deliver := range listeners {
+		deliver(m)
+	}
+	return nil
+}
+
+func (sb *sharedBackend) Listen(ctx context.Context, deliver func(BackendMessage)) error {
+	sb.mu.Lock()
+	sb.listeners = append(sb.listeners, deliver)
+	sb.mu.Unlock()
+	<-ctx.Done()
+	return nil
+}
+
+func TestHubBackend(t *testing.T) {
+	backend := &sharedBackend{}
+	instanceA := CreateNew(&storeMock{}, backend)
+	serverA, stopA := startHub(t, &instanceA)
+	defer stopA()
+	instanceB := CreateNew(&storeMock{}, backend)
+	serverB, stopB := startHub(t, &instanceB)
+	defer stopB()
+
+	obs := dial(t, serverA, 1, "")
+	defer obs.Close()
+	preview := dial(t, serverB, 1, "")
+	defer preview.Close()
+
+	// Test case 1: an alert published on one instance reaches overlays on every instance
+	instanceB.Donate(DonationEvent{Seq: 1, StreamerID: 1})
+	instanceB.Donate(DonationEvent{Seq: 2, StreamerID: 1})
+	expectAlert(t, obs, 1)
+	expectAlert(t, preview, 1)
+
+	// Test case 2: an ack on one instance advances the queues on every instance
+	obs.ack(1)
+	expectAlert(t, obs, 2)
+	expectAlert(t, preview, 2)
+
+	// Test case 3: control commands are shared too
+	instanceA.Control(1, Command{Type: CommandPause})
+	expectMessage(t, obs, MessagePause)
+	expectMessage(t, preview, MessagePause)
+}
+
+// jsonBackend encodes messages the way PGBackend does.
+type jsonBackend struct {
+	sharedBackend
+}
+
+func (jb *jsonBackend) Publish(m BackendMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var decoded BackendMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	return jb.sharedBackend.Publish(decoded)
+}
+
+func TestHubBackendEncoded(t *testing.T) {
+	backend := &jsonBackend{}
+	instanceA := CreateNew(&storeMock{}, backend)
+	serverA, stopA := startHub(t, &instanceA)
+	defer stopA()
+	instanceB := CreateNew(&storeMock{}, backend)
+	_, stopB := startHub(t, &instanceB)
+	defer stopB()
+
+	obs := dial(t, serverA, 42, "")
+	defer obs.Close()
+
+	// an alert that went through the encoded backend still reaches the streamer's overlay
+	instanceB.Donate(DonationEvent{Seq: 1, StreamerID: 42})
+	expectAlert(t, obs, 1)
+}
+
+func TestBackendMessageSize(t *testing.T) {
+	// the longest name and message a donor can send, escaped in JSON as \u0000
+	d := DonationEvent{
+		Name:       strings.Repeat("\x00", 255),
+		Text:       strings.Repeat("\x00", 500),
+		Display:    "$ 999,999,999.99",
+		NetDisplay: "$ 999,999,999.99",
+		Currency:   "USD",
+		StreamerID: 1,
+	}
+	payload, err := json.Marshal(BackendMessage{Type: backendDonation, StreamerID: 1, Donation: &d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) > maxNotifyPayload {
+		t.Errorf("expected the alert to fit into a notification, got %d bytes", len(payload))
+	}
+}
@@ -0,0 +1,99 @@
+package sockets
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ProtocolVersion is the version of the overlay message envelope.
+// Version 2 sends alert amounts in minor units with a formatted display string.
+const ProtocolVersion = 2
+
+// minProtocolVersion is the oldest version accepted from overlays,
+// messages sent by overlays didn't change since.
+const minProtocolVersion = 1
+
+// Message types sent to overlays.
+const (
+	MessageAlert  = "alert"
+	MessageState  = "state"
+	MessageSkip   = "skip"
+	MessagePause  = "pause"
+	MessageResume = "resume"
+	MessageMute   = "mute"
+	MessageUnmute = "unmute"
+	// MessageRetract takes a refunded or disputed alert off the overlay.
+	MessageRetract = "retract"
+)
+
+// Message types sent by overlays.
+const (
+	MessageAck  = "ack"
+	MessageDone = "done"
+)
+
+// Control commands accepted from the moderator dashboard.
+const (
+	CommandSkip   = "skip"
+	CommandReplay = "replay"
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	CommandMute   = "mute"
+	CommandUnmute = "unmute"
+)
+
+// maxReplay caps how many alerts a single replay command shows again.
+const maxReplay = 20
+
+// Message is the envelope of every message exchanged with overlays, in both directions.
+type Message struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// AckPayload is sent by the overlay when it has finished showing an alert.
+type AckPayload struct {
+	Seq int64 `json:"seq"`
+}
+
+// StatePayload tells an overlay how to behave when it connects.
+type StatePayload struct {
+	Paused bool `json:"paused"`
+	Muted  bool `json:"muted"`
+}
+
+// Command is a control command for all overlays of a streamer.
+type Command struct {
+	Type string `json:"type"`
+	// Count is the number of recent alerts to show again, used by replay.
+	Count int `json:"count,omitempty"`
+}
+
+var ErrInvalidCommand = errors.New("invalid command")
+
+func (c Command) Validate() error {
+	switch c.Type {
+	case CommandSkip, CommandPause, CommandResume, CommandMute, CommandUnmute:
+		return nil
+	case CommandReplay:
+		if c.Count < 1 || c.Count > maxReplay {
+			return ErrInvalidCommand
+		}
+		return nil
+	default:
+		return ErrInvalidCommand
+	}
+}
+
+func encodeMessage(messageType string, payload any) ([]byte, error) {
+	m := Message{Version: ProtocolVersion, Type: messageType}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		m.Payload = data
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,74 @@
+package sockets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	pgChannel = "overlay_events"
+	// postgres rejects notification payloads of 8000 bytes and more
+	maxNotifyPayload = 7999
+)
+
+var ErrPayloadTooLarge = errors.New("notification payload is too large")
+
+// PGBackend shares hub traffic between instances with Postgres LISTEN/NOTIFY.
+type PGBackend struct {
+	DB *sqlx.DB
+	// ConnectionString is used for the dedicated listener connection.
+	ConnectionString string
+}
+
+func (b PGBackend) Publish(m BackendMessage) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		return ErrPayloadTooLarge
+	}
+
+	_, err = b.DB.Exec("SELECT pg_notify($1, $2)", pgChannel, string(payload))
+	return err
+}
+
+func (b PGBackend) Listen(ctx context.Context, deliver func(BackendMessage)) error {
+	listener := pq.NewListener(b.ConnectionString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("overlay listener connection error: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(pgChannel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			// nil is sent after the connection was re-established,
+			// notifications sent in the meantime are lost
+			if n == nil {
+				deliver(BackendMessage{Type: backendResync})
+				continue
+			}
+
+			var m BackendMessage
+			if err := json.Unmarshal([]byte(n.Extra), &m); err != nil {
+				log.Printf("malformed overlay notification: %v", err)
+				continue
+			}
+			deliver(m)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package sockets
+
+import (
+	"sort"
+	"time"
+)
+
+// alertQueue holds a streamer's alerts in the order they are shown.
+// Only one alert is on screen at a time; the next one is sent after the
+// overlay acknowledges the current one or the ack timeout fires.
+type alertQueue struct {
+	pending []DonationEvent
+	// replays are already shown alerts requested again, they go before pending ones.
+	replays []DonationEvent
+	current *DonationEvent
+	timer   *time.Timer
+	// acked remembers shown alerts, so redelivered events are not shown twice.
+	acked map[int64]struct{}
+}
+
+func newAlertQueue(pending []DonationEvent) *alertQueue {
+	q := &alertQueue{acked: map[int64]struct{}{}}
+	for _, d := range pending {
+		q.push(d)
+	}
+	return q
+}
+
+// push adds d in sequence order. It reports false if d is already queued or shown.
+func (q *alertQueue) push(d DonationEvent) bool {
+	if _, ok := q.acked[d.Seq]; ok {
+		return false
+	}
+	if q.current != nil && q.current.Seq == d.Seq {
+		return false
+	}
+
+	i := sort.Search(len(q.pending), func(i int) bool { return q.pending[i].Seq >= d.Seq })
+	if i < len(q.pending) && q.pending[i].Seq == d.Seq {
+		return false
+	}
+
+	q.pending = append(q.pending, DonationEvent{})
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = d
+	return true
+}
+
+// replay schedules shown alerts to be shown again.
+func (q *alertQueue) replay(alerts []DonationEvent) {
+	q.replays = append(q.replays, alerts...)
+}
+
+// next makes the first replayed or pending alert current.
+func (q *alertQueue) next() (DonationEvent, bool) {
+	if q.current != nil {
+		return DonationEvent{}, false
+	}
+
+	var d DonationEvent
+	switch {
+	case len(q.replays) > 0:
+		d = q.replays[0]
+		q.replays = q.replays[1:]
+	case len(q.pending) > 0:
+		d = q.pending[0]
+		q.pending = q.pending[1:]
+	default:
+		return DonationEvent{}, false
+	}
+
+	q.current = &d
+	return d, true
+}
+
+// ack finishes the current alert if its sequence number is seq.
+func (q *alertQueue) ack(seq int64) bool {
+	if q.current == nil || q.current.Seq != seq {
+		return false
+	}
+
+	q.acked[seq] = struct{}{}
+	q.current = nil
+	q.stopTimer()
+	return true
+}
+
+// ackUpTo drops pending alerts the overlay reports as already shown.
+func (q *alertQueue) ackUpTo(seq int64) []int64 {
+	var seqs []int64
+	for len(q.pending) > 0 && q.pending[0].Seq <= seq {
+		q.acked[q.pending[0].Seq] = struct{}{}
+		seqs = append(seqs, q.pending[0].Seq)
+		q.pending = q.pending[1:]
+	}
+	return seqs
+}
+
+// remove drops the alert seq wherever it is queued, so it is never shown.
+// It reports true if the alert was on screen.
+func (q *alertQueue) remove(seq int64) bool {
+	q.acked[seq] = struct{}{}
+	q.pending = without(q.pending, seq)
+	q.replays = without(q.replays, seq)
+
+	if q.current == nil || q.current.Seq != seq {
+		return false
+	}
+	q.current = nil
+	q.stopTimer()
+	return true
+}
+
+func without(alerts []DonationEvent, seq int64) []DonationEvent {
+	res := alerts[:0]
+	for _, d := range alerts {
+		if d.Seq != seq {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+func (q *alertQueue) stopTimer() {
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+}
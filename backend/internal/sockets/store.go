@@ -0,0 +1,72 @@
+package sockets
+
+import (
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+)
+
+// pendingLimit caps how many unacknowledged alerts are loaded for a streamer.
+const pendingLimit = 100
+
+// AlertStore persists the alert queue, so pending alerts survive a restart.
+type AlertStore interface {
+	PendingAlerts(streamerID int) ([]DonationEvent, error)
+	AckAlert(streamerID int, seq int64) error
+	// RecentAlerts returns the streamer's last limit alerts, oldest first.
+	RecentAlerts(streamerID int, limit int) ([]DonationEvent, error)
+}
+
+// DonationAlertStore keeps the alert queue in the donations table.
+type DonationAlertStore struct {
+	Donations donation.DonationRepo
+	Streamers streamer.StreamerRepo
+}
+
+func (s DonationAlertStore) PendingAlerts(streamerID int) ([]DonationEvent, error) {
+	donations, err := s.Donations.GetPendingAlerts(streamerID, pendingLimit)
+	if err != nil {
+		return nil, err
+	}
+	return s.toDonationEvents(streamerID, donations)
+}
+
+func (s DonationAlertStore) RecentAlerts(streamerID int, limit int) ([]DonationEvent, error) {
+	donations, err := s.Donations.GetRecentAlerts(streamerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.toDonationEvents(streamerID, donations)
+}
+
+func (s DonationAlertStore) AckAlert(streamerID int, seq int64) error {
+	return s.Donations.AckAlert(streamerID, seq)
+}
+
+func (s DonationAlertStore) toDonationEvents(streamerID int, donations []donation.Donation) ([]DonationEvent, error) {
+	if len(donations) == 0 {
+		return nil, nil
+	}
+	locale, err := StreamerLocale(s.Streamers, streamerID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]DonationEvent, 0, len(donations))
+	for _, d := range donations {
+		res = append(res, NewDonationEvent(d, locale))
+	}
+	return res, nil
+}
+
+// StreamerLocale returns the locale alerts of the streamer are formatted in.
+func StreamerLocale(streamers streamer.StreamerRepo, streamerID int) (string, error) {
+	s, err := streamers.GetStreamerById(streamerID)
+	if err != nil {
+		return "", err
+	}
+	if s == nil || s.Locale == "" {
+		return money.DefaultLocale, nil
+	}
+	return s.Locale, nil
+}
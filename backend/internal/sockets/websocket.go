@@ -0,0 +1,106 @@
+package sockets
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+	// Send pings to peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum message size allowed from peer.
+	maxMessageSize = 4096
+)
+
+// wsClient serves a Client over a websocket connection.
+type wsClient struct {
+	*Client
+	conn *websocket.Conn
+}
+
+// RegisterClient adds conn to the streamer's overlays and starts serving it.
+// lastSeq is the last alert the overlay has shown; pending alerts up to it
+// are treated as acknowledged. The connection is closed and unregistered
+// when the peer goes away.
+func (hub *Hub) RegisterClient(conn *websocket.Conn, streamerID int, lastSeq int64) {
+	c, ok := hub.Subscribe(streamerID, lastSeq)
+	if !ok {
+		conn.Close()
+		return
+	}
+
+	wc := wsClient{Client: c, conn: conn}
+	go wc.writePump()
+	go wc.readPump()
+}
+
+// readPump reads messages from the connection until it fails,
+// then unregisters the client. Pong messages extend the read deadline,
+// so a peer that stops answering pings is dropped after pongWait.
+func (c wsClient) readPump() {
+	defer func() {
+		c.hub.UnregisterClient(c.Client)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+				log.Printf("websocket closed unexpectedly. StreamerID: %d, Error: %v", c.StreamerID, err)
+			}
+			return
+		}
+
+		if err := c.hub.HandleMessage(c.StreamerID, data); err != nil {
+			log.Printf("bad overlay message. StreamerID: %d, Error: %v", c.StreamerID, err)
+		}
+	}
+}
+
+// writePump writes queued messages and pings to the connection.
+// It exits when the hub closes the send channel or a write fails.
+func (c wsClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case frame, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			// overlays resume from the alert they have shown themselves
+			if frame.Type == FrameAcked {
+				continue
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, frame.Data); err != nil {
+				log.Printf("can't send message through websocket. StreamerID: %d, Error: %v", c.StreamerID, err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
+)
+
+const (
+	DefaultTTL       = time.Hour
+	defaultInterval  = 10 * time.Minute
+	defaultBatchSize = 100
+)
+
+// Sweeper cancels the payments of donations the donor walked away from
+// and marks the donations EXPIRED.
+type Sweeper struct {
+	Settler   settlement.Settler
+	Providers payments.Providers
+	// TTL is how long a donation may wait to be payed.
+	TTL       time.Duration
+	Interval  time.Duration
+	BatchSize int
+}
+
+func (s Sweeper) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.Sweep(time.Now())
+		if err != nil {
+			log.Printf("error sweeping donations: %v\n", err)
+		}
+		if expired > 0 {
+			log.Printf("expired abandoned donations. Count: %d\n", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires the donations created more than TTL before now that weren't payed
+// and returns how many were expired.
+func (s Sweeper) Sweep(now time.Time) (int, error) {
+	ttl, batchSize := s.TTL, s.BatchSize
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	expired := 0
+	afterID := 0
+	for {
+		donations, err := s.Settler.Donations.GetAbandoned(now.Add(-ttl), afterID, batchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, d := range donations {
+			// a donation that can't be expired is tried again on the next run,
+			// it doesn't hold up the ones after it
+			ok, err := s.expire(d)
+			if err != nil {
+				log.Printf("can't expire donation. DonationID: %d, Error: %v\n", d.ID, err)
+			}
+			if ok {
+				expired++
+			}
+			afterID = d.ID
+		}
+
+		if len(donations) < batchSize {
+			return expired, nil
+		}
+	}
+}
+
+func (s Sweeper) expire(d donation.Donation) (bool, error) {
+	provider, err := s.Providers.Get(d.Provider)
+	if err != nil {
+		log.Printf("can't expire donation. DonationID: %d, Error: %v\n", d.ID, err)
+		return false, nil
+	}
+
+	err = provider.CancelPayment(d.PaymentID)
+	if errors.Is(err, payments.ErrPaymentSettled) {
+		// the donor payed after all, settle the donation in case the webhook was lost
+		outcome, ok, err := provider.FetchOutcome(d.PaymentID)
+		if err != nil || !ok {
+			return false, err
+		}
+		_, err = s.Settler.Apply(outcome)
+		return false, err
+	}
+	// there's nothing to cancel for a payment the provider doesn't know
+	if err != nil && !errors.Is(err, payments.ErrPaymentNotFound) {
+		return false, err
+	}
+
+	return s.Settler.Apply(payments.Outcome{PaymentID: d.PaymentID, Status: donation.DonationStatusExpired})
+}
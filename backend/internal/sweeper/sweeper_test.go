@@ -0,0 +1,99 @@
+//go:build unit
+// +build unit
+
+package sweeper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/mismatch"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
+)
+
+func TestSweep(t *testing.T) {
+	now := time.Now()
+	donations := donation.NewDonationMock()
+	streamers := &streamer.StreamerMock{}
+	s := streamer.Streamer{TwitchName: "streamer"}
+	streamers.CreateStreamer(&s)
+	provider := &payments.ProviderMock{Outcomes: map[string]payments.Outcome{
+		"pay_abandoned": {PaymentID: "pay_abandoned"},
+		"pay_failed":    {PaymentID: "pay_failed"},
+		"pay_payed":     {PaymentID: "pay_payed", Status: donation.DonationStatusPayed, Amount: 500},
+		"pay_recent":    {PaymentID: "pay_recent"},
+		"pay_broken":    {PaymentID: "pay_broken"},
+	}, Errors: map[string]error{"pay_broken": errors.New("connection reset")}}
+
+	create := func(paymentID string, status string, age time.Duration) donation.Donation {
+		d := donation.Donation{
+			PaymentID:  paymentID,
+			Provider:   provider.Name(),
+			StreamerID: s.ID,
+			Amount:     500,
+			NetAmount:  500,
+			Currency:   "USD",
+			Status:     status,
+			CreatedAt:  now.Add(-age),
+		}
+		donations.Create(&d)
+		return d
+	}
+	abandoned := create("pay_abandoned", donation.DonationStatusCreated, 2*time.Hour)
+	broken := create("pay_broken", donation.DonationStatusCreated, 2*time.Hour)
+	failed := create("pay_failed", donation.DonationStatusFailed, 2*time.Hour)
+	payed := create("pay_payed", donation.DonationStatusCreated, 2*time.Hour)
+	unknown := create("pay_unknown", donation.DonationStatusCreated, 2*time.Hour)
+	recent := create("pay_recent", donation.DonationStatusCreated, time.Minute)
+
+	sw := Sweeper{
+		Settler: settlement.Settler{
+			Donations:  donations,
+			Streamers:  streamers,
+			Mismatches: &mismatch.MismatchMock{},
+			Rates:      money.StaticRates{Base: "USD"},
+			Source:     mismatch.SourceReconciler,
+		},
+		Providers: payments.NewProviders(provider),
+		TTL:       time.Hour,
+		BatchSize: 2,
+	}
+	expired, err := sw.Sweep(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case 1: unpayed donations older than TTL are expired
+	if expired != 3 {
+		t.Errorf("expected 3 expired donations, got %d", expired)
+	}
+	for _, tc := range []struct {
+		d      donation.Donation
+		status string
+	}{
+		{abandoned, donation.DonationStatusExpired},
+		{failed, donation.DonationStatusExpired},
+		// Test case 2: a donation payed before it was canceled is settled instead
+		{payed, donation.DonationStatusPayed},
+		// Test case 3: a payment unknown to the provider has nothing to cancel
+		{unknown, donation.DonationStatusExpired},
+		{recent, donation.DonationStatusCreated},
+		// Test case 4: a donation that can't be canceled is left for the next run
+		{broken, donation.DonationStatusCreated},
+	} {
+		d, _ := donations.GetDonation(tc.d.ID)
+		if d.Status != tc.status {
+			t.Errorf("expected %s to be %s, got %s", tc.d.PaymentID, tc.status, d.Status)
+		}
+	}
+
+	// Test case 5: only payments waiting for the donor are canceled
+	if len(provider.Canceled) != 2 {
+		t.Errorf("expected 2 canceled payments, got %v", provider.Canceled)
+	}
+}
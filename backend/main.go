@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -9,16 +11,34 @@ import (
 	"time"
 
 	"github.com/blindlobstar/donation-alarm/backend/internal/database"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/blocklist"
 	"github.com/blindlobstar/donation-alarm/backend/internal/database/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/mismatch"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/outbox"
 	"github.com/blindlobstar/donation-alarm/backend/internal/database/streamer"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/subscription"
+	"github.com/blindlobstar/donation-alarm/backend/internal/database/webhookevent"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/admin"
+	blocklistendpoint "github.com/blindlobstar/donation-alarm/backend/internal/endpoints/blocklist"
 	donationendpoint "github.com/blindlobstar/donation-alarm/backend/internal/endpoints/donation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/overlay"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/payouts"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/settings"
+	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/sse"
 	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/twitch_auth"
 	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/webhooks"
 	"github.com/blindlobstar/donation-alarm/backend/internal/endpoints/websockets"
 	"github.com/blindlobstar/donation-alarm/backend/internal/events"
 	channelevents "github.com/blindlobstar/donation-alarm/backend/internal/events/cevents"
 	"github.com/blindlobstar/donation-alarm/backend/internal/handlers"
+	"github.com/blindlobstar/donation-alarm/backend/internal/moderation"
+	"github.com/blindlobstar/donation-alarm/backend/internal/money"
+	"github.com/blindlobstar/donation-alarm/backend/internal/payments"
+	"github.com/blindlobstar/donation-alarm/backend/internal/reconciler"
+	"github.com/blindlobstar/donation-alarm/backend/internal/relay"
+	"github.com/blindlobstar/donation-alarm/backend/internal/settlement"
 	"github.com/blindlobstar/donation-alarm/backend/internal/sockets"
+	"github.com/blindlobstar/donation-alarm/backend/internal/sweeper"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/gorilla/websocket"
@@ -26,7 +46,6 @@ import (
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/nicklaw5/helix"
-	"github.com/stripe/stripe-go/v75"
 )
 
 func main() {
@@ -64,18 +83,143 @@ func main() {
 		CookieStore: sessions.NewCookieStore([]byte("super secret string that i'm about to change")),
 	}
 
-	stripe.Key = os.Getenv("STRIPE_API_KEY")
+	stripeFees := payments.StripeFees
+	if fees := os.Getenv("BACKEND__STRIPE_FEES"); fees != "" {
+		if err := json.Unmarshal([]byte(fees), &stripeFees); err != nil {
+			log.Fatalf("error parsing stripe fees: %v", err)
+		}
+	}
+	stripeProvider := payments.NewStripe(payments.StripeConfig{
+		Key:                  os.Getenv("STRIPE_API_KEY"),
+		WebhookSecret:        os.Getenv("BACKEND__STRIPE_SECRET"),
+		ConnectWebhookSecret: os.Getenv("BACKEND__STRIPE_CONNECT_SECRET"),
+		Fees:                 stripeFees,
+		SubscriptionProduct:  os.Getenv("BACKEND__STRIPE_SUBSCRIPTION_PRODUCT"),
+	})
+	paymentProviders := payments.NewProviders(
+		stripeProvider,
+	)
+	// static rates let the server run without an exchange rate service,
+	// with no file only same-currency donations are converted
+	rates := money.StaticRates{Base: money.DefaultCurrency}
+	if path := os.Getenv("BACKEND__EXCHANGE_RATES_FILE"); path != "" {
+		rates, err = money.LoadRates(path)
+		if err != nil {
+			log.Fatalf("error loading exchange rates: %v", err)
+		}
+	}
+	// payments the donor hasn't finished are canceled after an hour by default
+	paymentTTL := sweeper.DefaultTTL
+	if ttl := os.Getenv("BACKEND__PAYMENT_TTL"); ttl != "" {
+		if paymentTTL, err = time.ParseDuration(ttl); err != nil {
+			log.Fatalf("error parsing payment ttl: %v", err)
+		}
+	}
+	moderator := moderation.Moderator{Donations: donation.Repo{Repo: rep}}
 	de := donationendpoint.Donation{
-		DR: donation.Repo{Repo: rep},
-		SR: streamer.Repo{Repo: rep},
+		DR:         donation.Repo{Repo: rep},
+		SR:         streamer.Repo{Repo: rep},
+		SubR:       subscription.Repo{Repo: rep},
+		BR:         blocklist.Repo{Repo: rep},
+		Providers:  paymentProviders,
+		Rates:      rates,
+		PaymentTTL: paymentTTL,
+		Moderator:  moderator,
+		// temporary, until existing streamers have onboarded for payouts
+		PlatformHeld: os.Getenv("BACKEND__PLATFORM_HELD_DONATIONS") == "true",
+		// behind a reverse proxy every request comes from the proxy
+		TrustProxy: os.Getenv("BACKEND__TRUST_PROXY") == "true",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// with the postgres backend alerts reach overlays connected to any replica
+	var hubBackend sockets.Backend
+	if os.Getenv("BACKEND__HUB_BACKEND") == "postgres" {
+		hubBackend = sockets.PGBackend{
+			DB:               db,
+			ConnectionString: os.Getenv("BACKEND__CONNECTION_STRING"),
+		}
+	}
+	hub := sockets.CreateNew(sockets.DonationAlertStore{
+		Donations: donation.Repo{Repo: rep},
+		Streamers: streamer.Repo{Repo: rep},
+	}, hubBackend)
+	go hub.Run(ctx)
+
+	eventBus := channelevents.New(make(chan events.Event, 64))
+	if err := eventBus.RegisterHandler(handlers.NewDonationPayedHandler(&hub, donation.Repo{Repo: rep}, streamer.Repo{Repo: rep}), events.DonationPayedName); err != nil {
+		log.Fatalf("error registering event handler: %v", err)
+	}
+	if err := eventBus.RegisterHandler(handlers.NewDonationApprovedHandler(&hub, donation.Repo{Repo: rep}, streamer.Repo{Repo: rep}), events.DonationApprovedName); err != nil {
+		log.Fatalf("error registering event handler: %v", err)
+	}
+	if err := eventBus.RegisterHandler(handlers.NewDonationRetractedHandler(&hub), events.DonationRetractedName); err != nil {
+		log.Fatalf("error registering event handler: %v", err)
+	}
+	busDone := make(chan struct{})
+	go func() {
+		if err := eventBus.Run(ctx); err != nil {
+			log.Printf("error running event bus: %v\n", err)
+		}
+		close(busDone)
+	}()
+
+	outboxRelay := relay.Relay{
+		Outbox:       outbox.Repo{Repo: rep},
+		EventEmitter: &eventBus,
+	}
+	relayDone := make(chan struct{})
+	go func() {
+		outboxRelay.Run(ctx)
+		close(relayDone)
+	}()
+
+	// donations whose webhooks were lost are settled once a day by default
+	var reconcileInterval time.Duration
+	if interval := os.Getenv("BACKEND__RECONCILE_INTERVAL"); interval != "" {
+		if reconcileInterval, err = time.ParseDuration(interval); err != nil {
+			log.Fatalf("error parsing reconcile interval: %v", err)
+		}
+	}
+	// payments are settled by webhooks, the reconciler and the sweeper
+	settler := settlement.Settler{
+		Donations:     donation.Repo{Repo: rep},
+		Streamers:     streamer.Repo{Repo: rep},
+		Mismatches:    mismatch.Repo{Repo: rep},
+		Rates:         rates,
+		Blocklist:     blocklist.Repo{Repo: rep},
+		Subscriptions: subscription.Repo{Repo: rep},
+		Providers:     paymentProviders,
 	}
+	paymentReconciler := reconciler.Reconciler{
+		Settler:   settler.WithSource(mismatch.SourceReconciler),
+		Providers: paymentProviders,
+		Interval:  reconcileInterval,
+	}
+	reconcilerDone := make(chan struct{})
+	go func() {
+		paymentReconciler.Run(ctx)
+		close(reconcilerDone)
+	}()
 
-	hub := sockets.CreateNew()
-	go hub.Run()
+	donationSweeper := sweeper.Sweeper{
+		Settler:   settler.WithSource(mismatch.SourceSweeper),
+		Providers: paymentProviders,
+		TTL:       paymentTTL,
+	}
+	sweeperDone := make(chan struct{})
+	go func() {
+		donationSweeper.Run(ctx)
+		close(sweeperDone)
+	}()
 
-	eventBus := channelevents.New(make(chan events.Event))
-	eventBus.RegisterHandler(handlers.NewDonationPayedHandler(&hub), "DonationPayed")
-	go eventBus.Run()
+	moderatorDone := make(chan struct{})
+	go func() {
+		moderator.Run(ctx)
+		close(moderatorDone)
+	}()
 
 	upgrader := websocket.Upgrader{}
 	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
@@ -85,17 +229,69 @@ func main() {
 		Upgrader:     upgrader,
 	}
 
+	ov := overlay.Overlay{Hub: &hub}
+	po := payouts.Payouts{
+		SR:         streamer.Repo{Repo: rep},
+		Connect:    stripeProvider,
+		RefreshURL: os.Getenv("BACKEND__PAYOUTS_REFRESH_URL"),
+		ReturnURL:  os.Getenv("BACKEND__PAYOUTS_RETURN_URL"),
+	}
+	st := settings.Settings{SR: streamer.Repo{Repo: rep}, Rates: rates}
+	bl := blocklistendpoint.Blocklist{BR: blocklist.Repo{Repo: rep}, DR: donation.Repo{Repo: rep}}
+	sseEndpoint := sse.SSE{
+		StreamerRepo: streamer.Repo{Repo: rep},
+		Hub:          &hub,
+	}
+
 	webhook := webhooks.WebhookEndpoint{
-		DonationRepo: donation.Repo{Repo: rep},
-		EventEmitter: &eventBus,
-		Config:       webhooks.WebhookConfig{Secret: os.Getenv("BACKEND__STRIPE_SECRET")},
+		DonationRepo:     donation.Repo{Repo: rep},
+		StreamerRepo:     streamer.Repo{Repo: rep},
+		EventRepo:        webhookevent.Repo{Repo: rep},
+		Providers:        paymentProviders,
+		SubscriptionRepo: subscription.Repo{Repo: rep},
+		Settler:          settler,
+	}
+	rc := admin.Reconciliation{
+		Mismatches: mismatch.Repo{Repo: rep},
+		Reconciler: paymentReconciler,
 	}
 	r := mux.NewRouter()
 	r.HandleFunc("/login/twitch", errorHandler(tw.HandleLogin)).Methods(http.MethodGet)
 	r.HandleFunc("/auth/twitch", errorHandler(tw.HandleOAuth2Callback)).Methods(http.MethodGet)
 	r.HandleFunc("/donation", useCORS(errorHandler(de.Create))).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/subscriptions", useCORS(errorHandler(de.Subscribe))).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/subscriptions", errorHandler(tw.RequireSession(de.Subscriptions))).Methods(http.MethodGet)
 	r.HandleFunc("/ws/{secretCode}", errorHandler(ws.Connect))
+	r.HandleFunc("/sse/{secretCode}", errorHandler(sseEndpoint.Connect)).Methods(http.MethodGet)
+	r.HandleFunc("/sse/{secretCode}", errorHandler(sseEndpoint.Message)).Methods(http.MethodPost)
+	r.HandleFunc("/donations/total", errorHandler(tw.RequireSession(de.Total))).Methods(http.MethodGet)
+	r.HandleFunc("/donations/{id}/refund", errorHandler(tw.RequireSession(de.Refund))).Methods(http.MethodPost)
+	r.HandleFunc("/moderation", errorHandler(tw.RequireSession(de.HeldDonations))).Methods(http.MethodGet)
+	r.HandleFunc("/moderation/{id}", errorHandler(tw.RequireSession(de.EditHeld))).Methods(http.MethodPut)
+	r.HandleFunc("/moderation/{id}/approve", errorHandler(tw.RequireSession(de.Approve))).Methods(http.MethodPost)
+	r.HandleFunc("/moderation/{id}/reject", errorHandler(tw.RequireSession(de.Reject))).Methods(http.MethodPost)
+	r.HandleFunc("/settings/currencies", errorHandler(tw.RequireSession(st.Currencies))).Methods(http.MethodGet)
+	r.HandleFunc("/settings/currencies", errorHandler(tw.RequireSession(st.UpdateCurrencies))).Methods(http.MethodPut)
+	r.HandleFunc("/settings/donations", errorHandler(tw.RequireSession(st.DonationSettings))).Methods(http.MethodGet)
+	r.HandleFunc("/settings/donations", errorHandler(tw.RequireSession(st.UpdateDonationSettings))).Methods(http.MethodPut)
+	r.HandleFunc("/settings/moderation", errorHandler(tw.RequireSession(st.ModerationSettings))).Methods(http.MethodGet)
+	r.HandleFunc("/settings/moderation", errorHandler(tw.RequireSession(st.UpdateModerationSettings))).Methods(http.MethodPut)
+	r.HandleFunc("/settings/filter", errorHandler(tw.RequireSession(st.FilterSettings))).Methods(http.MethodGet)
+	r.HandleFunc("/settings/filter", errorHandler(tw.RequireSession(st.UpdateFilterSettings))).Methods(http.MethodPut)
+	r.HandleFunc("/blocklist", errorHandler(tw.RequireSession(bl.List))).Methods(http.MethodGet)
+	r.HandleFunc("/blocklist", errorHandler(tw.RequireSession(bl.Add))).Methods(http.MethodPost)
+	r.HandleFunc("/blocklist/{id}", errorHandler(tw.RequireSession(bl.Remove))).Methods(http.MethodDelete)
+	r.HandleFunc("/payouts", errorHandler(tw.RequireSession(po.Status))).Methods(http.MethodGet)
+	r.HandleFunc("/payouts/onboarding", errorHandler(tw.RequireSession(po.Onboard))).Methods(http.MethodGet)
+	r.HandleFunc("/overlay/control", errorHandler(tw.RequireSession(ov.Control))).Methods(http.MethodPost)
 	r.HandleFunc("/webhooks", webhook.HandleWebhook).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/{provider}", webhook.HandleWebhook).Methods(http.MethodPost)
+
+	adminToken := os.Getenv("BACKEND__ADMIN_TOKEN")
+	r.HandleFunc("/admin/webhooks", errorHandler(admin.RequireToken(adminToken, webhook.ListEvents))).Methods(http.MethodGet)
+	r.HandleFunc("/admin/webhooks/{provider}/{id}/redrive", errorHandler(admin.RequireToken(adminToken, webhook.Redrive))).Methods(http.MethodPost)
+	r.HandleFunc("/admin/mismatches", errorHandler(admin.RequireToken(adminToken, rc.ListMismatches))).Methods(http.MethodGet)
+	r.HandleFunc("/admin/reconcile", errorHandler(admin.RequireToken(adminToken, rc.Reconcile))).Methods(http.MethodPost)
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
@@ -105,21 +301,42 @@ func main() {
 		Addr:    ":80",
 		Handler: r,
 	}
+	if err := serve(&s, sig, cancel, relayDone, reconcilerDone, sweeperDone, moderatorDone, busDone); err != nil {
+		log.Fatal(err)
+	}
+}
 
+// serve runs s until stop receives, then shuts it down, cancels the background
+// workers and waits until every one of them is done, so the events they
+// still hold are dispatched before the process exits.
+func serve(s *http.Server, stop <-chan os.Signal, cancel context.CancelFunc, done ...<-chan struct{}) error {
+	errC := make(chan error, 1)
 	go func() {
-		if err := s.ListenAndServe(); err != nil {
-			log.Fatal(err)
+		// Shutdown makes ListenAndServe return ErrServerClosed right away
+		if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errC <- err
 		}
 	}()
 
-	<-sig
+	select {
+	case err := <-errC:
+		return err
+	case <-stop:
+	}
 	log.Println("shouting down server...")
-	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
-	defer cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer shutdownCancel()
 
-	if err := s.Shutdown(ctx); err != nil {
-		log.Fatal(err)
+	// the workers are stopped even if some requests didn't finish in time
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error shutting down server: %v\n", err)
+	}
+
+	cancel()
+	for _, d := range done {
+		<-d
 	}
+	return nil
 }
 
 func useCORS(f http.HandlerFunc) http.HandlerFunc {
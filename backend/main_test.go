@@ -0,0 +1,62 @@
+//go:build unit
+// +build unit
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/donation-alarm/backend/internal/events"
+	channelevents "github.com/blindlobstar/donation-alarm/backend/internal/events/cevents"
+)
+
+type handlerFunc func(event any) error
+
+func (f handlerFunc) Handle(event any) error {
+	return f(event)
+}
+
+func TestServeShutdown(t *testing.T) {
+	eventBus := channelevents.New(make(chan events.Event, 8))
+	var mu sync.Mutex
+	handled := 0
+	eventBus.RegisterHandler(handlerFunc(func(event any) error {
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		handled++
+		mu.Unlock()
+		return nil
+	}), events.DonationPayedName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	busDone := make(chan struct{})
+	go func() {
+		eventBus.Run(ctx)
+		close(busDone)
+	}()
+	for i := 0; i < 5; i++ {
+		if err := eventBus.Publish(events.DonationPayed{DonationID: i}, events.DonationPayedName, nil, nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
+	stop <- os.Interrupt
+	s := http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+
+	// Test case 1: the server's shutdown is not an error and every buffered event is handled before serve returns
+	if err := serve(&s, stop, cancel, busDone); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 5 {
+		t.Fatalf("expected 5 handled events, got %d", handled)
+	}
+}